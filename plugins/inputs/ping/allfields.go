@@ -0,0 +1,61 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// allFieldsAccumulator adds the fields missing from a ping metric, like the
+// response times of a url without replies, with a sentinel value, so that
+// every ping metric has the same fields
+type allFieldsAccumulator struct {
+	telegraf.Accumulator
+	p *Ping
+}
+
+func (a *allFieldsAccumulator) AddFields(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	if measurement == "ping" {
+		for key, value := range a.p.missingFieldValues() {
+			if _, ok := fields[key]; !ok {
+				fields[key] = value
+			}
+		}
+	}
+	a.Accumulator.AddFields(measurement, fields, tags, t...)
+}
+
+// missingFieldValues returns the sentinel values of the fields of the ping
+// metric added by always_emit_all_fields: no packets transmitted or received,
+// 100% packet loss and -1 for the TTLs and the response times
+func (p *Ping) missingFieldValues() map[string]interface{} {
+	suffix := "_ms"
+	if p.OutputUnit == "s" {
+		suffix = "_s"
+	}
+	var latency interface{} = -1.0
+	if p.IntegerLatency {
+		latency = int64(-1)
+	}
+
+	return map[string]interface{}{
+		"packets_transmitted":         0,
+		"packets_received":            0,
+		"percent_packet_loss":         100.0,
+		"ttl":                         -1,
+		"ttl_min":                     -1,
+		"ttl_max":                     -1,
+		"minimum_response" + suffix:   latency,
+		"average_response" + suffix:   latency,
+		"maximum_response" + suffix:   latency,
+		"standard_deviation" + suffix: -1.0,
+	}
+}
@@ -0,0 +1,73 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherAlwaysEmitAllFields(t *testing.T) {
+	p := Ping{
+		Urls:                []string{"www.amazon.com"},
+		AlwaysEmitAllFields: true,
+		resolve:             func(string) ([]string, error) { return []string{"192.0.2.1"}, nil },
+		pingHost:            mockFatalHostPinger,
+	}
+
+	var acc testutil.Accumulator
+	p.Gather(&acc)
+	acc.AssertContainsTaggedFields(t, "ping", map[string]interface{}{
+		"result_code":           2,
+		"packets_transmitted":   0,
+		"packets_received":      0,
+		"percent_packet_loss":   100.0,
+		"ttl":                   -1,
+		"ttl_min":               -1,
+		"ttl_max":               -1,
+		"minimum_response_ms":   -1.0,
+		"average_response_ms":   -1.0,
+		"maximum_response_ms":   -1.0,
+		"standard_deviation_ms": -1.0,
+	}, map[string]string{"url": "www.amazon.com"})
+}
+
+func TestGatherAlwaysEmitAllFieldsComplete(t *testing.T) {
+	p := Ping{
+		Urls:                []string{"www.google.com"},
+		AlwaysEmitAllFields: true,
+		resolve:             func(string) ([]string, error) { return []string{"216.58.218.164"}, nil },
+		pingHost:            mockHostPinger,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(p.Gather))
+	acc.AssertContainsTaggedFields(t, "ping", map[string]interface{}{
+		"result_code":           0,
+		"packets_transmitted":   5,
+		"packets_received":      5,
+		"percent_packet_loss":   0.0,
+		"ttl":                   63,
+		"ttl_min":               63,
+		"ttl_max":               63,
+		"minimum_response_ms":   35.225,
+		"average_response_ms":   43.628,
+		"maximum_response_ms":   51.806,
+		"standard_deviation_ms": 5.325,
+	}, map[string]string{"url": "www.google.com"})
+}
+
+func TestMissingFieldValuesIntegerLatency(t *testing.T) {
+	p := Ping{IntegerLatency: true}
+	values := p.missingFieldValues()
+	require.Equal(t, int64(-1), values["average_response_ms"])
+	require.Equal(t, -1.0, values["standard_deviation_ms"])
+
+	p = Ping{OutputUnit: "s"}
+	values = p.missingFieldValues()
+	require.Equal(t, -1.0, values["average_response_s"])
+	require.NotContains(t, values, "average_response_ms")
+}
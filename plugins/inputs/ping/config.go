@@ -0,0 +1,272 @@
+package ping
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+)
+
+// HostPinger is a function that runs the "ping" function using a list of
+// passed arguments. This can be easily switched with a mocked ping function
+// for unit test purposes (see ping_test.go)
+type HostPinger func(binary string, timeout float64, args ...string) (string, error)
+
+// Ping is the ping input. Its options are the same on every platform so that
+// a configuration loads on all of them, ping.exe only supports some of them
+// and ignores the others on Windows.
+type Ping struct {
+	wg sync.WaitGroup
+
+	// Interval at which to ping (ping -i <INTERVAL>)
+	PingInterval float64 `toml:"ping_interval"`
+
+	// Smallest ping interval allowed, in seconds, and what to do with a
+	// smaller PingInterval: "adjust" raises it with a warning, "error"
+	// rejects the configuration
+	MinPingInterval    float64 `toml:"min_ping_interval"`
+	PingIntervalPolicy string  `toml:"ping_interval_policy"`
+
+	// Flood ping at up to RapidMaxRate packets per second, which requires
+	// privileges (ping -f)
+	Rapid        bool    `toml:"rapid"`
+	RapidMaxRate float64 `toml:"rapid_max_rate"`
+
+	// Number of pings to send (ping -c <COUNT>, ping.exe -n <COUNT>)
+	Count int
+
+	// TTL of the sent packets, 0 uses the default of ping (ping -t <TTL>)
+	TTL int `toml:"ttl"`
+
+	// Firewall mark of the sent packets, to route them with policy routing
+	// on Linux, 0 for none (ping -m <MARK>)
+	FirewallMark int `toml:"firewall_mark"`
+
+	// Number of data bytes sent in each packet, 0 sends 16 bytes
+	// (ping -s <SIZE>, ping.exe -l <SIZE>)
+	Size int `toml:"size"`
+
+	// Ping timeout, in seconds. 0 means no timeout (ping -W <TIMEOUT>,
+	// ping.exe -w <TIMEOUT>)
+	Timeout float64
+
+	// Ping deadline, 0 means no deadline. Integers are seconds, the ping
+	// command is killed once it is reached (ping -w <DEADLINE>)
+	Deadline internal.Duration
+
+	// Interface or source address to send ping from (ping -I/-S <INTERFACE/SRC_ADDR>)
+	Interface string
+
+	// Interfaces or source addresses to spread the pings over, instead of a
+	// single interface
+	Interfaces []string `toml:"interfaces"`
+
+	// How urls are pinged from interfaces, "round-robin" pings each url from
+	// one of them and "all" pings every url from each of them
+	InterfaceMode string `toml:"interface_mode"`
+
+	// Address family to ping with, "ipv4" or "ipv6" (ping -4/-6).
+	// Empty lets ping pick the family of the resolved address.
+	AddressFamily string `toml:"address_family"`
+
+	// Unit of the response time fields, "ms" or "s"
+	OutputUnit string `toml:"output_unit"`
+
+	// Round the minimum, average and maximum response times to integers
+	IntegerLatency bool `toml:"integer_latency"`
+
+	// Wall clock boundary to start probes at, 0 starts them immediately
+	ProbeAlignment internal.Duration `toml:"probe_alignment"`
+
+	// Maximum random delay before each url is pinged, 0 starts all urls
+	// at once
+	StartJitter internal.Duration `toml:"start_jitter"`
+
+	// URLs to ping
+	Urls []string
+
+	// Ping executable binary
+	Binary string
+
+	// Emit a ping_summary metric counting the urls that succeeded or failed
+	// in each gather
+	EmitSummary bool `toml:"emit_summary"`
+
+	// Tag every metric with target_type, "ip" for a url that is an IP
+	// address and "hostname" otherwise
+	TagTargetType bool `toml:"tag_target_type"`
+
+	// Add the fields missing from a ping metric with sentinel values, so
+	// that every metric has the same fields
+	AlwaysEmitAllFields bool `toml:"always_emit_all_fields"`
+
+	// Number of times a failed DNS lookup of a url is retried, with an
+	// exponential backoff, before the url is reported with result_code 1
+	DNSRetries int `toml:"dns_retries"`
+
+	// Number of times a ping failing with an error, rather than with lost
+	// packets, is retried before the url is reported with result_code 2
+	GatherRetries int `toml:"gather_retries"`
+
+	// Report the DNS lookups of a gather failing for the same reason as a
+	// single error
+	GroupDNSErrors bool `toml:"group_dns_errors"`
+
+	// Ping the default gateway before the urls and add its reachability to
+	// their metrics
+	PingGateway bool `toml:"ping_gateway"`
+
+	// Ping urls losing packets again at RateLimitProbeInterval, to tell ICMP
+	// rate limiting by the target apart from actual loss
+	DetectRateLimiting     bool    `toml:"detect_rate_limiting"`
+	RateLimitProbeInterval float64 `toml:"rate_limit_probe_interval"`
+
+	// Packet loss, in percent, up to which a url that received at least one
+	// packet is reported with result_code 0, 0 disables the threshold
+	LossThresholdPercent float64 `toml:"loss_threshold_percent"`
+
+	// Include the output of ping in the error reported when it cannot be
+	// parsed
+	DebugOutput bool `toml:"debug_output"`
+
+	// Add a probe_seq field counting the gathers of every url, gaps in the
+	// sequence reveal missed gathers
+	EmitProbeSeq bool `toml:"emit_probe_seq"`
+
+	// Parse every reply of ping for the statistics of single packets, like
+	// the reordered_packets field
+	PerPacket bool `toml:"per_packet"`
+
+	// Report the duplicate replies in the ping_reply metrics of per_packet
+	ReportDuplicates bool `toml:"report_duplicates"`
+
+	// Weight of the latest average response time in the exponential moving
+	// average of the average_response_ewma field, 0 disables the field
+	EMAAlpha float64 `toml:"ema_alpha"`
+
+	// Number of gathers in a row without a response after which the moving
+	// average of a url starts over
+	EMAResetAfter int `toml:"ema_reset_after"`
+
+	// Arguments for ping command.
+	// when `Arguments` is not empty, other options (ping_interval, timeout, etc) will be ignored
+	Arguments []string
+
+	// Method used to ping hosts, "exec" runs one ping command per url,
+	// "fping" probes all urls with a single fping command and "tcp" times
+	// TCP connections instead of sending ICMP echo requests
+	Method string
+
+	// Time a ping command may run longer than expected from the count,
+	// timeout and ping_interval before it is killed
+	CommandTimeoutSlop internal.Duration `toml:"command_timeout_slop"`
+
+	// Fping executable binary, used when Method is "fping"
+	FpingBinary string `toml:"fping_binary"`
+
+	// Port to connect to when Method is "tcp" and the url has no port
+	TCPPort int `toml:"tcp_port"`
+
+	// Named sets of count, ping_interval and size used in some gathers
+	// instead of the options above
+	Profiles []profile `toml:"profile"`
+
+	// host ping function
+	pingHost HostPinger
+
+	// default gateway lookup, replaced in tests
+	findGateway func() (string, error)
+
+	// DNS lookup, net.LookupHost if nil
+	resolve func(host string) ([]string, error)
+
+	// executable lookup, the binary is run without resolving it first if nil
+	lookPath func(file string) (string, error)
+
+	// binaryPath is the resolved path of binaryName, the Binary it was
+	// resolved for
+	binaryPath string
+	binaryName string
+
+	// initialized is set once the configuration has been validated, initErr
+	// holds the result of that validation
+	initialized bool
+	initErr     error
+
+	// probeSeq is the number of gathers of every url, for emit_probe_seq
+	probeSeq map[string]int64
+
+	// ema is the moving average of the response time of every url, for
+	// ema_alpha, guarded by emaMu as urls are pinged concurrently
+	ema   map[string]*emaState
+	emaMu sync.Mutex
+
+	// gathers is the number of gathers, to select the active profile
+	gathers int64
+}
+
+// profile is a named set of ping options used instead of those of the plugin
+// in every Every-th gather. Options left at 0 keep the value of the plugin.
+type profile struct {
+	Name         string  `toml:"name"`
+	Every        int     `toml:"every"`
+	Count        int     `toml:"count"`
+	PingInterval float64 `toml:"ping_interval"`
+	Size         int     `toml:"size"`
+}
+
+// emaState is the exponential moving average of the average response time of
+// a url, and the number of gathers in a row the url did not respond in
+type emaState struct {
+	value  float64
+	misses int
+}
+
+// newPing returns a Ping with the default options, the ping command and the
+// timeout are set by the platform
+func newPing() *Ping {
+	return &Ping{
+		PingInterval:           1.0,
+		MinPingInterval:        0.2,
+		RateLimitProbeInterval: 1.0,
+		PingIntervalPolicy:     "adjust",
+		RapidMaxRate:           100.0,
+		Count:                  1,
+		Deadline:               internal.Duration{Duration: 10 * time.Second},
+		Binary:                 "ping",
+		Arguments:              []string{},
+		Method:                 "exec",
+		OutputUnit:             "ms",
+		FpingBinary:            "fping",
+		CommandTimeoutSlop:     internal.Duration{Duration: 5 * time.Second},
+		EMAResetAfter:          3,
+	}
+}
+
+// changedOptions returns the names of the options of p that are not set to
+// their default value, leaving out those in supported
+func (p *Ping) changedOptions(supported map[string]bool) []string {
+	defaults := reflect.ValueOf(newPing()).Elem()
+	options := reflect.ValueOf(p).Elem()
+
+	var changed []string
+	for i := 0; i < options.NumField(); i++ {
+		field := options.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Tag.Get("toml")
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if supported[name] {
+			continue
+		}
+		if !reflect.DeepEqual(options.Field(i).Interface(), defaults.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,21 @@
+package ping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedOptions(t *testing.T) {
+	p := newPing()
+	require.Empty(t, p.changedOptions(nil))
+
+	p.Urls = []string{"example.org"}
+	p.Count = 3
+	p.Deadline.Duration = time.Second
+	p.PerPacket = true
+	p.Method = "tcp"
+	require.Equal(t, []string{"deadline", "per_packet", "method"},
+		p.changedOptions(map[string]bool{"urls": true, "count": true}))
+}
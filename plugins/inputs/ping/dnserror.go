@@ -0,0 +1,100 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/influxdata/telegraf"
+)
+
+// dnsErrorHosts is the number of urls named in a grouped DNS error
+const dnsErrorHosts = 5
+
+// dnsError is the error of the DNS lookup of the host of a url
+type dnsError struct {
+	host string
+	err  error
+}
+
+func (e *dnsError) Error() string {
+	return e.err.Error()
+}
+
+// cause returns the error without the host, the same for every host failing
+// for the same reason, like an unreachable resolver
+func (e *dnsError) cause() string {
+	if err, ok := e.err.(*net.DNSError); ok {
+		if err.Server != "" {
+			return fmt.Sprintf("lookup on %s: %s", err.Server, err.Err)
+		}
+		return err.Err
+	}
+	return e.err.Error()
+}
+
+// dnsErrorAccumulator holds the DNS errors of a gather and reports those with
+// the same cause as a single error naming the urls, once flushed
+type dnsErrorAccumulator struct {
+	telegraf.Accumulator
+
+	mu      sync.Mutex
+	causes  []string
+	byCause map[string][]*dnsError
+}
+
+func newDNSErrorAccumulator(acc telegraf.Accumulator) *dnsErrorAccumulator {
+	return &dnsErrorAccumulator{
+		Accumulator: acc,
+		byCause:     make(map[string][]*dnsError),
+	}
+}
+
+func (a *dnsErrorAccumulator) AddError(err error) {
+	dnsErr, ok := err.(*dnsError)
+	if !ok {
+		a.Accumulator.AddError(err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cause := dnsErr.cause()
+	if _, ok := a.byCause[cause]; !ok {
+		a.causes = append(a.causes, cause)
+	}
+	a.byCause[cause] = append(a.byCause[cause], dnsErr)
+}
+
+// flush reports the DNS errors held, in the order of their first occurrence
+func (a *dnsErrorAccumulator) flush() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, cause := range a.causes {
+		errs := a.byCause[cause]
+		if len(errs) == 1 {
+			a.Accumulator.AddError(errs[0])
+			continue
+		}
+
+		hosts := make([]string, 0, dnsErrorHosts)
+		for _, err := range errs {
+			if len(hosts) == dnsErrorHosts {
+				break
+			}
+			hosts = append(hosts, err.host)
+		}
+		list := strings.Join(hosts, ", ")
+		if len(errs) > dnsErrorHosts {
+			list += fmt.Sprintf(" and %d more", len(errs)-dnsErrorHosts)
+		}
+		a.Accumulator.AddError(fmt.Errorf("DNS lookup of %d urls failed (%s): %s", len(errs), list, cause))
+	}
+	a.causes = nil
+	a.byCause = make(map[string][]*dnsError)
+}
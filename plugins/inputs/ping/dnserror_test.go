@@ -0,0 +1,82 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSErrorCause(t *testing.T) {
+	err := &dnsError{
+		host: "www.google.com",
+		err:  &net.DNSError{Err: "i/o timeout", Name: "www.google.com", Server: "10.0.0.53:53"},
+	}
+	assert.Equal(t, "lookup www.google.com on 10.0.0.53:53: i/o timeout", err.Error())
+	assert.Equal(t, "lookup on 10.0.0.53:53: i/o timeout", err.cause())
+
+	err = &dnsError{host: "www.google.com", err: &net.DNSError{Err: "no such host", Name: "www.google.com"}}
+	assert.Equal(t, "no such host", err.cause())
+}
+
+func TestGatherGroupDNSErrors(t *testing.T) {
+	urls := []string{"a.example.org", "b.example.org", "c.example.org", "d.example.org",
+		"e.example.org", "f.example.org", "g.example.org"}
+	p := Ping{
+		Urls:           urls,
+		GroupDNSErrors: true,
+		EmitSummary:    true,
+		resolve: func(host string) ([]string, error) {
+			if host == "g.example.org" {
+				return nil, errors.New("no such host")
+			}
+			return nil, &net.DNSError{Err: "i/o timeout", Name: host, Server: "10.0.0.53:53"}
+		},
+		pingHost: mockHostPinger,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, p.Gather(&acc))
+
+	for _, u := range urls {
+		assert.True(t, acc.HasPoint("ping", map[string]string{"url": u}, "result_code", 1))
+	}
+	require.Len(t, acc.Errors, 2)
+	var messages []string
+	for _, err := range acc.Errors {
+		messages = append(messages, err.Error())
+	}
+	assert.Contains(t, messages, "no such host")
+	for _, message := range messages {
+		if message != "no such host" {
+			assert.Regexp(t, `^DNS lookup of 6 urls failed \(([a-f]\.example\.org, ){4}[a-f]\.example\.org and 1 more\): lookup on 10\.0\.0\.53:53: i/o timeout$`, message)
+		}
+	}
+	acc.AssertContainsFields(t, "ping_summary", map[string]interface{}{
+		"total":        7,
+		"successful":   0,
+		"failed":       7,
+		"dns_failures": 7,
+		"dns_outage":   true,
+	})
+}
+
+func TestGatherDNSErrorsUngrouped(t *testing.T) {
+	p := Ping{
+		Urls: []string{"a.example.org", "b.example.org"},
+		resolve: func(host string) ([]string, error) {
+			return nil, &net.DNSError{Err: "i/o timeout", Name: host, Server: "10.0.0.53:53"}
+		},
+		pingHost: mockHostPinger,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, p.Gather(&acc))
+	assert.Len(t, acc.Errors, 2)
+}
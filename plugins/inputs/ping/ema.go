@@ -0,0 +1,89 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// checkEMA validates ema_alpha and ema_reset_after
+func (p *Ping) checkEMA() error {
+	if p.EMAAlpha < 0 || p.EMAAlpha > 1 {
+		return fmt.Errorf("invalid ema_alpha %v, must be between 0 and 1", p.EMAAlpha)
+	}
+	if p.EMAAlpha > 0 && p.EMAResetAfter < 1 {
+		return fmt.Errorf("invalid ema_reset_after %d, must be at least 1", p.EMAResetAfter)
+	}
+	return nil
+}
+
+// updateEMA adds the average response time of a url to its moving average
+// and returns the new average. A url without a response time keeps its
+// average until it missed ema_reset_after gathers in a row, the average then
+// starts over from the next response time.
+func (p *Ping) updateEMA(url string, avg float64, ok bool) (float64, bool) {
+	p.emaMu.Lock()
+	defer p.emaMu.Unlock()
+	if p.ema == nil {
+		p.ema = make(map[string]*emaState)
+	}
+
+	state, found := p.ema[url]
+	if !ok {
+		if found {
+			state.misses++
+			if state.misses >= p.EMAResetAfter {
+				delete(p.ema, url)
+			}
+		}
+		return 0, false
+	}
+
+	if !found {
+		p.ema[url] = &emaState{value: avg}
+		return avg, true
+	}
+	state.value = p.EMAAlpha*avg + (1-p.EMAAlpha)*state.value
+	state.misses = 0
+	return state.value, true
+}
+
+// emaAccumulator adds the moving average of the average response time to
+// every ping metric
+type emaAccumulator struct {
+	telegraf.Accumulator
+	p *Ping
+}
+
+func (a *emaAccumulator) AddFields(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	if measurement == "ping" {
+		suffix := "_ms"
+		if a.p.OutputUnit == "s" {
+			suffix = "_s"
+		}
+		// a url pinged from several interfaces has an average per
+		// interface
+		key := tags["url"]
+		if iface, ok := tags["source_interface"]; ok {
+			key += "@" + iface
+		}
+		avg, ok := fields["average_response"+suffix].(float64)
+		if n, isInt := fields["average_response"+suffix].(int64); isInt {
+			// rounded by integer_latency
+			avg, ok = float64(n), true
+		}
+		if ema, ok := a.p.updateEMA(key, avg, ok); ok {
+			fields["average_response_ewma"+suffix] = ema
+		}
+	}
+	a.Accumulator.AddFields(measurement, fields, tags, t...)
+}
@@ -0,0 +1,78 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateEMA(t *testing.T) {
+	p := Ping{EMAAlpha: 0.5, EMAResetAfter: 2}
+
+	ema, ok := p.updateEMA("localhost", 10, true)
+	assert.True(t, ok)
+	assert.Equal(t, 10.0, ema)
+
+	ema, _ = p.updateEMA("localhost", 20, true)
+	assert.Equal(t, 15.0, ema)
+
+	// a single miss keeps the average
+	_, ok = p.updateEMA("localhost", 0, false)
+	assert.False(t, ok)
+	ema, _ = p.updateEMA("localhost", 25, true)
+	assert.Equal(t, 20.0, ema)
+
+	// ema_reset_after misses in a row start it over
+	p.updateEMA("localhost", 0, false)
+	p.updateEMA("localhost", 0, false)
+	ema, _ = p.updateEMA("localhost", 100, true)
+	assert.Equal(t, 100.0, ema)
+}
+
+func TestGatherEMA(t *testing.T) {
+	responding := true
+	p := Ping{
+		Urls:          []string{"localhost"},
+		Count:         1,
+		EMAAlpha:      0.5,
+		EMAResetAfter: 1,
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			if !responding {
+				return "", errors.New("host unreachable")
+			}
+			return linuxPingOutput, nil
+		},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(p.Gather))
+	require.NoError(t, acc.GatherError(p.Gather))
+	require.Len(t, acc.Metrics, 2)
+	for _, m := range acc.Metrics {
+		assert.Equal(t, 43.628, m.Fields["average_response_ewma_ms"])
+	}
+
+	acc.ClearMetrics()
+	responding = false
+	p.Gather(&acc)
+	require.Len(t, acc.Metrics, 1)
+	assert.NotContains(t, acc.Metrics[0].Fields, "average_response_ewma_ms")
+	assert.Empty(t, p.ema)
+}
+
+func TestCheckEMA(t *testing.T) {
+	p := Ping{EMAAlpha: 1.5, EMAResetAfter: 3}
+	require.EqualError(t, p.checkEMA(), "invalid ema_alpha 1.5, must be between 0 and 1")
+
+	p = Ping{EMAAlpha: 0.5}
+	require.EqualError(t, p.checkEMA(), "invalid ema_reset_after 0, must be at least 1")
+
+	p = Ping{}
+	require.NoError(t, p.checkEMA())
+}
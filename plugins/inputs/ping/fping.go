@@ -0,0 +1,193 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/influxdata/telegraf"
+)
+
+// fpingLine matches the per host summary printed by fping -C, like:
+//
+//	www.google.com : 15.08 21.56 - 18.82
+var fpingLine = regexp.MustCompile(`^(\S+)\s+:\s+((?:[\d.]+|-)(?:\s+(?:[\d.]+|-))*)\s*$`)
+
+// fpingStats holds the statistics computed for one host from fping output.
+type fpingStats struct {
+	trans, recv           int
+	min, avg, max, stddev float64
+}
+
+// fping probes all urls with a single fping command and adds the same
+// metrics as pingToURL for every url, the added fields are also returned.
+func (p *Ping) fping(acc telegraf.Accumulator) []map[string]interface{} {
+	var results []map[string]interface{}
+	hosts := make([]string, 0, len(p.Urls))
+	// fields of the resolved hosts, which already hold dns_attempts
+	hostFields := make(map[string]map[string]interface{}, len(p.Urls))
+	for _, u := range p.Urls {
+		if err := checkNoPort(u); err != nil {
+			acc.AddError(err)
+			fields := map[string]interface{}{"result_code": 2}
+			acc.AddFields("ping", fields, p.urlTags(u))
+			results = append(results, fields)
+			continue
+		}
+		fields := map[string]interface{}{"result_code": 0}
+		if _, err := p.lookupHost(u, fields); err != nil {
+			acc.AddError(err)
+			fields["result_code"] = 1
+			acc.AddFields("ping", fields, p.urlTags(u))
+			results = append(results, fields)
+			continue
+		}
+		hosts = append(hosts, u)
+		hostFields[u] = fields
+	}
+	if len(hosts) == 0 {
+		return results
+	}
+
+	totalTimeout := 60.0
+	if len(p.Arguments) == 0 {
+		totalTimeout = float64(p.Count)*p.Timeout + float64(p.Count-1)*p.PingInterval
+	}
+
+	out, err := p.pingHost(p.FpingBinary, p.commandTimeout(totalTimeout), p.fpingArgs(hosts)...)
+	if err != nil {
+		// fping exits with 1 when some hosts are unreachable and with 2
+		// when some hosts could not be resolved, the summary is still
+		// printed for all other hosts in both cases.
+		status := -1
+		if exitError, ok := err.(*exec.ExitError); ok {
+			if ws, ok := exitError.Sys().(syscall.WaitStatus); ok {
+				status = ws.ExitStatus()
+			}
+		}
+
+		if status != 1 && status != 2 {
+			if execErr, ok := err.(*exec.Error); ok && execErr.Err == exec.ErrNotFound {
+				err = fmt.Errorf("fping binary %q not found, install fping or use method = \"exec\"", p.FpingBinary)
+			} else if out = strings.TrimSpace(out); len(out) > 0 {
+				err = fmt.Errorf("%s, %s", out, err)
+			}
+			acc.AddError(fmt.Errorf("fping: %s", err))
+			for _, u := range hosts {
+				fields := hostFields[u]
+				fields["result_code"] = 2
+				acc.AddFields("ping", fields, p.urlTags(u))
+				results = append(results, fields)
+			}
+			return results
+		}
+	}
+
+	stats := processFpingOutput(out)
+	for _, u := range hosts {
+		tags := p.urlTags(u)
+		fields := hostFields[u]
+
+		s, ok := stats[u]
+		if !ok {
+			acc.AddError(fmt.Errorf("host %s: no result in fping output", u))
+			fields["result_code"] = 2
+			acc.AddFields("ping", fields, tags)
+			results = append(results, fields)
+			continue
+		}
+
+		fields["packets_transmitted"] = s.trans
+		fields["packets_received"] = s.recv
+		fields["percent_packet_loss"] = float64(s.trans-s.recv) / float64(s.trans) * 100.0
+		p.addResponseFields(fields, s.min, s.avg, s.max, s.stddev)
+		acc.AddFields("ping", fields, tags)
+		results = append(results, fields)
+	}
+	return results
+}
+
+// fpingArgs returns the arguments for the 'fping' executable
+func (p *Ping) fpingArgs(hosts []string) []string {
+	if len(p.Arguments) > 0 {
+		return append(p.Arguments, hosts...)
+	}
+
+	args := []string{"-C", strconv.Itoa(p.Count), "-q"}
+	switch p.AddressFamily {
+	case "ipv4":
+		args = append(args, "-4")
+	case "ipv6":
+		args = append(args, "-6")
+	}
+	if p.PingInterval > 0 {
+		args = append(args, "-p", strconv.FormatFloat(p.PingInterval*1000, 'f', 0, 64))
+	}
+	if p.Timeout > 0 {
+		args = append(args, "-t", strconv.FormatFloat(p.Timeout*1000, 'f', 0, 64))
+	}
+	if p.TTL > 0 {
+		args = append(args, "-H", strconv.Itoa(p.TTL))
+	}
+	if p.FirewallMark > 0 {
+		args = append(args, "-k", strconv.Itoa(p.FirewallMark))
+	}
+	if p.Interface != "" {
+		if net.ParseIP(p.Interface) != nil {
+			args = append(args, "-S", p.Interface)
+		} else {
+			args = append(args, "-I", p.Interface)
+		}
+	}
+	return append(args, hosts...)
+}
+
+// processFpingOutput takes in the output of fping -C -q, like:
+//
+//	www.google.com : 15.08 21.56 - 18.82
+//	www.amazon.com : - - - -
+//
+// It returns the statistics for each host found in the output, lost
+// packets are reported by fping as "-".
+func processFpingOutput(out string) map[string]fpingStats {
+	stats := make(map[string]fpingStats)
+	for _, line := range strings.Split(out, "\n") {
+		match := fpingLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+
+		var rtts []float64
+		samples := strings.Fields(match[2])
+		for _, sample := range samples {
+			if sample == "-" {
+				continue
+			}
+			rtt, err := strconv.ParseFloat(sample, 64)
+			if err != nil {
+				continue
+			}
+			rtts = append(rtts, rtt)
+		}
+		s := fpingStats{
+			trans:  len(samples),
+			recv:   len(rtts),
+			min:    -1.0,
+			avg:    -1.0,
+			max:    -1.0,
+			stddev: -1.0,
+		}
+		if len(rtts) > 0 {
+			s.min, s.avg, s.max, s.stddev = rttStats(rtts)
+		}
+		stats[match[1]] = s
+	}
+	return stats
+}
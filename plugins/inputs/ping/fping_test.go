@@ -0,0 +1,137 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"math"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fping -C 4 -q output
+var fpingOutput = `
+www.google.com : 15.08 21.56 27.26 18.82
+www.reddit.com : 35.50 - 45.50 -
+www.amazon.com : - - - -
+`
+
+// Test that fping command output is processed properly
+func TestProcessFpingOutput(t *testing.T) {
+	stats := processFpingOutput(fpingOutput)
+	require.Len(t, stats, 3)
+
+	s := stats["www.google.com"]
+	assert.Equal(t, 4, s.trans, "4 packets were transmitted")
+	assert.Equal(t, 4, s.recv, "4 packets were received")
+	assert.InDelta(t, 15.08, s.min, 0.001)
+	assert.InDelta(t, 20.68, s.avg, 0.001)
+	assert.InDelta(t, 27.26, s.max, 0.001)
+	assert.InDelta(t, 5.128, s.stddev, 0.001)
+
+	s = stats["www.reddit.com"]
+	assert.Equal(t, 4, s.trans, "4 packets were transmitted")
+	assert.Equal(t, 2, s.recv, "2 packets were received")
+	assert.InDelta(t, 35.50, s.min, 0.001)
+	assert.InDelta(t, 40.50, s.avg, 0.001)
+	assert.InDelta(t, 45.50, s.max, 0.001)
+
+	s = stats["www.amazon.com"]
+	assert.Equal(t, 4, s.trans, "4 packets were transmitted")
+	assert.Equal(t, 0, s.recv, "no packets were received")
+	assert.Equal(t, -1.0, s.avg)
+}
+
+func TestFpingArgs(t *testing.T) {
+	p := Ping{
+		Count:        2,
+		Interface:    "eth0",
+		Timeout:      1.5,
+		PingInterval: 0.5,
+	}
+
+	actual := p.fpingArgs([]string{"www.google.com", "www.reddit.com"})
+	expected := []string{"-C", "2", "-q", "-p", "500", "-t", "1500", "-I", "eth0", "www.google.com", "www.reddit.com"}
+	require.True(t, reflect.DeepEqual(expected, actual),
+		"Expected: %s Actual: %s", expected, actual)
+
+	p.Interface = "192.168.1.2"
+	actual = p.fpingArgs([]string{"www.google.com"})
+	expected = []string{"-C", "2", "-q", "-p", "500", "-t", "1500", "-S", "192.168.1.2", "www.google.com"}
+	require.True(t, reflect.DeepEqual(expected, actual),
+		"Expected: %s Actual: %s", expected, actual)
+
+	p.Interface = ""
+	p.FirewallMark = 10
+	actual = p.fpingArgs([]string{"www.google.com"})
+	expected = []string{"-C", "2", "-q", "-p", "500", "-t", "1500", "-k", "10", "www.google.com"}
+	require.True(t, reflect.DeepEqual(expected, actual),
+		"Expected: %s Actual: %s", expected, actual)
+}
+
+// Test that Gather runs a single fping command for all urls
+func TestFpingGather(t *testing.T) {
+	var acc testutil.Accumulator
+	calls := 0
+	p := Ping{
+		Urls:        []string{"www.google.com", "www.reddit.com", "www.amazon.com"},
+		Count:       4,
+		Method:      "fping",
+		FpingBinary: "fping",
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			calls++
+			assert.Equal(t, "fping", binary)
+			return fpingOutput, nil
+		},
+	}
+
+	acc.GatherError(p.Gather)
+	assert.Equal(t, 1, calls)
+
+	acc.AssertContainsTaggedFields(t, "ping",
+		map[string]interface{}{
+			"packets_transmitted":   4,
+			"packets_received":      2,
+			"percent_packet_loss":   50.0,
+			"minimum_response_ms":   35.5,
+			"average_response_ms":   40.5,
+			"maximum_response_ms":   45.5,
+			"standard_deviation_ms": math.Sqrt(50),
+			"result_code":           0,
+		},
+		map[string]string{"url": "www.reddit.com"})
+
+	acc.AssertContainsTaggedFields(t, "ping",
+		map[string]interface{}{
+			"packets_transmitted": 4,
+			"packets_received":    0,
+			"percent_packet_loss": 100.0,
+			"result_code":         0,
+		},
+		map[string]string{"url": "www.amazon.com"})
+}
+
+// Test that a missing fping binary reports a clear error
+func TestFpingNotFound(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:        []string{"www.google.com"},
+		Method:      "fping",
+		FpingBinary: "fping",
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			return "", &exec.Error{Name: binary, Err: exec.ErrNotFound}
+		},
+	}
+
+	acc.GatherError(p.Gather)
+	require.Len(t, acc.Errors, 1)
+	assert.Contains(t, acc.Errors[0].Error(), `fping binary "fping" not found`)
+	acc.AssertContainsTaggedFields(t, "ping",
+		map[string]interface{}{"result_code": 2},
+		map[string]string{"url": "www.google.com"})
+}
@@ -0,0 +1,97 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// parseDefaultGateway returns the gateway of the default route of a routing
+// table in the /proc/net/route format, where addresses are hexadecimal in
+// host byte order
+func parseDefaultGateway(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != 4 {
+			return "", fmt.Errorf("invalid gateway %q in routing table", fields[2])
+		}
+		if b[0] == 0 && b[1] == 0 && b[2] == 0 && b[3] == 0 {
+			continue
+		}
+		return net.IPv4(b[3], b[2], b[1], b[0]).String(), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no default gateway in routing table")
+}
+
+// checkPingGateway rejects ping_gateway on systems other than Linux, the
+// default gateway is read from its routing table
+func (p *Ping) checkPingGateway(system string) error {
+	if p.PingGateway && system != "linux" {
+		return fmt.Errorf("ping_gateway is only supported on Linux")
+	}
+	return nil
+}
+
+// gatewayAccumulator adds the gateway and its reachability to every ping
+// metric of a target
+type gatewayAccumulator struct {
+	telegraf.Accumulator
+	gateway   string
+	reachable bool
+}
+
+func (a *gatewayAccumulator) AddFields(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	if measurement == "ping" {
+		withGateway := make(map[string]string, len(tags)+1)
+		for k, v := range tags {
+			withGateway[k] = v
+		}
+		withGateway["gateway"] = a.gateway
+		tags = withGateway
+		fields["gateway_reachable"] = a.reachable
+	}
+	a.Accumulator.AddFields(measurement, fields, tags, t...)
+}
+
+// pingGateway pings the default gateway with the ping command and returns
+// an accumulator adding its reachability to the target metrics. The gateway
+// itself is added as a regular ping metric.
+func (p *Ping) pingGateway(acc telegraf.Accumulator) (telegraf.Accumulator, error) {
+	findGateway := p.findGateway
+	if findGateway == nil {
+		findGateway = defaultGateway
+	}
+	gateway, err := findGateway()
+	if err != nil {
+		return acc, fmt.Errorf("default gateway: %s", err)
+	}
+
+	fields := p.pingToURL(gateway, acc)
+	return &gatewayAccumulator{
+		Accumulator: acc,
+		gateway:     gateway,
+		reachable:   reachable(fields),
+	}, nil
+}
@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package ping
+
+import (
+	"os"
+)
+
+// routeTable is the IPv4 routing table of the kernel
+const routeTable = "/proc/net/route"
+
+// defaultGateway returns the gateway of the IPv4 default route
+func defaultGateway() (string, error) {
+	f, err := os.Open(routeTable)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return parseDefaultGateway(f)
+}
@@ -0,0 +1,14 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package ping
+
+import (
+	"errors"
+)
+
+// defaultGateway returns an error, the default gateway is only read from the
+// routing table of Linux and ping_gateway is rejected elsewhere
+func defaultGateway() (string, error) {
+	return "", errors.New("ping_gateway is only supported on Linux")
+}
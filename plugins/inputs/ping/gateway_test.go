@@ -0,0 +1,90 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var routeTableOutput = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	000200C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth0	00000000	010200C0	0003	0	0	0	00000000	0	0	0
+`
+
+func TestParseDefaultGateway(t *testing.T) {
+	gateway, err := parseDefaultGateway(strings.NewReader(routeTableOutput))
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", gateway)
+
+	_, err = parseDefaultGateway(strings.NewReader(strings.SplitN(routeTableOutput, "\n", 3)[0]))
+	assert.Error(t, err)
+}
+
+func TestCheckPingGateway(t *testing.T) {
+	p := Ping{PingGateway: true}
+	require.NoError(t, p.checkPingGateway("linux"))
+	require.EqualError(t, p.checkPingGateway("darwin"), "ping_gateway is only supported on Linux")
+
+	p = Ping{}
+	require.NoError(t, p.checkPingGateway("darwin"))
+}
+
+func TestPingGatherGateway(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("ping_gateway is only supported on Linux")
+	}
+
+	for _, gatewayUp := range []bool{true, false} {
+		var acc testutil.Accumulator
+		p := Ping{
+			Urls:        []string{"www.google.com"},
+			PingGateway: true,
+			findGateway: func() (string, error) {
+				return "192.0.2.1", nil
+			},
+			pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+				if args[len(args)-1] == "192.0.2.1" && !gatewayUp {
+					return errorPingOutput, nil
+				}
+				return linuxPingOutput, nil
+			},
+		}
+		require.NoError(t, acc.GatherError(p.Gather))
+
+		gatewayTags := map[string]string{"url": "192.0.2.1"}
+		assert.True(t, acc.HasPoint("ping", gatewayTags, "result_code", 0))
+
+		tags := map[string]string{"url": "www.google.com", "gateway": "192.0.2.1"}
+		assert.True(t, acc.HasPoint("ping", tags, "gateway_reachable", gatewayUp))
+		assert.True(t, acc.HasPoint("ping", tags, "packets_received", 5))
+	}
+}
+
+func TestPingGatherGatewayNotFound(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("ping_gateway is only supported on Linux")
+	}
+
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:        []string{"www.google.com"},
+		PingGateway: true,
+		findGateway: func() (string, error) {
+			return "", errors.New("no default gateway in routing table")
+		},
+		pingHost: mockHostPinger,
+	}
+	acc.GatherError(p.Gather)
+
+	require.Len(t, acc.Errors, 1)
+	assert.EqualError(t, acc.Errors[0], "default gateway: no default gateway in routing table")
+	assert.True(t, acc.HasPoint("ping", map[string]string{"url": "www.google.com"}, "packets_received", 5))
+}
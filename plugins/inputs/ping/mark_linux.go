@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package ping
+
+import (
+	"syscall"
+)
+
+// markControl returns the control function of a dialer setting the firewall
+// mark of its sockets (SO_MARK), nil without a mark
+func markControl(mark int) func(network, address string, c syscall.RawConn) error {
+	if mark == 0 {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if ctrlErr := c.Control(func(fd uintptr) {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, mark)
+		}); ctrlErr != nil {
+			return ctrlErr
+		}
+		return err
+	}
+}
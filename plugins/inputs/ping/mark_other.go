@@ -0,0 +1,14 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package ping
+
+import (
+	"syscall"
+)
+
+// markControl returns nil, firewall marks only exist on Linux and
+// firewall_mark is ignored elsewhere
+func markControl(mark int) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
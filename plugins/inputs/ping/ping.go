@@ -1,3 +1,4 @@
+//go:build !windows
 // +build !windows
 
 package ping
@@ -5,10 +6,15 @@ package ping
 import (
 	"errors"
 	"fmt"
+	"log"
+	"math"
+	"math/rand"
 	"net"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,43 +26,6 @@ import (
 	"github.com/influxdata/telegraf/plugins/inputs"
 )
 
-// HostPinger is a function that runs the "ping" function using a list of
-// passed arguments. This can be easily switched with a mocked ping function
-// for unit test purposes (see ping_test.go)
-type HostPinger func(binary string, timeout float64, args ...string) (string, error)
-
-type Ping struct {
-	wg sync.WaitGroup
-
-	// Interval at which to ping (ping -i <INTERVAL>)
-	PingInterval float64 `toml:"ping_interval"`
-
-	// Number of pings to send (ping -c <COUNT>)
-	Count int
-
-	// Ping timeout, in seconds. 0 means no timeout (ping -W <TIMEOUT>)
-	Timeout float64
-
-	// Ping deadline, in seconds. 0 means no deadline. (ping -w <DEADLINE>)
-	Deadline int
-
-	// Interface or source address to send ping from (ping -I/-S <INTERFACE/SRC_ADDR>)
-	Interface string
-
-	// URLs to ping
-	Urls []string
-
-	// Ping executable binary
-	Binary string
-
-	// Arguments for ping command.
-	// when `Arguments` is not empty, other options (ping_interval, timeout, etc) will be ignored
-	Arguments []string
-
-	// host ping function
-	pingHost HostPinger
-}
-
 func (_ *Ping) Description() string {
 	return "Ping given url(s) and return statistics"
 }
@@ -72,22 +41,191 @@ const sampleConfig = `
   ## Not available in Windows.
   # ping_interval = 1.0
 
+  ## Smallest ping_interval, in s, accepted by ping. Unprivileged ping refuses
+  ## intervals below 0.2 s on most systems. A smaller ping_interval is either
+  ## raised to the minimum with a warning ("adjust") or rejected ("error").
+  ## Not used with method = "tcp".
+  # min_ping_interval = 0.2
+  # ping_interval_policy = "adjust"
+
+  ## Flood ping the urls for stress tests, sending count packets at up to
+  ## rapid_max_rate packets per second (ping -f -i <1/RAPID_MAX_RATE>).
+  ## ping_interval is ignored and count must be greater than 1. Requires root
+  ## or the CAP_NET_RAW capability, only available with method = "exec" and
+  ## not available on Windows.
+  # rapid = false
+  # rapid_max_rate = 100.0
+
+  ## TTL of the sent packets. 0 == default (ping -t <TTL>)
+  ## With a low TTL the address of the router dropping the packets is
+  ## reported in the hop_ip tag.
+  # ttl = 0
+
+  ## Firewall mark (SO_MARK) of the sent packets, to route them through a
+  ## specific routing table or VRF with policy routing (ping -m <MARK>,
+  ## fping -k <MARK>). Linux only, requires the CAP_NET_ADMIN capability and
+  ## is ignored with a warning on other systems. 0 == no mark
+  # firewall_mark = 0
+
+  ## Number of data bytes sent in each packet. 0 == 16 bytes, or the ping.exe
+  ## default of 32 bytes on Windows (ping -s <SIZE>, ping.exe -l <SIZE>)
+  # size = 0
+
   ## Per-ping timeout, in s. 0 == no timeout (ping -W <TIMEOUT>)
   # timeout = 1.0
 
-  ## Total-ping deadline, in s. 0 == no deadline (ping -w <DEADLINE>)
-  # deadline = 10
+  ## Total-ping deadline, as a duration like "500ms" or in s. 0 == no
+  ## deadline (ping -w <DEADLINE>). The ping command is killed once it is
+  ## reached. iputils ping on Linux takes fractions of a second, the BSD and
+  ## macOS pings only whole seconds and the deadline is rounded up for them.
+  ## Must be at least count * ping_interval.
+  # deadline = "10s"
 
   ## Interface or source address to send ping from (ping -I <INTERFACE/SRC_ADDR>)
   ## on Darwin and Freebsd only source address possible: (ping -S <SRC_ADDR>)
   # interface = ""
 
-  ## Specify the ping executable binary, default is "ping"
+  ## Interfaces or source addresses to spread the pings over, instead of
+  ## interface. With interface_mode "round-robin" every url is pinged from
+  ## one of them, the first url from the first interface and so on, with
+  ## "all" every url is pinged from each of them. Metrics are tagged with
+  ## source_interface. Only available with method = "exec".
+  # interfaces = []
+  # interface_mode = "round-robin"
+
+  ## Address family to ping with, "ipv4" or "ipv6" (ping -4/-6).
+  ## When an interface name is set it must have an address of this family.
+  # address_family = ""
+
+  ## Unit of the response time fields, either "ms" for the *_response_ms
+  ## fields or "s" for *_response_s fields in seconds.
+  # output_unit = "ms"
+
+  ## Round the minimum_response_ms, average_response_ms and
+  ## maximum_response_ms fields to integers, for destinations with a strict
+  ## schema storing them as integers. Cannot be combined with output_unit "s".
+  # integer_latency = false
+
+  ## Start the probes at a multiple of this duration of the wall clock, for
+  ## example "1s" for the top of the second or "1m" for the top of the minute,
+  ## so samples from different hosts are taken at the same time.
+  # probe_alignment = "0s"
+
+  ## Delay the ping of each url by a random duration up to start_jitter, to
+  ## spread the load of pinging many urls. The delay is reduced so that it
+  ## and the ping still end before the deadline. Not used with method = "fping".
+  # start_jitter = "0s"
+
+  ## Specify the ping executable binary, default is "ping". The binary is
+  ## looked up once, if it cannot be found the collection fails with a single
+  ## error and no url is pinged.
   # binary = "ping"
 
+  ## Time the ping command may run longer than expected from count, timeout
+  ## and ping_interval before it is killed, or longer than 60s when arguments
+  ## is set. Not available on Windows.
+  # command_timeout_slop = "5s"
+
+  ## Emit a ping_summary metric with the number of urls that succeeded and
+  ## failed in each collection
+  # emit_summary = false
+
+  ## Tag the metrics with target_type, "ip" for urls that are IP addresses
+  ## and "hostname" for urls resolved with DNS
+  # tag_target_type = false
+
+  ## Emit every field of the ping metric also when its value is not known,
+  ## like the response times of a url without replies, so that the metrics
+  ## map onto a fixed schema. Missing counts are 0, percent_packet_loss 100
+  ## and the TTLs and response times -1.
+  # always_emit_all_fields = false
+
+  ## Number of retries of a failed DNS lookup of a url, waiting 100ms before
+  ## the first retry and twice as long before each following one. Retries
+  ## stop early rather than exceed the deadline.
+  # dns_retries = 0
+
+  ## Number of retries of a ping of a url that failed with an error, like a
+  ## send failure, rather than with lost packets. Retries stop early rather
+  ## than exceed the deadline. Only used with method = "exec".
+  # gather_retries = 0
+
+  ## Report the urls whose DNS lookup failed for the same reason in a
+  ## collection, like an unreachable resolver, as a single error instead of
+  ## one error per url. Every url still has its result_code.
+  # group_dns_errors = false
+
+  ## Ping the IPv4 default gateway before the urls, the gateway is added as
+  ## the "gateway" tag and its reachability as the "gateway_reachable" field
+  ## of every url. Only available on Linux.
+  # ping_gateway = false
+
+  ## When a url loses packets, ping it again with rate_limit_probe_interval,
+  ## in s, between packets. If the slower probe loses at most half as many
+  ## packets the loss is attributed to ICMP rate limiting by the url and the
+  ## rate_limited field is set. Only available with method = "exec".
+  # detect_rate_limiting = false
+  # rate_limit_probe_interval = 1.0
+
+  ## Report urls that received at least one packet and lost at most this
+  ## percentage of packets with result_code = 0, even if ping failed because
+  ## of the loss. percent_packet_loss still reports the measured loss.
+  ## 0 == disabled.
+  # loss_threshold_percent = 0.0
+
+  ## Include the output of ping, truncated to 4096 bytes, in the error
+  ## reported when it cannot be parsed
+  # debug_output = false
+
+  ## Add a probe_seq field to every url, incremented by one in every
+  ## collection for the lifetime of the plugin. Gaps in the sequence reveal
+  ## collections that did not happen.
+  # emit_probe_seq = false
+
+  ## Parse every reply of ping for per-packet statistics: reordered_packets
+  ## counts the replies with a lower sequence number than an earlier reply.
+  ## Only available with method = "exec" and ping printing icmp_seq or seq.
+  ## Also add a ping_reply metric for every reply, with its seq, ttl and
+  ## response_ms. Duplicate replies are left out unless report_duplicates is
+  ## set, they then have the duplicate tag.
+  # per_packet = false
+  # report_duplicates = false
+
+  ## Add an average_response_ewma_ms field, the exponential moving average of
+  ## average_response_ms across collections, weighting the latest collection
+  ## with ema_alpha between 0 and 1. The average of a url starts over once it
+  ## did not respond in ema_reset_after collections in a row. 0 disables it.
+  # ema_alpha = 0.0
+  # ema_reset_after = 3
+
   ## Arguments for ping command
   ## when arguments is not empty, other options (ping_interval, timeout, etc) will be ignored
   # arguments = ["-c", "3"]
+
+  ## Method used to ping hosts:
+  ##   exec:  run one ping command per url
+  ##   fping: probe all urls at once with a single fping command (fping -C <COUNT> -q)
+  ##   tcp:   time TCP connections to the urls instead of ICMP echo requests
+  # method = "exec"
+
+  ## Specify the fping executable binary, used with method = "fping"
+  # fping_binary = "fping"
+
+  ## Port to connect to with method = "tcp", urls can also set their own port
+  ## as "host:port" or "[ipv6]:port"
+  # tcp_port = 80
+
+  ## Profiles replace count, ping_interval and size in some collections, the
+  ## urls are then tagged with the name of the profile.  In every collection
+  ## the first profile whose "every" divides the number of the collection is
+  ## used, or the options above if there is none.  Options of a profile left
+  ## at 0 keep their value above.
+  # [[inputs.ping.profile]]
+  #   name = "detailed"
+  #   every = 10
+  #   count = 20
+  #   ping_interval = 0.5
+  #   size = 56
 `
 
 func (_ *Ping) SampleConfig() string {
@@ -95,23 +233,379 @@ func (_ *Ping) SampleConfig() string {
 }
 
 func (p *Ping) Gather(acc telegraf.Accumulator) error {
-	// Spin off a go routine for each url to ping
-	for _, url := range p.Urls {
-		p.wg.Add(1)
-		go p.pingToURL(url, acc)
+	if !p.initialized {
+		p.initErr = p.initialize()
+		p.initialized = true
+	}
+	if p.initErr != nil {
+		return p.initErr
+	}
+
+	// Addresses can come and go, so the source address is checked on
+	// every gather rather than once
+	for _, iface := range append([]string{p.Interface}, p.Interfaces...) {
+		if src := net.ParseIP(iface); src != nil {
+			addrs, err := net.InterfaceAddrs()
+			if err != nil {
+				return err
+			}
+			if !hasAddress(addrs, src) {
+				return fmt.Errorf("source address %s is not assigned to any local interface", src)
+			}
+		}
+	}
+
+	if p.ProbeAlignment.Duration > 0 {
+		time.Sleep(alignDelay(time.Now(), p.ProbeAlignment.Duration))
+	}
+
+	if p.EmitProbeSeq {
+		acc = p.nextProbeSeq(acc)
 	}
 
-	p.wg.Wait()
+	// The moving average is of the actual response times, not of the
+	// sentinels added to the metric
+	if p.AlwaysEmitAllFields {
+		acc = &allFieldsAccumulator{Accumulator: acc, p: p}
+	}
+
+	if p.EMAAlpha > 0 {
+		acc = &emaAccumulator{Accumulator: acc, p: p}
+	}
+
+	if len(p.Profiles) > 0 {
+		var restore func()
+		acc, restore = p.useProfile(acc)
+		defer restore()
+	}
+
+	if p.Method == "" || p.Method == "exec" || p.PingGateway {
+		if err := p.resolveBinary(); err != nil {
+			return err
+		}
+	}
+
+	var dnsAcc *dnsErrorAccumulator
+	if p.GroupDNSErrors {
+		dnsAcc = newDNSErrorAccumulator(acc)
+		acc = dnsAcc
+	}
+
+	if p.PingGateway {
+		var err error
+		if acc, err = p.pingGateway(acc); err != nil {
+			acc.AddError(err)
+		}
+	}
+
+	var dnsFailures *dnsFailureAccumulator
+	if p.EmitSummary {
+		dnsFailures = &dnsFailureAccumulator{Accumulator: acc}
+		acc = dnsFailures
+	}
+
+	var results []map[string]interface{}
+	if p.Method == "fping" {
+		results = p.fping(acc)
+	} else {
+		pingToURL := p.pingToURL
+		if p.Method == "tcp" {
+			pingToURL = p.tcpPingToURL
+		}
+
+		maxJitter := p.maxStartJitter()
+
+		// Spin off a go routine for each url to ping
+		var mu sync.Mutex
+		for _, t := range p.targets() {
+			p.wg.Add(1)
+			go func(t target) {
+				defer p.wg.Done()
+				if maxJitter > 0 {
+					time.Sleep(time.Duration(rand.Int63n(int64(maxJitter))))
+				}
+				var fields map[string]interface{}
+				if t.iface == "" {
+					fields = pingToURL(t.url, acc)
+				} else {
+					fields = p.pingFromInterface(t.url, t.iface, acc)
+				}
+				mu.Lock()
+				results = append(results, fields)
+				mu.Unlock()
+			}(t)
+		}
+
+		p.wg.Wait()
+	}
+
+	if dnsAcc != nil {
+		dnsAcc.flush()
+	}
+
+	if p.EmitSummary {
+		acc.AddFields("ping_summary", summarize(results, dnsFailures.count()), nil)
+	}
 
 	return nil
 }
 
-func (p *Ping) pingToURL(u string, acc telegraf.Accumulator) {
-	defer p.wg.Done()
+// seqAccumulator adds the probe sequence number of the url to every ping
+// metric
+type seqAccumulator struct {
+	telegraf.Accumulator
+	seq map[string]int64
+}
+
+func (a *seqAccumulator) AddFields(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	if seq, ok := a.seq[tags["url"]]; ok && measurement == "ping" {
+		fields["probe_seq"] = seq
+	}
+	a.Accumulator.AddFields(measurement, fields, tags, t...)
+}
+
+// nextProbeSeq increments the probe sequence number of every url and returns
+// an accumulator adding it to their metrics
+func (p *Ping) nextProbeSeq(acc telegraf.Accumulator) telegraf.Accumulator {
+	if p.probeSeq == nil {
+		p.probeSeq = make(map[string]int64, len(p.Urls))
+	}
+
+	seq := make(map[string]int64, len(p.Urls))
+	for _, url := range p.Urls {
+		p.probeSeq[url]++
+		seq[url] = p.probeSeq[url]
+	}
+	return &seqAccumulator{Accumulator: acc, seq: seq}
+}
+
+// dnsFailureAccumulator counts the urls whose DNS lookup failed, from the
+// lookup error reported for every one of them
+type dnsFailureAccumulator struct {
+	telegraf.Accumulator
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (a *dnsFailureAccumulator) AddError(err error) {
+	if _, ok := err.(*dnsError); ok {
+		a.mu.Lock()
+		a.failures++
+		a.mu.Unlock()
+	}
+	a.Accumulator.AddError(err)
+}
+
+func (a *dnsFailureAccumulator) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.failures
+}
+
+// summarize returns the fields of the ping_summary metric from the fields of
+// every url pinged in a gather and the number of urls whose DNS lookup
+// failed. A url failed if it could not be pinged or if none of its packets
+// were received, urls that were resolved but did not answer are not DNS
+// failures. The DNS lookup of every url failing is reported as a DNS outage.
+func summarize(results []map[string]interface{}, dnsFailures int) map[string]interface{} {
+	var successful, failed int
+	for _, fields := range results {
+		if reachable(fields) {
+			successful++
+		} else {
+			failed++
+		}
+	}
+
+	return map[string]interface{}{
+		"total":        len(results),
+		"successful":   successful,
+		"failed":       failed,
+		"dns_failures": dnsFailures,
+		"dns_outage":   len(results) > 0 && dnsFailures == len(results),
+	}
+}
+
+// dnsRetryBackoff is the wait before the first retry of a failed DNS lookup,
+// it doubles with every retry
+const dnsRetryBackoff = 100 * time.Millisecond
+
+// lookupHost resolves host to its addresses, retrying up to dns_retries times
+// as long as the retries end before the deadline. With retries enabled the
+// number of attempts is added to fields as dns_attempts.
+func (p *Ping) lookupHost(host string, fields map[string]interface{}) ([]string, error) {
+	resolve := p.resolve
+	if resolve == nil {
+		resolve = net.LookupHost
+	}
+
+	// A scoped address is only valid with its zone, which DNS knows nothing
+	// about, it is pinged as it is
+	if ip, zone := splitZone(host); zone != "" && net.ParseIP(ip) != nil {
+		return []string{host}, nil
+	}
+
+	start := time.Now()
+	backoff := dnsRetryBackoff
+	attempts := 0
+	var addrs []string
+	var err error
+	for {
+		attempts++
+		if addrs, err = resolve(host); err == nil || attempts > p.DNSRetries {
+			break
+		}
+		if p.Deadline.Duration > 0 && time.Since(start)+backoff > p.Deadline.Duration {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	if p.DNSRetries > 0 {
+		fields["dns_attempts"] = attempts
+	}
+	if err != nil {
+		return nil, &dnsError{host: host, err: err}
+	}
+	return addrs, nil
+}
+
+// runPing runs ping, retrying up to gather_retries times a ping failing with
+// an error other than exit status 1, which ping returns on packet loss, as
+// long as the retry is expected to end before the deadline. It returns the
+// output, start time and error of the last attempt. With retries enabled the
+// number of attempts is added to fields as ping_attempts.
+func (p *Ping) runPing(binary string, args []string, totalTimeout float64, fields map[string]interface{}) (string, time.Time, error) {
+	first := time.Now()
+	attempts := 0
+	var out string
+	var err error
+	var start time.Time
+	for {
+		attempts++
+		start = time.Now()
+		out, err = p.pingHost(binary, p.commandTimeout(totalTimeout), args...)
+		if err == nil || exitStatus(err) == 1 || attempts > p.GatherRetries {
+			break
+		}
+		budget := time.Duration(totalTimeout * float64(time.Second))
+		if p.Deadline.Duration > 0 && time.Since(first)+budget > p.Deadline.Duration {
+			break
+		}
+	}
+
+	if p.GatherRetries > 0 {
+		fields["ping_attempts"] = attempts
+	}
+	return out, start, err
+}
+
+// exitStatus returns the exit status of a ping command that failed with err,
+// or -1 if it did not exit
+func exitStatus(err error) int {
+	if exitError, ok := err.(*exec.ExitError); ok {
+		if ws, ok := exitError.Sys().(syscall.WaitStatus); ok {
+			return ws.ExitStatus()
+		}
+	}
+	return -1
+}
+
+// urlTags returns the tags of the metric of a url
+func (p *Ping) urlTags(u string) map[string]string {
 	tags := map[string]string{"url": u}
-	fields := map[string]interface{}{"result_code": 0}
+	if p.TagTargetType {
+		tags["target_type"] = targetType(u)
+	}
+	return tags
+}
+
+// targetType returns "ip" if the host of a url is an IP address and
+// "hostname" otherwise
+func targetType(u string) string {
+	host, _, err := splitHostPort(u)
+	if err != nil {
+		host = u
+	}
+	if ip, _ := splitZone(host); net.ParseIP(ip) != nil {
+		return "ip"
+	}
+	return "hostname"
+}
+
+// splitZone splits the zone from a scoped IPv6 address, like fe80::1%eth0 of
+// a link-local address, the zone is empty if the address has none
+func splitZone(host string) (string, string) {
+	if i := strings.LastIndex(host, "%"); i >= 0 && strings.Contains(host[:i], ":") {
+		return host[:i], host[i+1:]
+	}
+	return host, ""
+}
+
+// ipv6Only returns true if addrs are all IPv6 addresses
+func ipv6Only(addrs []string) bool {
+	for _, addr := range addrs {
+		addr, _ = splitZone(addr)
+		ip := net.ParseIP(addr)
+		if ip == nil || ip.To4() != nil {
+			return false
+		}
+	}
+	return len(addrs) > 0
+}
+
+// ipv6Command returns the binary and the arguments pinging over IPv6 from
+// those built for the default address family: ping -6 on Linux, and ping6
+// instead of ping on the other systems, whose ping only supports IPv4
+func ipv6Command(binary string, args []string, system string) (string, []string) {
+	if system == "linux" {
+		url := args[len(args)-1]
+		return binary, append(args[:len(args)-1:len(args)-1], "-6", url)
+	}
+	if filepath.Base(binary) == "ping" {
+		binary = filepath.Join(filepath.Dir(binary), "ping6")
+	}
+	return binary, args
+}
+
+// reachable returns true if a url was pinged and at least one of its packets
+// was received
+func reachable(fields map[string]interface{}) bool {
+	received, ok := fields["packets_received"].(int)
+	return ok && received > 0 && fields["result_code"] == 0
+}
+
+// pingToURL pings a single url and adds its metric, the added fields are also
+// returned.
+func (p *Ping) pingToURL(u string, acc telegraf.Accumulator) map[string]interface{} {
+	return p.pingFromInterface(u, p.Interface, acc)
+}
+
+// pingFromInterface pings a single url from iface, an interface or source
+// address, as pingToURL. The metric is tagged with source_interface when
+// interfaces is set.
+func (p *Ping) pingFromInterface(u, iface string, acc telegraf.Accumulator) (fields map[string]interface{}) {
+	tags := p.urlTags(u)
+	if len(p.Interfaces) > 0 {
+		tags["source_interface"] = iface
+	}
+	fields = map[string]interface{}{"result_code": 0}
+
+	if err := checkNoPort(u); err != nil {
+		acc.AddError(err)
+		fields["result_code"] = 2
+		acc.AddFields("ping", fields, tags)
+		return
+	}
 
-	_, err := net.LookupHost(u)
+	addrs, err := p.lookupHost(u, fields)
 	if err != nil {
 		acc.AddError(err)
 		fields["result_code"] = 1
@@ -119,23 +613,34 @@ func (p *Ping) pingToURL(u string, acc telegraf.Accumulator) {
 		return
 	}
 
-	args := p.args(u, runtime.GOOS)
+	binary, args := p.binary(), p.interfaceArgs(u, runtime.GOOS, iface)
 	totalTimeout := 60.0
 	if len(p.Arguments) == 0 {
 		totalTimeout = float64(p.Count)*p.Timeout + float64(p.Count-1)*p.PingInterval
+
+		// ping picks IPv4 by default and fails for a host without IPv4
+		// addresses, as on IPv6-only networks
+		if ipv6Only(addrs) {
+			switch p.AddressFamily {
+			case "":
+				binary, args = ipv6Command(binary, args, runtime.GOOS)
+			case "ipv4":
+				acc.AddError(fmt.Errorf("host %s: only has IPv6 addresses, which address_family \"ipv4\" cannot ping", u))
+				fields["result_code"] = 2
+				acc.AddFields("ping", fields, tags)
+				return
+			}
+		}
 	}
 
-	out, err := p.pingHost(p.Binary, totalTimeout, args...)
+	out, start, err := p.runPing(binary, args, totalTimeout, fields)
 	if err != nil {
 		// Some implementations of ping return a 1 exit code on
 		// timeout, if this occurs we will not exit and try to parse
 		// the output.
-		status := -1
-		if exitError, ok := err.(*exec.ExitError); ok {
-			if ws, ok := exitError.Sys().(syscall.WaitStatus); ok {
-				status = ws.ExitStatus()
-				fields["result_code"] = status
-			}
+		status := exitStatus(err)
+		if status >= 0 {
+			fields["result_code"] = status
 		}
 
 		if status != 1 {
@@ -155,7 +660,11 @@ func (p *Ping) pingToURL(u string, acc telegraf.Accumulator) {
 	trans, rec, ttl, min, avg, max, stddev, err := processPingOutput(out)
 	if err != nil {
 		// fatal error
-		acc.AddError(fmt.Errorf("%s: %s", err, u))
+		if p.DebugOutput {
+			acc.AddError(fmt.Errorf("%s: %s, output: %q", err, u, truncateOutput(out)))
+		} else {
+			acc.AddError(fmt.Errorf("%s: %s", err, u))
+		}
 		fields["result_code"] = 2
 		acc.AddFields("ping", fields, tags)
 		return
@@ -168,40 +677,519 @@ func (p *Ping) pingToURL(u string, acc telegraf.Accumulator) {
 	if ttl >= 0 {
 		fields["ttl"] = ttl
 	}
+	if ttls := getTTLs(out); len(ttls) > 0 {
+		fields["ttl_min"] = ttls[0]
+		fields["ttl_max"] = ttls[len(ttls)-1]
+		if len(ttls) > 1 {
+			fields["ttls"] = formatTTLs(ttls)
+		}
+	}
+	if hop := getHopIP(out); hop != "" {
+		tags["hop_ip"] = hop
+	}
+	if src := getSourceIP(out); src != "" {
+		tags["source_ip"] = src
+	}
+	if p.PerPacket {
+		if reordered, ok := getReordered(out); ok {
+			fields["reordered_packets"] = reordered
+		}
+		p.addReplies(acc, tags, getReplies(out), start)
+	}
+	if p.DetectRateLimiting && len(p.Arguments) == 0 {
+		fields["rate_limited"] = false
+		if loss > 0 && loss < 100 {
+			slowLoss, err := p.slowProbeLoss(u, iface)
+			if err != nil {
+				acc.AddError(fmt.Errorf("host %s: rate limit probe: %s", u, err))
+			} else {
+				fields["rate_limited"] = rateLimited(loss, slowLoss)
+			}
+		}
+	}
+	p.applyLossThreshold(fields, rec, loss)
+	p.addResponseFields(fields, min, avg, max, stddev)
+	acc.AddFields("ping", fields, tags)
+	return
+}
+
+// applyLossThreshold sets the result_code of a url that received at least one
+// packet to 0 if its packet loss is at or below loss_threshold_percent, ping
+// exits with an error on partial loss
+func (p *Ping) applyLossThreshold(fields map[string]interface{}, received int, loss float64) {
+	if p.LossThresholdPercent > 0 && received > 0 && loss <= p.LossThresholdPercent {
+		fields["result_code"] = 0
+	}
+}
+
+// maxDebugOutput is the number of bytes of ping output included in an error
+// with debug_output
+const maxDebugOutput = 4096
+
+// truncateOutput shortens the output of ping to maxDebugOutput bytes
+func truncateOutput(out string) string {
+	if len(out) <= maxDebugOutput {
+		return out
+	}
+	return out[:maxDebugOutput] + "... (truncated)"
+}
+
+// addResponseFields adds the response time statistics, parsed in ms, to
+// fields using the configured output unit. Negative values are not available
+// and are skipped. With integer_latency the minimum, average and maximum are
+// rounded to integers.
+func (p *Ping) addResponseFields(fields map[string]interface{}, min, avg, max, stddev float64) {
+	suffix, scale := "_ms", 1.0
+	if p.OutputUnit == "s" {
+		suffix, scale = "_s", 0.001
+	}
+	latency := func(v float64) interface{} {
+		if p.IntegerLatency {
+			return int64(math.Round(v * scale))
+		}
+		return v * scale
+	}
+
 	if min >= 0 {
-		fields["minimum_response_ms"] = min
+		fields["minimum_response"+suffix] = latency(min)
 	}
 	if avg >= 0 {
-		fields["average_response_ms"] = avg
+		fields["average_response"+suffix] = latency(avg)
 	}
 	if max >= 0 {
-		fields["maximum_response_ms"] = max
+		fields["maximum_response"+suffix] = latency(max)
 	}
 	if stddev >= 0 {
-		fields["standard_deviation_ms"] = stddev
+		fields["standard_deviation"+suffix] = stddev * scale
 	}
-	acc.AddFields("ping", fields, tags)
 }
 
-func hostPinger(binary string, timeout float64, args ...string) (string, error) {
-	bin, err := exec.LookPath(binary)
+// splitHostPort splits a url into its host and port, the port is 0 if the url
+// has none. IPv6 addresses with a port use the bracket syntax, like [::1]:443.
+func splitHostPort(u string) (string, int, error) {
+	if strings.HasPrefix(u, "[") && strings.HasSuffix(u, "]") {
+		return u[1 : len(u)-1], 0, nil
+	}
+	// A plain IPv6 address has several colons and no brackets
+	if !strings.HasPrefix(u, "[") && strings.Count(u, ":") != 1 {
+		return u, 0, nil
+	}
+
+	host, port, err := net.SplitHostPort(u)
 	if err != nil {
-		return "", err
+		return "", 0, err
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return "", 0, fmt.Errorf("invalid port %q", port)
+	}
+	return host, n, nil
+}
+
+// checkNoPort returns an error if the url has a port, which only the tcp
+// method supports
+func checkNoPort(u string) error {
+	if _, port, err := splitHostPort(u); err == nil && port != 0 {
+		return fmt.Errorf("host %s: a port is only supported with method = \"tcp\"", u)
+	}
+	return nil
+}
+
+// initialize validates the configuration once, before the first ping
+func (p *Ping) initialize() error {
+	switch p.Method {
+	case "", "exec", "fping", "tcp":
+	default:
+		return fmt.Errorf("invalid method %q, must be \"exec\", \"fping\" or \"tcp\"", p.Method)
+	}
+
+	switch p.AddressFamily {
+	case "", "ipv4", "ipv6":
+	default:
+		return fmt.Errorf("invalid address_family %q, must be \"ipv4\" or \"ipv6\"", p.AddressFamily)
+	}
+
+	switch p.OutputUnit {
+	case "", "ms", "s":
+	default:
+		return fmt.Errorf("invalid output_unit %q, must be \"ms\" or \"s\"", p.OutputUnit)
+	}
+	if p.IntegerLatency && p.OutputUnit == "s" {
+		return fmt.Errorf("integer_latency cannot be combined with output_unit = \"s\"")
+	}
+
+	if err := p.checkRapid(); err != nil {
+		return err
+	}
+
+	if err := p.checkFirewallMark(runtime.GOOS); err != nil {
+		return err
 	}
-	c := exec.Command(bin, args...)
+
+	if err := p.checkPingGateway(runtime.GOOS); err != nil {
+		return err
+	}
+
+	if err := p.checkProfiles(); err != nil {
+		return err
+	}
+
+	if err := p.checkEMA(); err != nil {
+		return err
+	}
+
+	if err := p.checkPingInterval(); err != nil {
+		return err
+	}
+
+	if err := p.checkDeadline(); err != nil {
+		return err
+	}
+
+	if p.CommandTimeoutSlop.Duration < 0 {
+		return fmt.Errorf("invalid command_timeout_slop %s, must not be negative", p.CommandTimeoutSlop.Duration)
+	}
+
+	if p.LossThresholdPercent < 0 || p.LossThresholdPercent > 100 {
+		return fmt.Errorf("invalid loss_threshold_percent %v, must be between 0 and 100", p.LossThresholdPercent)
+	}
+
+	if p.DetectRateLimiting && p.RateLimitProbeInterval <= p.PingInterval {
+		return fmt.Errorf("rate_limit_probe_interval %v must be greater than ping_interval %v",
+			p.RateLimitProbeInterval, p.PingInterval)
+	}
+
+	if err := p.checkInterfaces(); err != nil {
+		return err
+	}
+
+	// The interface option can also be a source address, only validate
+	// actual interface names
+	for _, name := range append([]string{p.Interface}, p.Interfaces...) {
+		if p.AddressFamily == "" || name == "" || net.ParseIP(name) != nil {
+			continue
+		}
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return fmt.Errorf("interface %s: %s", name, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return fmt.Errorf("interface %s: %s", name, err)
+		}
+		if err := checkAddressFamily(name, addrs, p.AddressFamily); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkInterfaces validates the interfaces and interface_mode options
+func (p *Ping) checkInterfaces() error {
+	switch p.InterfaceMode {
+	case "", "round-robin", "all":
+	default:
+		return fmt.Errorf("invalid interface_mode %q, must be \"round-robin\" or \"all\"", p.InterfaceMode)
+	}
+
+	if len(p.Interfaces) == 0 {
+		return nil
+	}
+	if p.Interface != "" {
+		return fmt.Errorf("interface and interfaces cannot both be set")
+	}
+	if p.Method != "" && p.Method != "exec" {
+		return fmt.Errorf("interfaces is only supported with method = \"exec\"")
+	}
+	if len(p.Arguments) > 0 {
+		return fmt.Errorf("interfaces cannot be combined with arguments")
+	}
+	for _, iface := range p.Interfaces {
+		if iface == "" {
+			return fmt.Errorf("interfaces must not contain an empty interface")
+		}
+	}
+	return nil
+}
+
+// target is a url and the interface to ping it from, empty for interface
+type target struct {
+	url   string
+	iface string
+}
+
+// targets returns the urls to ping and the interfaces to ping them from
+func (p *Ping) targets() []target {
+	if len(p.Interfaces) == 0 {
+		targets := make([]target, 0, len(p.Urls))
+		for _, url := range p.Urls {
+			targets = append(targets, target{url: url})
+		}
+		return targets
+	}
+
+	if p.InterfaceMode == "all" {
+		targets := make([]target, 0, len(p.Urls)*len(p.Interfaces))
+		for _, url := range p.Urls {
+			for _, iface := range p.Interfaces {
+				targets = append(targets, target{url: url, iface: iface})
+			}
+		}
+		return targets
+	}
+
+	targets := make([]target, 0, len(p.Urls))
+	for i, url := range p.Urls {
+		targets = append(targets, target{url: url, iface: p.Interfaces[i%len(p.Interfaces)]})
+	}
+	return targets
+}
+
+// checkRapid validates the rapid options and replaces the ping interval by
+// the one of rapid_max_rate
+func (p *Ping) checkRapid() error {
+	if !p.Rapid {
+		return nil
+	}
+
+	if p.Method != "" && p.Method != "exec" {
+		return fmt.Errorf("rapid is only supported with method = \"exec\"")
+	}
+	if p.Count <= 1 {
+		return fmt.Errorf("rapid requires count to be greater than 1")
+	}
+	if p.RapidMaxRate <= 0 {
+		return fmt.Errorf("invalid rapid_max_rate %v, must be greater than 0", p.RapidMaxRate)
+	}
+
+	p.PingInterval = 1 / p.RapidMaxRate
+	log.Printf("W! [inputs.ping] rapid is enabled, flooding every url with %d packets at up to %v packets per second, "+
+		"ping requires root or the CAP_NET_RAW capability for this", p.Count, p.RapidMaxRate)
+	return nil
+}
+
+// checkFirewallMark validates firewall_mark, and ignores it on systems
+// without firewall marks
+func (p *Ping) checkFirewallMark(system string) error {
+	if p.FirewallMark < 0 || int64(p.FirewallMark) > math.MaxUint32 {
+		return fmt.Errorf("invalid firewall_mark %d, must be between 0 and %d", p.FirewallMark, uint32(math.MaxUint32))
+	}
+	if p.FirewallMark != 0 && system != "linux" {
+		log.Printf("W! [inputs.ping] firewall_mark is only supported on Linux, ignoring it")
+		p.FirewallMark = 0
+	}
+	return nil
+}
+
+// checkPingInterval applies the ping interval policy to a ping_interval below
+// min_ping_interval, which ping would otherwise reject or ignore. The interval
+// of rapid is not limited, it needs privileges anyway.
+func (p *Ping) checkPingInterval() error {
+	if p.Method == "tcp" || p.Rapid || p.PingInterval <= 0 || p.PingInterval >= p.MinPingInterval {
+		return nil
+	}
+
+	switch p.PingIntervalPolicy {
+	case "", "adjust":
+		log.Printf("W! [inputs.ping] ping_interval %v is below min_ping_interval %v, using %v",
+			p.PingInterval, p.MinPingInterval, p.MinPingInterval)
+		p.PingInterval = p.MinPingInterval
+		return nil
+	case "error":
+		return fmt.Errorf("ping_interval %v is below min_ping_interval %v", p.PingInterval, p.MinPingInterval)
+	default:
+		return fmt.Errorf("invalid ping_interval_policy %q, must be \"adjust\" or \"error\"", p.PingIntervalPolicy)
+	}
+}
+
+// checkDeadline returns an error if the deadline ends before count packets
+// can be sent ping_interval apart, with the options of the plugin or of a
+// profile, which would always cut the ping short
+func (p *Ping) checkDeadline() error {
+	if p.Deadline.Duration <= 0 || len(p.Arguments) > 0 {
+		return nil
+	}
+
+	check := func(count int, interval float64) error {
+		minimum := time.Duration(float64(count) * interval * float64(time.Second))
+		if p.Deadline.Duration < minimum {
+			return fmt.Errorf("deadline %s is shorter than count %d * ping_interval %v", p.Deadline.Duration, count, interval)
+		}
+		return nil
+	}
+	if err := check(p.Count, p.PingInterval); err != nil {
+		return err
+	}
+	for _, prof := range p.Profiles {
+		count, interval := p.Count, p.PingInterval
+		if prof.Count > 0 {
+			count = prof.Count
+		}
+		if prof.PingInterval > 0 {
+			interval = prof.PingInterval
+		}
+		if err := check(count, interval); err != nil {
+			return fmt.Errorf("profile %q: %s", prof.Name, err)
+		}
+	}
+	return nil
+}
+
+// deadlineArg returns the deadline passed to ping, iputils ping on Linux
+// takes fractions of a second while the BSD pings only take whole seconds, the
+// deadline is then rounded up
+func (p *Ping) deadlineArg(system string) string {
+	if system == "linux" {
+		return strconv.FormatFloat(p.Deadline.Duration.Seconds(), 'f', -1, 64)
+	}
+	return strconv.FormatInt(int64(math.Ceil(p.Deadline.Duration.Seconds())), 10)
+}
+
+// checkAddressFamily returns an error if none of the addresses of an interface
+// belong to the address family
+func checkAddressFamily(iface string, addrs []net.Addr, family string) error {
+	for _, addr := range addrs {
+		var ip net.IP
+		switch a := addr.(type) {
+		case *net.IPNet:
+			ip = a.IP
+		case *net.IPAddr:
+			ip = a.IP
+		}
+		if ip == nil {
+			continue
+		}
+		if isIPv4 := ip.To4() != nil; isIPv4 == (family == "ipv4") {
+			return nil
+		}
+	}
+	return fmt.Errorf("interface %s has no %s address, check the interface and address_family options", iface, family)
+}
+
+// alignDelay returns how long to wait from now until the next multiple of
+// boundary of the wall clock
+func alignDelay(now time.Time, boundary time.Duration) time.Duration {
+	elapsed := now.Sub(now.Truncate(boundary))
+	if elapsed == 0 {
+		return 0
+	}
+	return boundary - elapsed
+}
+
+// maxStartJitter returns the largest delay before pinging a url, start_jitter
+// reduced so that the delay and the longest possible ping end before the
+// deadline
+func (p *Ping) maxStartJitter() time.Duration {
+	jitter := p.StartJitter.Duration
+	if jitter <= 0 || p.Deadline.Duration <= 0 {
+		return jitter
+	}
+
+	probe := float64(p.Count)*p.Timeout + float64(p.Count-1)*p.PingInterval
+	left := p.Deadline.Duration - time.Duration(probe*float64(time.Second))
+	if left < jitter {
+		jitter = left
+	}
+	if jitter < 0 {
+		return 0
+	}
+	return jitter
+}
+
+// hasAddress returns true if ip is one of addrs
+func hasAddress(addrs []net.Addr, ip net.IP) bool {
+	for _, addr := range addrs {
+		switch a := addr.(type) {
+		case *net.IPNet:
+			if a.IP.Equal(ip) {
+				return true
+			}
+		case *net.IPAddr:
+			if a.IP.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveBinary looks up the path of the ping binary once, and again only
+// when the binary option changes, so that a missing binary fails the gather
+// with a single error instead of one error per url
+func (p *Ping) resolveBinary() error {
+	if p.lookPath == nil || (p.binaryPath != "" && p.binaryName == p.Binary) {
+		return nil
+	}
+
+	path, err := p.lookPath(p.Binary)
+	if err != nil {
+		return fmt.Errorf("ping binary %q not found, check the binary option: %s", p.Binary, err)
+	}
+	p.binaryPath, p.binaryName = path, p.Binary
+	return nil
+}
+
+// binary returns the resolved path of the ping binary, or the binary option
+// if it has not been resolved
+func (p *Ping) binary() string {
+	if p.binaryPath != "" && p.binaryName == p.Binary {
+		return p.binaryPath
+	}
+	return p.Binary
+}
+
+func hostPinger(binary string, timeout float64, args ...string) (string, error) {
+	c := exec.Command(binary, args...)
 	out, err := internal.CombinedOutputTimeout(c,
-		time.Second*time.Duration(timeout+5))
+		time.Duration(timeout*float64(time.Second)))
 	return string(out), err
 }
 
+// commandTimeout returns the time, in seconds, after which a ping command
+// expected to end within timeout seconds is killed. The deadline bounds the
+// whole run of the command, unless ping is run with custom arguments which
+// the deadline is not passed in.
+func (p *Ping) commandTimeout(timeout float64) float64 {
+	timeout += p.CommandTimeoutSlop.Duration.Seconds()
+	deadline := p.Deadline.Duration.Seconds()
+	if deadline > 0 && timeout > deadline && len(p.Arguments) == 0 {
+		return deadline
+	}
+	return timeout
+}
+
 // args returns the arguments for the 'ping' executable
 func (p *Ping) args(url string, system string) []string {
+	return p.interfaceArgs(url, system, p.Interface)
+}
+
+// interfaceArgs returns the ping arguments of url as args, sending the pings
+// from iface instead of interface
+func (p *Ping) interfaceArgs(url string, system string, iface string) []string {
 	if len(p.Arguments) > 0 {
 		return append(p.Arguments, url)
 	}
 
 	// build the ping command args based on toml config
-	args := []string{"-c", strconv.Itoa(p.Count), "-n", "-s", "16"}
+	size := 16
+	if p.Size > 0 {
+		size = p.Size
+	}
+	args := []string{"-c", strconv.Itoa(p.Count), "-n", "-s", strconv.Itoa(size)}
+	if system == "linux" {
+		switch p.AddressFamily {
+		case "ipv4":
+			args = append(args, "-4")
+		case "ipv6":
+			args = append(args, "-6")
+		}
+	}
+	if p.Rapid {
+		switch system {
+		case "linux", "darwin", "freebsd", "netbsd", "openbsd":
+			args = append(args, "-f")
+		}
+	}
 	if p.PingInterval > 0 {
 		args = append(args, "-i", strconv.FormatFloat(p.PingInterval, 'f', -1, 64))
 	}
@@ -218,28 +1206,42 @@ func (p *Ping) args(url string, system string) []string {
 			args = append(args, "-W", strconv.FormatFloat(p.Timeout, 'f', -1, 64))
 		}
 	}
-	if p.Deadline > 0 {
+	if p.Deadline.Duration > 0 {
+		deadline := p.deadlineArg(system)
 		switch system {
 		case "darwin", "freebsd", "netbsd", "openbsd":
-			args = append(args, "-t", strconv.Itoa(p.Deadline))
+			args = append(args, "-t", deadline)
 		case "linux":
-			args = append(args, "-w", strconv.Itoa(p.Deadline))
+			args = append(args, "-w", deadline)
 		default:
 			// not sure the best option here, just assume gnu ping?
-			args = append(args, "-w", strconv.Itoa(p.Deadline))
+			args = append(args, "-w", deadline)
 		}
 	}
-	if p.Interface != "" {
+	if p.TTL > 0 {
+		switch system {
+		case "darwin", "freebsd":
+			args = append(args, "-m", strconv.Itoa(p.TTL))
+		case "netbsd":
+			args = append(args, "-T", strconv.Itoa(p.TTL))
+		default:
+			args = append(args, "-t", strconv.Itoa(p.TTL))
+		}
+	}
+	if p.FirewallMark > 0 && system == "linux" {
+		args = append(args, "-m", strconv.Itoa(p.FirewallMark))
+	}
+	if iface != "" {
 		switch system {
 		case "darwin":
-			args = append(args, "-I", p.Interface)
+			args = append(args, "-I", iface)
 		case "freebsd", "netbsd", "openbsd":
-			args = append(args, "-s", p.Interface)
+			args = append(args, "-s", iface)
 		case "linux":
-			args = append(args, "-I", p.Interface)
+			args = append(args, "-I", iface)
 		default:
 			// not sure the best option here, just assume gnu ping?
-			args = append(args, "-i", p.Interface)
+			args = append(args, "-i", iface)
 		}
 	}
 	args = append(args, url)
@@ -248,22 +1250,26 @@ func (p *Ping) args(url string, system string) []string {
 
 // processPingOutput takes in a string output from the ping command, like:
 //
-//     ping www.google.com (173.194.115.84): 56 data bytes
-//     64 bytes from 173.194.115.84: icmp_seq=0 ttl=54 time=52.172 ms
-//     64 bytes from 173.194.115.84: icmp_seq=1 ttl=54 time=34.843 ms
+//	ping www.google.com (173.194.115.84): 56 data bytes
+//	64 bytes from 173.194.115.84: icmp_seq=0 ttl=54 time=52.172 ms
+//	64 bytes from 173.194.115.84: icmp_seq=1 ttl=54 time=34.843 ms
 //
-//     --- www.google.com ping statistics ---
-//     2 packets transmitted, 2 packets received, 0.0% packet loss
-//     round-trip min/avg/max/stddev = 34.843/43.508/52.172/8.664 ms
+//	--- www.google.com ping statistics ---
+//	2 packets transmitted, 2 packets received, 0.0% packet loss
+//	round-trip min/avg/max/stddev = 34.843/43.508/52.172/8.664 ms
 //
 // It returns (<transmitted packets>, <received packets>, <average response>)
 func processPingOutput(out string) (int, int, int, float64, float64, float64, float64, error) {
 	var trans, recv, ttl int = 0, 0, -1
 	var min, avg, max, stddev float64 = -1.0, -1.0, -1.0, -1.0
 	// Set this error to nil if we find a 'transmitted' line
+	var rtts []float64
 	err := errors.New("Fatal error processing ping output")
 	lines := strings.Split(out, "\n")
 	for _, line := range lines {
+		if rtt, ok := getRTT(line); ok {
+			rtts = append(rtts, rtt)
+		}
 		// Reading only first TTL, ignoring other TTL messages
 		if ttl == -1 && strings.Contains(line, "ttl=") {
 			ttl, err = getTTL(line)
@@ -280,18 +1286,34 @@ func processPingOutput(out string) (int, int, int, float64, float64, float64, fl
 			}
 		}
 	}
+	// Some ping implementations, like busybox, do not print the standard
+	// deviation, compute it from the reply times instead
+	if stddev < 0 && len(rtts) > 1 {
+		_, _, _, stddev = rttStats(rtts)
+	}
 	return trans, recv, ttl, min, avg, max, stddev, err
 }
 
+// packetStatsLine matches the transmitted and received counts of the summary
+// line, the first count and the count following it after a comma, so that
+// the words around them may vary, as in
+//
+//	5 packets transmitted, 5 packets received, +2 duplicates, 0.0% packet loss
+//	5 packets transmitted, 3 received, +2 errors, 40% packet loss, time 4010ms
+var packetStatsLine = regexp.MustCompile(`(\d+)[^\d,]*,\s*(\d+)`)
+
 func getPacketStats(line string, trans, recv int) (int, int, error) {
-	stats := strings.Split(line, ", ")
+	match := packetStatsLine.FindStringSubmatch(line)
+	if match == nil {
+		return trans, recv, fmt.Errorf("unable to parse packet statistics %q", strings.TrimSpace(line))
+	}
 	// Transmitted packets
-	trans, err := strconv.Atoi(strings.Split(stats[0], " ")[0])
+	trans, err := strconv.Atoi(match[1])
 	if err != nil {
 		return trans, recv, err
 	}
 	// Received packets
-	recv, err = strconv.Atoi(strings.Split(stats[1], " ")[0])
+	recv, err = strconv.Atoi(match[2])
 	return trans, recv, err
 }
 
@@ -301,6 +1323,219 @@ func getTTL(line string) (int, error) {
 	return strconv.Atoi(ttlMatch[1])
 }
 
+// getTTLs returns the sorted distinct TTLs of all reply lines, a TTL changing
+// between replies hints at a route change or at replies taking several paths
+func getTTLs(out string) []int {
+	seen := make(map[int]bool)
+	var ttls []int
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.Contains(line, "ttl=") {
+			continue
+		}
+		ttl, err := getTTL(line)
+		if err != nil || seen[ttl] {
+			continue
+		}
+		seen[ttl] = true
+		ttls = append(ttls, ttl)
+	}
+	sort.Ints(ttls)
+	return ttls
+}
+
+// formatTTLs returns ttls as a comma separated string
+func formatTTLs(ttls []int) string {
+	s := make([]string, len(ttls))
+	for i, ttl := range ttls {
+		s[i] = strconv.Itoa(ttl)
+	}
+	return strings.Join(s, ",")
+}
+
+var timeExceededLine = regexp.MustCompile(`(?:From|bytes from) (\S+?):? .*Time (?:to live )?exceeded`)
+
+// getHopIP returns the address of the router that sent the first Time
+// Exceeded reply, or an empty string if there is none. Linux ping prints
+// "From 10.0.0.1 icmp_seq=1 Time to live exceeded" and BSD ping prints
+// "36 bytes from 10.0.0.1: Time to live exceeded".
+func getHopIP(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		match := timeExceededLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if ip := net.ParseIP(match[1]); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+var sourceLine = regexp.MustCompile(`^PING \S+? ?\([^)]*\) from ([0-9a-fA-F.:]+)`)
+
+// getSourceIP returns the source address of the first line of Linux ping,
+// printed when it binds to an interface or address, like "PING example.org
+// (93.184.216.34) from 192.168.1.10 eth0: 16(44) bytes of data.", or an empty
+// string if there is none.
+func getSourceIP(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		match := sourceLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		if ip := net.ParseIP(match[1]); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+var seqLine = regexp.MustCompile(`bytes from .*\b(?:icmp_)?seq=(\d+)`)
+
+// getReordered returns the number of replies with a lower sequence number
+// than a reply received before, duplicate replies are ignored. It returns
+// false if no reply has a sequence number.
+func getReordered(out string) (int, bool) {
+	var reordered int
+	max := -1
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, "DUP!") {
+			continue
+		}
+		match := seqLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		seq, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		if seq < max {
+			reordered++
+		} else {
+			max = seq
+		}
+	}
+	return reordered, max >= 0
+}
+
+// reply is a single echo reply printed by ping
+type reply struct {
+	seq int
+	// ttl and rtt, in ms, are -1 if ping did not print them
+	ttl       int
+	rtt       float64
+	duplicate bool
+}
+
+// getReplies returns the replies with a sequence number, in the order ping
+// printed them
+func getReplies(out string) []reply {
+	var replies []reply
+	for _, line := range strings.Split(out, "\n") {
+		match := seqLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		seq, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		r := reply{seq: seq, ttl: -1, rtt: -1, duplicate: strings.Contains(line, "DUP!")}
+		if ttl, err := getTTL(line); err == nil {
+			r.ttl = ttl
+		}
+		if rtt, ok := getRTT(line); ok {
+			r.rtt = rtt
+		}
+		replies = append(replies, r)
+	}
+	return replies
+}
+
+// addReplies adds a ping_reply metric for every reply of the ping of url
+// started at start. The metric of a reply is timestamped with the time its
+// request was sent, estimated from its sequence number and the ping
+// interval, so that the replies of a ping are distinct points.
+func (p *Ping) addReplies(acc telegraf.Accumulator, pingTags map[string]string, replies []reply, start time.Time) {
+	if len(replies) == 0 {
+		return
+	}
+
+	suffix, scale := "_ms", 1.0
+	if p.OutputUnit == "s" {
+		suffix, scale = "_s", 0.001
+	}
+	interval := time.Second
+	if p.PingInterval > 0 {
+		interval = time.Duration(p.PingInterval * float64(time.Second))
+	}
+
+	first := replies[0].seq
+	for _, r := range replies {
+		if r.seq < first {
+			first = r.seq
+		}
+	}
+	for _, r := range replies {
+		if r.duplicate && !p.ReportDuplicates {
+			continue
+		}
+		tags := map[string]string{"url": pingTags["url"]}
+		for _, key := range []string{"source_interface", "target_type"} {
+			if value, ok := pingTags[key]; ok {
+				tags[key] = value
+			}
+		}
+		if r.duplicate {
+			tags["duplicate"] = "true"
+		}
+		fields := map[string]interface{}{"seq": r.seq}
+		if r.ttl >= 0 {
+			fields["ttl"] = r.ttl
+		}
+		if r.rtt >= 0 {
+			fields["response"+suffix] = r.rtt * scale
+		}
+		acc.AddFields("ping_reply", fields, tags, start.Add(time.Duration(r.seq-first)*interval))
+	}
+}
+
+var rttLine = regexp.MustCompile(`time=([\d.]+) ?ms`)
+
+// getRTT returns the round trip time of a reply line, in ms
+func getRTT(line string) (float64, bool) {
+	rttMatch := rttLine.FindStringSubmatch(line)
+	if rttMatch == nil {
+		return 0, false
+	}
+	rtt, err := strconv.ParseFloat(rttMatch[1], 64)
+	return rtt, err == nil
+}
+
+// rttStats returns the minimum, average, maximum and sample standard
+// deviation of a non empty list of round trip times, the standard deviation
+// of a single round trip time is 0. Every method computes its statistics
+// with it so that they are comparable.
+func rttStats(rtts []float64) (float64, float64, float64, float64) {
+	min, max, sum := rtts[0], rtts[0], 0.0
+	for _, rtt := range rtts {
+		min = math.Min(min, rtt)
+		max = math.Max(max, rtt)
+		sum += rtt
+	}
+	avg := sum / float64(len(rtts))
+	if len(rtts) == 1 {
+		return min, avg, max, 0
+	}
+
+	var squares float64
+	for _, rtt := range rtts {
+		squares += (rtt - avg) * (rtt - avg)
+	}
+	return min, avg, max, math.Sqrt(squares / float64(len(rtts)-1))
+}
+
 func checkRoundTripTimeStats(line string, min, avg, max,
 	stddev float64) (float64, float64, float64, float64, error) {
 	stats := strings.Split(line, " ")[3]
@@ -329,14 +1564,11 @@ func checkRoundTripTimeStats(line string, min, avg, max,
 
 func init() {
 	inputs.Add("ping", func() telegraf.Input {
-		return &Ping{
-			pingHost:     hostPinger,
-			PingInterval: 1.0,
-			Count:        1,
-			Timeout:      1.0,
-			Deadline:     10,
-			Binary:       "ping",
-			Arguments:    []string{},
-		}
+		p := newPing()
+		p.pingHost = hostPinger
+		p.lookPath = exec.LookPath
+		p.findGateway = defaultGateway
+		p.Timeout = 1.0
+		return p
 	})
 }
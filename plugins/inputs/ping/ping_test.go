@@ -1,13 +1,21 @@
+//go:build !windows
 // +build !windows
 
 package ping
 
 import (
 	"errors"
+	"net"
+	"os/exec"
 	"reflect"
+	"runtime"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -89,6 +97,45 @@ func TestProcessPingOutput(t *testing.T) {
 	assert.InDelta(t, 15.810, min, 0.001)
 	assert.InDelta(t, 17.611, avg, 0.001)
 	assert.InDelta(t, 22.559, max, 0.001)
+	// busybox does not print the standard deviation, it is computed from
+	// the reply times
+	assert.InDelta(t, 3.306, stddev, 0.001)
+}
+
+// BusyBox output with a single reply
+var busyBoxSingleReplyOutput = `
+PING 8.8.8.8 (8.8.8.8): 56 data bytes
+64 bytes from 8.8.8.8: seq=0 ttl=56 time=22.559 ms
+
+--- 8.8.8.8 ping statistics ---
+1 packets transmitted, 1 packets received, 0% packet loss
+round-trip min/avg/max = 22.559/22.559/22.559 ms
+`
+
+// BusyBox output with two replies
+var busyBoxTwoRepliesOutput = `
+PING 8.8.8.8 (8.8.8.8): 56 data bytes
+64 bytes from 8.8.8.8: seq=0 ttl=56 time=10.000 ms
+64 bytes from 8.8.8.8: seq=1 ttl=56 time=20.000 ms
+
+--- 8.8.8.8 ping statistics ---
+2 packets transmitted, 2 packets received, 0% packet loss
+round-trip min/avg/max = 10.000/15.000/20.000 ms
+`
+
+// Test that the standard deviation computed from the reply times is the
+// sample standard deviation, 7.071 for two replies 10ms apart where the
+// population standard deviation would be 5
+func TestProcessPingOutputSampleStdDev(t *testing.T) {
+	_, _, _, _, _, _, stddev, err := processPingOutput(busyBoxTwoRepliesOutput)
+	assert.NoError(t, err)
+	assert.InDelta(t, 7.071, stddev, 0.001)
+}
+
+// Test that the standard deviation is left unset when it cannot be computed
+func TestProcessPingOutputSingleReply(t *testing.T) {
+	_, _, _, _, _, _, stddev, err := processPingOutput(busyBoxSingleReplyOutput)
+	assert.NoError(t, err)
 	assert.InDelta(t, -1.0, stddev, 0.001)
 }
 
@@ -126,13 +173,60 @@ func TestErrorProcessPingOutput(t *testing.T) {
 	assert.Error(t, err, "Error was expected from processPingOutput")
 }
 
+func TestGetPacketStats(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		trans int
+		recv  int
+	}{
+		{"iputils", "5 packets transmitted, 3 received, 40% packet loss, time 4010ms", 5, 3},
+		{"iputils errors", "5 packets transmitted, 0 received, +5 errors, 100% packet loss, time 4005ms", 5, 0},
+		{"iputils duplicates", "4 packets transmitted, 4 received, +2 duplicates, 0% packet loss, time 3004ms", 4, 4},
+		{"busybox", "5 packets transmitted, 5 packets received, 0% packet loss", 5, 5},
+		{"macos", "5 packets transmitted, 4 packets received, 20.0% packet loss", 5, 4},
+		{"macos duplicates", "3 packets transmitted, 3 packets received, +1 duplicates, 0.0% packet loss", 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trans, recv, err := getPacketStats(tt.line, 0, 0)
+			require.NoError(t, err)
+			assert.Equal(t, tt.trans, trans)
+			assert.Equal(t, tt.recv, recv)
+		})
+	}
+
+	_, _, err := getPacketStats("packets transmitted and received", 0, 0)
+	require.Error(t, err)
+}
+
+var errorsPingOutput = `
+PING 10.0.0.99 (10.0.0.99) 56(84) bytes of data.
+From 10.0.0.1 icmp_seq=1 Destination Host Unreachable
+From 10.0.0.1 icmp_seq=2 Destination Host Unreachable
+From 10.0.0.1 icmp_seq=3 Destination Host Unreachable
+
+--- 10.0.0.99 ping statistics ---
+3 packets transmitted, 0 received, +3 errors, 100% packet loss, time 2043ms
+`
+
+// Test that the errors segment of iputils does not break the parsing
+func TestProcessPingOutputErrors(t *testing.T) {
+	trans, rec, _, min, _, _, _, err := processPingOutput(errorsPingOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, trans)
+	assert.Equal(t, 0, rec)
+	assert.Equal(t, -1.0, min)
+}
+
 // Test that arg lists and created correctly
 func TestArgs(t *testing.T) {
 	p := Ping{
 		Count:        2,
 		Interface:    "eth0",
 		Timeout:      12.0,
-		Deadline:     24,
+		Deadline:     internal.Duration{Duration: 24 * time.Second},
 		PingInterval: 1.2,
 	}
 
@@ -154,6 +248,294 @@ func TestArgs(t *testing.T) {
 	}
 }
 
+func TestArgsAddressFamily(t *testing.T) {
+	p := Ping{
+		Count:         2,
+		AddressFamily: "ipv6",
+	}
+
+	actual := p.args("www.google.com", "linux")
+	expected := []string{"-c", "2", "-n", "-s", "16", "-6", "www.google.com"}
+	require.True(t, reflect.DeepEqual(expected, actual),
+		"Expected: %s Actual: %s", expected, actual)
+}
+
+func TestArgsFirewallMark(t *testing.T) {
+	p := Ping{
+		Count:        2,
+		FirewallMark: 10,
+	}
+
+	expected := []string{"-c", "2", "-n", "-s", "16", "-m", "10", "www.google.com"}
+	require.Equal(t, expected, p.args("www.google.com", "linux"))
+
+	// -m is the TTL on darwin
+	expected = []string{"-c", "2", "-n", "-s", "16", "www.google.com"}
+	require.Equal(t, expected, p.args("www.google.com", "darwin"))
+}
+
+func TestCheckFirewallMark(t *testing.T) {
+	p := Ping{FirewallMark: -1}
+	require.EqualError(t, p.checkFirewallMark("linux"), "invalid firewall_mark -1, must be between 0 and 4294967295")
+
+	p = Ping{FirewallMark: 10}
+	require.NoError(t, p.checkFirewallMark("linux"))
+	require.Equal(t, 10, p.FirewallMark)
+
+	require.NoError(t, p.checkFirewallMark("freebsd"))
+	require.Equal(t, 0, p.FirewallMark)
+}
+
+func TestArgsSize(t *testing.T) {
+	p := Ping{
+		Count: 2,
+		Size:  64,
+	}
+
+	actual := p.args("www.google.com", "linux")
+	expected := []string{"-c", "2", "-n", "-s", "64", "www.google.com"}
+	require.True(t, reflect.DeepEqual(expected, actual),
+		"Expected: %s Actual: %s", expected, actual)
+}
+
+func TestArgsDeadline(t *testing.T) {
+	p := Ping{
+		Count:    2,
+		Deadline: internal.Duration{Duration: 500 * time.Millisecond},
+	}
+
+	expected := []string{"-c", "2", "-n", "-s", "16", "-w", "0.5", "www.google.com"}
+	require.Equal(t, expected, p.args("www.google.com", "linux"))
+
+	p.Deadline.Duration = 2500 * time.Millisecond
+	expected = []string{"-c", "2", "-n", "-s", "16", "-t", "3", "www.google.com"}
+	require.Equal(t, expected, p.args("www.google.com", "darwin"))
+
+	p.Deadline.Duration = 10 * time.Second
+	expected = []string{"-c", "2", "-n", "-s", "16", "-w", "10", "www.google.com"}
+	require.Equal(t, expected, p.args("www.google.com", "linux"))
+}
+
+func TestPingGatherDeadlineBoundsRun(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:               []string{"localhost"},
+		Count:              2,
+		Timeout:            1,
+		PingInterval:       0.2,
+		MinPingInterval:    0.2,
+		Deadline:           internal.Duration{Duration: 500 * time.Millisecond},
+		CommandTimeoutSlop: internal.Duration{Duration: 5 * time.Second},
+		// a ping that does not end by itself, it runs until it is killed
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			time.Sleep(time.Duration(timeout * float64(time.Second)))
+			return "", errors.New("command timed out")
+		},
+	}
+
+	start := time.Now()
+	acc.GatherError(p.Gather)
+	require.True(t, time.Since(start) < time.Second, "gather took %s", time.Since(start))
+	require.True(t, acc.HasPoint("ping", map[string]string{"url": "localhost"}, "result_code", 2))
+}
+
+func TestCheckDeadline(t *testing.T) {
+	p := Ping{
+		Count:        3,
+		PingInterval: 0.2,
+		Deadline:     internal.Duration{Duration: 500 * time.Millisecond},
+	}
+	require.EqualError(t, p.checkDeadline(), "deadline 500ms is shorter than count 3 * ping_interval 0.2")
+
+	p.Deadline.Duration = 600 * time.Millisecond
+	require.NoError(t, p.checkDeadline())
+
+	p.Profiles = []profile{{Name: "detailed", Count: 10}}
+	require.EqualError(t, p.checkDeadline(), `profile "detailed": deadline 600ms is shorter than count 10 * ping_interval 0.2`)
+
+	p.Deadline.Duration = 0
+	require.NoError(t, p.checkDeadline())
+}
+
+func TestCheckInterfaces(t *testing.T) {
+	p := Ping{Interfaces: []string{"eth0"}, InterfaceMode: "random"}
+	require.EqualError(t, p.checkInterfaces(), `invalid interface_mode "random", must be "round-robin" or "all"`)
+
+	p = Ping{Interface: "eth0", Interfaces: []string{"eth1"}}
+	require.EqualError(t, p.checkInterfaces(), "interface and interfaces cannot both be set")
+
+	p = Ping{Interfaces: []string{"eth0"}, Method: "tcp"}
+	require.EqualError(t, p.checkInterfaces(), `interfaces is only supported with method = "exec"`)
+
+	p = Ping{Interfaces: []string{"eth0", ""}}
+	require.EqualError(t, p.checkInterfaces(), "interfaces must not contain an empty interface")
+
+	p = Ping{Interfaces: []string{"eth0", "eth1"}, InterfaceMode: "all"}
+	require.NoError(t, p.checkInterfaces())
+}
+
+func TestPingGatherInterfaces(t *testing.T) {
+	var mu sync.Mutex
+	var pinged []string
+	pingHost := func(binary string, timeout float64, args ...string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for i, arg := range args {
+			if arg == "-I" {
+				pinged = append(pinged, args[len(args)-1]+" from "+args[i+1])
+			}
+		}
+		return linuxPingOutput, nil
+	}
+
+	p := Ping{
+		Urls:       []string{"www.google.com", "www.reddit.com", "www.example.org"},
+		Interfaces: []string{"eth0", "eth1"},
+		pingHost:   pingHost,
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(p.Gather))
+	require.Len(t, acc.Metrics, 3)
+	sort.Strings(pinged)
+	assert.Equal(t, []string{"www.example.org from eth0", "www.google.com from eth0", "www.reddit.com from eth1"}, pinged)
+	assert.True(t, acc.HasPoint("ping", map[string]string{"url": "www.reddit.com", "source_interface": "eth1"}, "result_code", 0))
+
+	pinged = nil
+	p = Ping{
+		Urls:          []string{"www.google.com", "www.reddit.com"},
+		Interfaces:    []string{"eth0", "eth1"},
+		InterfaceMode: "all",
+		pingHost:      pingHost,
+	}
+	acc = testutil.Accumulator{}
+	require.NoError(t, acc.GatherError(p.Gather))
+	require.Len(t, acc.Metrics, 4)
+	assert.Len(t, pinged, 4)
+	for _, url := range p.Urls {
+		for _, iface := range p.Interfaces {
+			assert.True(t, acc.HasPoint("ping", map[string]string{"url": url, "source_interface": iface}, "result_code", 0))
+		}
+	}
+}
+
+func TestCheckAddressFamily(t *testing.T) {
+	v4 := &net.IPNet{IP: net.ParseIP("192.168.1.2"), Mask: net.CIDRMask(24, 32)}
+	v6 := &net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)}
+
+	require.NoError(t, checkAddressFamily("eth0", []net.Addr{v4, v6}, "ipv4"))
+	require.NoError(t, checkAddressFamily("eth0", []net.Addr{v4, v6}, "ipv6"))
+	require.NoError(t, checkAddressFamily("eth0", []net.Addr{v4}, "ipv4"))
+
+	err := checkAddressFamily("eth0", []net.Addr{v4}, "ipv6")
+	require.EqualError(t, err, "interface eth0 has no ipv6 address, check the interface and address_family options")
+}
+
+func TestAlignDelay(t *testing.T) {
+	start := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Duration(0), alignDelay(start, time.Second))
+	assert.Equal(t, 750*time.Millisecond, alignDelay(start.Add(250*time.Millisecond), time.Second))
+	assert.Equal(t, 30*time.Second, alignDelay(start.Add(90*time.Second), time.Minute))
+}
+
+// Test that probes start at the configured wall clock boundary
+func TestPingGatherProbeAlignment(t *testing.T) {
+	var acc testutil.Accumulator
+	var mu sync.Mutex
+	var starts []time.Time
+	p := Ping{
+		Urls:           []string{"www.google.com", "www.reddit.com"},
+		ProbeAlignment: internal.Duration{Duration: 200 * time.Millisecond},
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			mu.Lock()
+			starts = append(starts, time.Now())
+			mu.Unlock()
+			return linuxPingOutput, nil
+		},
+	}
+
+	acc.GatherError(p.Gather)
+	require.Len(t, starts, 2)
+	for _, start := range starts {
+		offset := start.Sub(start.Truncate(200 * time.Millisecond))
+		assert.True(t, offset < 50*time.Millisecond,
+			"probe started %s after the boundary", offset)
+	}
+}
+
+func TestHasAddress(t *testing.T) {
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+		&net.IPNet{IP: net.ParseIP("192.168.1.2"), Mask: net.CIDRMask(24, 32)},
+		&net.IPNet{IP: net.ParseIP("::1"), Mask: net.CIDRMask(128, 128)},
+	}
+
+	assert.True(t, hasAddress(addrs, net.ParseIP("192.168.1.2")))
+	assert.True(t, hasAddress(addrs, net.ParseIP("::1")))
+	assert.False(t, hasAddress(addrs, net.ParseIP("192.168.1.20")))
+}
+
+// Test that a source address that is not assigned locally is reported by
+// Gather without running ping
+func TestGatherUnknownSourceAddress(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:      []string{"www.google.com"},
+		Interface: "192.0.2.123",
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			t.Fatal("ping should not run with an unknown source address")
+			return "", nil
+		},
+	}
+
+	err := acc.GatherError(p.Gather)
+	require.EqualError(t, err, "source address 192.0.2.123 is not assigned to any local interface")
+}
+
+func TestPingGatherIntegerLatency(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:           []string{"www.google.com"},
+		IntegerLatency: true,
+		pingHost:       mockHostPinger,
+	}
+
+	require.NoError(t, acc.GatherError(p.Gather))
+	acc.AssertContainsTaggedFields(t, "ping", map[string]interface{}{
+		"packets_transmitted":   5,
+		"packets_received":      5,
+		"percent_packet_loss":   0.0,
+		"ttl":                   63,
+		"ttl_min":               63,
+		"ttl_max":               63,
+		"minimum_response_ms":   int64(35),
+		"average_response_ms":   int64(44),
+		"maximum_response_ms":   int64(52),
+		"standard_deviation_ms": 5.325,
+		"result_code":           0,
+	}, map[string]string{"url": "www.google.com"})
+
+	p = Ping{IntegerLatency: true, OutputUnit: "s"}
+	require.EqualError(t, p.initialize(), `integer_latency cannot be combined with output_unit = "s"`)
+}
+
+// Test that an invalid configuration is reported once by Gather instead of
+// failing for every url
+func TestGatherInvalidAddressFamily(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:          []string{"www.google.com", "www.reddit.com"},
+		AddressFamily: "ipv5",
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			t.Fatal("ping should not run with an invalid configuration")
+			return "", nil
+		},
+	}
+
+	require.Error(t, acc.GatherError(p.Gather))
+	require.Empty(t, acc.Metrics)
+}
+
 func TestArguments(t *testing.T) {
 	arguments := []string{"-c", "3"}
 	expected := append(arguments, "www.google.com")
@@ -161,7 +543,7 @@ func TestArguments(t *testing.T) {
 		Count:        2,
 		Interface:    "eth0",
 		Timeout:      12.0,
-		Deadline:     24,
+		Deadline:     internal.Duration{Duration: 24 * time.Second},
 		PingInterval: 1.2,
 		Arguments:    arguments,
 	}
@@ -191,6 +573,8 @@ func TestPingGather(t *testing.T) {
 		"packets_received":      5,
 		"percent_packet_loss":   0.0,
 		"ttl":                   63,
+		"ttl_min":               63,
+		"ttl_max":               63,
 		"minimum_response_ms":   35.225,
 		"average_response_ms":   43.628,
 		"maximum_response_ms":   51.806,
@@ -203,6 +587,100 @@ func TestPingGather(t *testing.T) {
 	acc.AssertContainsTaggedFields(t, "ping", fields, tags)
 }
 
+// Test that response times are reported in seconds with output_unit = "s"
+func TestPingGatherOutputUnitSeconds(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:       []string{"www.google.com"},
+		OutputUnit: "s",
+		pingHost:   mockHostPinger,
+	}
+
+	acc.GatherError(p.Gather)
+	tags := map[string]string{"url": "www.google.com"}
+	fields := map[string]interface{}{
+		"packets_transmitted":  5,
+		"packets_received":     5,
+		"percent_packet_loss":  0.0,
+		"ttl":                  63,
+		"ttl_min":              63,
+		"ttl_max":              63,
+		"minimum_response_s":   0.035225,
+		"average_response_s":   0.043628,
+		"maximum_response_s":   0.051806,
+		"standard_deviation_s": 0.005325,
+		"result_code":          0,
+	}
+	acc.AssertContainsTaggedFields(t, "ping", fields, tags)
+	assert.False(t, acc.HasField("ping", "average_response_ms"))
+}
+
+// Test that the summary counts successful and failed urls
+func TestPingGatherSummary(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:        []string{"www.google.com", "www.amazon.com", "www.reddit.com", "host.invalid"},
+		EmitSummary: true,
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			switch args[len(args)-1] {
+			case "www.google.com":
+				return linuxPingOutput, nil
+			case "www.amazon.com":
+				return errorPingOutput, nil
+			default:
+				return fatalPingOutput, errors.New("So very bad")
+			}
+		},
+	}
+
+	acc.GatherError(p.Gather)
+	acc.AssertContainsFields(t, "ping_summary", map[string]interface{}{
+		"total":        4,
+		"successful":   1,
+		"failed":       3,
+		"dns_failures": 1,
+		"dns_outage":   false,
+	})
+}
+
+// Test that urls that do not answer are not counted as DNS failures
+func TestPingGatherSummaryUnreachable(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:        []string{"www.google.com", "www.amazon.com"},
+		EmitSummary: true,
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			return errorPingOutput, exec.Command("false").Run()
+		},
+	}
+
+	require.NoError(t, p.Gather(&acc))
+	acc.AssertContainsTaggedFields(t, "ping", map[string]interface{}{
+		"packets_transmitted": 2,
+		"packets_received":    0,
+		"percent_packet_loss": 100.0,
+		"result_code":         1,
+	}, map[string]string{"url": "www.google.com"})
+	acc.AssertContainsFields(t, "ping_summary", map[string]interface{}{
+		"total":        2,
+		"successful":   0,
+		"failed":       2,
+		"dns_failures": 0,
+		"dns_outage":   false,
+	})
+}
+
+func TestPingGatherNoSummary(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:     []string{"www.google.com"},
+		pingHost: mockHostPinger,
+	}
+
+	acc.GatherError(p.Gather)
+	assert.False(t, acc.HasMeasurement("ping_summary"))
+}
+
 var lossyPingOutput = `
 PING www.google.com (216.58.218.164) 56(84) bytes of data.
 64 bytes from host.net (216.58.218.164): icmp_seq=1 ttl=63 time=35.2 ms
@@ -233,6 +711,8 @@ func TestLossyPingGather(t *testing.T) {
 		"packets_received":      3,
 		"percent_packet_loss":   40.0,
 		"ttl":                   63,
+		"ttl_min":               63,
+		"ttl_max":               63,
 		"minimum_response_ms":   35.225,
 		"average_response_ms":   44.033,
 		"maximum_response_ms":   51.806,
@@ -242,6 +722,64 @@ func TestLossyPingGather(t *testing.T) {
 	acc.AssertContainsTaggedFields(t, "ping", fields, tags)
 }
 
+// Test that a lossy ping exiting with status 1 succeeds below the loss
+// threshold
+func TestLossThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold float64
+		expected  int
+	}{
+		{name: "disabled", threshold: 0, expected: 1},
+		{name: "below", threshold: 50, expected: 0},
+		{name: "at", threshold: 40, expected: 0},
+		{name: "above", threshold: 20, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var acc testutil.Accumulator
+			p := Ping{
+				Urls:                 []string{"www.google.com"},
+				LossThresholdPercent: tt.threshold,
+				resolve:              func(string) ([]string, error) { return []string{"216.58.218.164"}, nil },
+				pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+					return lossyPingOutput, exec.Command("false").Run()
+				},
+			}
+
+			require.NoError(t, acc.GatherError(p.Gather))
+			tags := map[string]string{"url": "www.google.com"}
+			fields := map[string]interface{}{
+				"packets_transmitted":   5,
+				"packets_received":      3,
+				"percent_packet_loss":   40.0,
+				"ttl":                   63,
+				"ttl_min":               63,
+				"ttl_max":               63,
+				"minimum_response_ms":   35.225,
+				"average_response_ms":   44.033,
+				"maximum_response_ms":   51.806,
+				"standard_deviation_ms": 5.325,
+				"result_code":           tt.expected,
+			}
+			acc.AssertContainsTaggedFields(t, "ping", fields, tags)
+		})
+	}
+}
+
+func TestLossThresholdNoReply(t *testing.T) {
+	p := Ping{LossThresholdPercent: 100}
+	fields := map[string]interface{}{"result_code": 1}
+	p.applyLossThreshold(fields, 0, 100)
+	assert.Equal(t, 1, fields["result_code"])
+}
+
+func TestLossThresholdInvalid(t *testing.T) {
+	p := Ping{LossThresholdPercent: 120}
+	require.EqualError(t, p.initialize(), "invalid loss_threshold_percent 120, must be between 0 and 100")
+}
+
 var errorPingOutput = `
 PING www.amazon.com (176.32.98.166): 56 data bytes
 Request timeout for icmp_seq 0
@@ -327,6 +865,105 @@ func TestErrorWithHostNamePingGather(t *testing.T) {
 	}
 }
 
+func TestPingGatherRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		retries  int
+		timeout  float64
+		err      error
+		calls    int
+		fields   map[string]interface{}
+	}{
+		{
+			name:     "retried until success",
+			failures: 2,
+			retries:  3,
+			err:      errors.New("sendmsg: network is unreachable"),
+			calls:    3,
+			fields:   map[string]interface{}{"result_code": 0, "ping_attempts": 3},
+		},
+		{
+			name:     "retries exhausted",
+			failures: 5,
+			retries:  2,
+			err:      errors.New("sendmsg: network is unreachable"),
+			calls:    3,
+			fields:   map[string]interface{}{"result_code": 2, "ping_attempts": 3},
+		},
+		{
+			name:     "retry exceeding the deadline",
+			failures: 5,
+			retries:  2,
+			timeout:  20,
+			err:      errors.New("sendmsg: network is unreachable"),
+			calls:    1,
+			fields:   map[string]interface{}{"result_code": 2, "ping_attempts": 1},
+		},
+		{
+			name:     "packet loss is not retried",
+			failures: 5,
+			retries:  2,
+			err:      exec.Command("false").Run(),
+			calls:    1,
+			fields:   map[string]interface{}{"result_code": 1, "ping_attempts": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			p := Ping{
+				Urls:          []string{"www.google.com"},
+				Count:         1,
+				Timeout:       tt.timeout,
+				Deadline:      internal.Duration{Duration: 10 * time.Second},
+				GatherRetries: tt.retries,
+				resolve:       func(string) ([]string, error) { return []string{"216.58.218.164"}, nil },
+				pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+					calls++
+					if calls <= tt.failures {
+						return lossyPingOutput, tt.err
+					}
+					return linuxPingOutput, nil
+				},
+			}
+
+			var acc testutil.Accumulator
+			acc.GatherError(p.Gather)
+			assert.Equal(t, tt.calls, calls)
+			require.Len(t, acc.Metrics, 1)
+			for key, value := range tt.fields {
+				assert.Equal(t, value, acc.Metrics[0].Fields[key], key)
+			}
+		})
+	}
+}
+
+func TestTargetType(t *testing.T) {
+	assert.Equal(t, "ip", targetType("192.168.1.1"))
+	assert.Equal(t, "ip", targetType("2001:db8::1"))
+	assert.Equal(t, "ip", targetType("fe80::1%eth0"))
+	assert.Equal(t, "ip", targetType("[2001:db8::1]:443"))
+	assert.Equal(t, "ip", targetType("192.168.1.1:80"))
+	assert.Equal(t, "hostname", targetType("www.google.com"))
+	assert.Equal(t, "hostname", targetType("www.google.com:443"))
+}
+
+func TestPingGatherTagTargetType(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:          []string{"www.google.com", "192.168.1.1"},
+		TagTargetType: true,
+		resolve:       func(string) ([]string, error) { return []string{"216.58.218.164"}, nil },
+		pingHost:      mockHostPinger,
+	}
+
+	require.NoError(t, acc.GatherError(p.Gather))
+	assert.True(t, acc.HasPoint("ping", map[string]string{"url": "www.google.com", "target_type": "hostname"}, "result_code", 0))
+	assert.True(t, acc.HasPoint("ping", map[string]string{"url": "192.168.1.1", "target_type": "ip"}, "result_code", 0))
+}
+
 func TestPingBinary(t *testing.T) {
 	var acc testutil.Accumulator
 	p := Ping{
@@ -339,3 +976,728 @@ func TestPingBinary(t *testing.T) {
 	}
 	acc.GatherError(p.Gather)
 }
+
+func TestPingResolveBinary(t *testing.T) {
+	var lookups []string
+	var binaries []string
+	var mu sync.Mutex
+	p := Ping{
+		Urls:   []string{"localhost", "127.0.0.1"},
+		Binary: "ping",
+		lookPath: func(file string) (string, error) {
+			lookups = append(lookups, file)
+			return "/bin/" + file, nil
+		},
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			mu.Lock()
+			binaries = append(binaries, binary)
+			mu.Unlock()
+			return linuxPingOutput, nil
+		},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(p.Gather))
+	require.NoError(t, acc.GatherError(p.Gather))
+	assert.Equal(t, []string{"ping"}, lookups)
+	assert.Equal(t, []string{"/bin/ping", "/bin/ping", "/bin/ping", "/bin/ping"}, binaries)
+
+	// a changed binary is resolved again
+	p.Binary = "ping6"
+	require.NoError(t, acc.GatherError(p.Gather))
+	assert.Equal(t, []string{"ping", "ping6"}, lookups)
+	assert.Equal(t, "/bin/ping6", binaries[len(binaries)-1])
+}
+
+func TestPingBinaryNotFound(t *testing.T) {
+	p := Ping{
+		Urls:   []string{"localhost", "127.0.0.1"},
+		Binary: "pong",
+		lookPath: func(file string) (string, error) {
+			return "", errors.New("executable file not found in $PATH")
+		},
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			t.Error("ping should not run without a binary")
+			return "", nil
+		},
+	}
+
+	var acc testutil.Accumulator
+	err := acc.GatherError(p.Gather)
+	require.EqualError(t, err, `ping binary "pong" not found, check the binary option: executable file not found in $PATH`)
+	assert.Empty(t, acc.Metrics)
+}
+
+func TestPingIntervalPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		interval float64
+		policy   string
+		expected float64
+		err      bool
+	}{
+		{name: "above minimum", interval: 0.5, policy: "adjust", expected: 0.5},
+		{name: "default", interval: 0, policy: "error", expected: 0},
+		{name: "adjust", interval: 0.01, policy: "adjust", expected: 0.2},
+		{name: "empty policy adjusts", interval: 0.01, expected: 0.2},
+		{name: "error", interval: 0.01, policy: "error", err: true},
+		{name: "tcp", method: "tcp", interval: 0.01, policy: "error", expected: 0.01},
+		{name: "invalid policy", interval: 0.01, policy: "bump", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Ping{
+				Method:             tt.method,
+				PingInterval:       tt.interval,
+				MinPingInterval:    0.2,
+				PingIntervalPolicy: tt.policy,
+			}
+			err := p.initialize()
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, p.PingInterval)
+		})
+	}
+}
+
+func TestRapid(t *testing.T) {
+	p := Ping{
+		Count:           10,
+		PingInterval:    1.0,
+		MinPingInterval: 0.2,
+		Rapid:           true,
+		RapidMaxRate:    200,
+	}
+	require.NoError(t, p.initialize())
+	assert.Equal(t, 0.005, p.PingInterval)
+
+	actual := p.args("www.google.com", "linux")
+	expected := []string{"-c", "10", "-n", "-s", "16", "-f", "-i", "0.005", "www.google.com"}
+	require.True(t, reflect.DeepEqual(expected, actual),
+		"Expected: %s Actual: %s", expected, actual)
+
+	actual = p.args("www.google.com", "anything else")
+	expected = []string{"-c", "10", "-n", "-s", "16", "-i", "0.005", "www.google.com"}
+	require.True(t, reflect.DeepEqual(expected, actual),
+		"Expected: %s Actual: %s", expected, actual)
+}
+
+func TestRapidInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		ping     *Ping
+		expected string
+	}{
+		{
+			name:     "default count",
+			ping:     &Ping{Count: 1, Rapid: true, RapidMaxRate: 100},
+			expected: "rapid requires count to be greater than 1",
+		},
+		{
+			name:     "no rate",
+			ping:     &Ping{Count: 10, Rapid: true},
+			expected: "invalid rapid_max_rate 0, must be greater than 0",
+		},
+		{
+			name:     "fping",
+			ping:     &Ping{Count: 10, Rapid: true, RapidMaxRate: 100, Method: "fping"},
+			expected: "rapid is only supported with method = \"exec\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.EqualError(t, tt.ping.initialize(), tt.expected)
+		})
+	}
+}
+
+func TestCommandTimeoutSlop(t *testing.T) {
+	var timeouts []float64
+	p := Ping{
+		Urls:               []string{"localhost"},
+		Count:              3,
+		Timeout:            2,
+		PingInterval:       1,
+		MinPingInterval:    0.2,
+		CommandTimeoutSlop: internal.Duration{Duration: 1500 * time.Millisecond},
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			timeouts = append(timeouts, timeout)
+			return linuxPingOutput, nil
+		},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(p.Gather))
+	// 3 pings with a timeout of 2s each, 1s apart, and the slop
+	assert.Equal(t, []float64{9.5}, timeouts)
+
+	// the deadline caps the timeout, unless it is not passed to ping
+	p.Deadline.Duration = 5 * time.Second
+	assert.Equal(t, 5.0, p.commandTimeout(8))
+	p.Arguments = []string{"-c", "3"}
+	assert.Equal(t, 9.5, p.commandTimeout(8))
+
+	p = Ping{CommandTimeoutSlop: internal.Duration{Duration: -time.Second}}
+	require.EqualError(t, p.initialize(), "invalid command_timeout_slop -1s, must not be negative")
+}
+
+func TestPingGatherIntervalAdjusted(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:               []string{"localhost"},
+		Count:              2,
+		PingInterval:       0.01,
+		MinPingInterval:    0.2,
+		PingIntervalPolicy: "adjust",
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			assert.Contains(t, args, "0.2")
+			return linuxPingOutput, nil
+		},
+	}
+	require.NoError(t, acc.GatherError(p.Gather))
+}
+
+func TestPingGatherDebugOutput(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		var acc testutil.Accumulator
+		p := Ping{
+			Urls:        []string{"localhost"},
+			DebugOutput: debug,
+			pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+				return "ping: unexpected output\n", nil
+			},
+		}
+		acc.GatherError(p.Gather)
+
+		require.Len(t, acc.Errors, 1)
+		if debug {
+			assert.EqualError(t, acc.Errors[0],
+				`Fatal error processing ping output: localhost, output: "ping: unexpected output\n"`)
+		} else {
+			assert.EqualError(t, acc.Errors[0], "Fatal error processing ping output: localhost")
+		}
+		assert.True(t, acc.HasPoint("ping", map[string]string{"url": "localhost"}, "result_code", 2))
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	assert.Equal(t, "short", truncateOutput("short"))
+
+	out := truncateOutput(strings.Repeat("x", maxDebugOutput+10))
+	assert.Equal(t, strings.Repeat("x", maxDebugOutput)+"... (truncated)", out)
+}
+
+var flappingTTLPingOutput = `
+PING www.google.com (216.58.218.164) 56(84) bytes of data.
+64 bytes from host.net (216.58.218.164): icmp_seq=1 ttl=63 time=35.2 ms
+64 bytes from host.net (216.58.218.164): icmp_seq=2 ttl=61 time=42.3 ms
+64 bytes from host.net (216.58.218.164): icmp_seq=3 ttl=63 time=36.1 ms
+
+--- www.google.com ping statistics ---
+3 packets transmitted, 3 received, 0% packet loss, time 2002ms
+rtt min/avg/max/mdev = 35.200/37.866/42.300/3.153 ms
+`
+
+func TestGetTTLs(t *testing.T) {
+	assert.Equal(t, []int{61, 63}, getTTLs(flappingTTLPingOutput))
+	assert.Equal(t, []int{63, 64, 255}, getTTLs(linuxPingOutputWithVaryingTTL))
+	assert.Equal(t, []int{63}, getTTLs(linuxPingOutput))
+	assert.Empty(t, getTTLs(fatalPingOutput))
+}
+
+func TestPingGatherTTLRange(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls: []string{"localhost"},
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			return flappingTTLPingOutput, nil
+		},
+	}
+	acc.GatherError(p.Gather)
+
+	tags := map[string]string{"url": "localhost"}
+	assert.True(t, acc.HasPoint("ping", tags, "ttl", 63))
+	assert.True(t, acc.HasPoint("ping", tags, "ttl_min", 61))
+	assert.True(t, acc.HasPoint("ping", tags, "ttl_max", 63))
+}
+
+func TestPingGatherDNSRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		retries    int
+		resultCode int
+		attempts   int
+	}{
+		{name: "resolved after retries", failures: 2, retries: 2, resultCode: 0, attempts: 3},
+		{name: "retries exhausted", failures: 3, retries: 2, resultCode: 1, attempts: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var acc testutil.Accumulator
+			lookups := 0
+			p := Ping{
+				Urls:       []string{"www.google.com"},
+				DNSRetries: tt.retries,
+				resolve: func(host string) ([]string, error) {
+					lookups++
+					if lookups <= tt.failures {
+						return nil, errors.New("temporary failure in name resolution")
+					}
+					return []string{"216.58.218.164"}, nil
+				},
+				pingHost: mockHostPinger,
+			}
+			acc.GatherError(p.Gather)
+
+			tags := map[string]string{"url": "www.google.com"}
+			assert.True(t, acc.HasPoint("ping", tags, "result_code", tt.resultCode))
+			assert.True(t, acc.HasPoint("ping", tags, "dns_attempts", tt.attempts))
+			assert.Equal(t, tt.attempts, lookups)
+		})
+	}
+}
+
+func TestLookupHostDeadline(t *testing.T) {
+	lookups := 0
+	p := Ping{
+		DNSRetries: 10,
+		Deadline:   internal.Duration{Duration: time.Second},
+		resolve: func(host string) ([]string, error) {
+			lookups++
+			return nil, errors.New("temporary failure in name resolution")
+		},
+	}
+
+	fields := map[string]interface{}{}
+	start := time.Now()
+	_, err := p.lookupHost("www.google.com", fields)
+	require.Error(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+	// waits of 100, 200 and 400ms fit in the deadline, 800ms more does not
+	assert.Equal(t, 4, lookups)
+	assert.Equal(t, 4, fields["dns_attempts"])
+}
+
+func TestLookupHostNoRetries(t *testing.T) {
+	p := Ping{
+		resolve: func(host string) ([]string, error) {
+			return []string{"127.0.0.1"}, nil
+		},
+	}
+
+	fields := map[string]interface{}{}
+	addrs, err := p.lookupHost("localhost", fields)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1"}, addrs)
+	assert.NotContains(t, fields, "dns_attempts")
+}
+
+func TestPingIPv6Only(t *testing.T) {
+	var binary string
+	var args []string
+	p := Ping{
+		Urls:   []string{"ipv6.example.org"},
+		Count:  1,
+		Binary: "ping",
+		resolve: func(host string) ([]string, error) {
+			return []string{"2001:db8::1", "2001:db8::2"}, nil
+		},
+		pingHost: func(b string, timeout float64, a ...string) (string, error) {
+			binary, args = b, a
+			return linuxPingOutput, nil
+		},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(p.Gather))
+	assert.True(t, acc.HasPoint("ping", map[string]string{"url": "ipv6.example.org"}, "result_code", 0))
+	if runtime.GOOS == "linux" {
+		assert.Equal(t, "ping", binary)
+		assert.Equal(t, []string{"-c", "1", "-n", "-s", "16", "-6", "ipv6.example.org"}, args)
+	}
+
+	acc = testutil.Accumulator{}
+	p.AddressFamily = "ipv4"
+	args = nil
+	p.Gather(&acc)
+	assert.Nil(t, args)
+	assert.True(t, acc.HasPoint("ping", map[string]string{"url": "ipv6.example.org"}, "result_code", 2))
+	require.Len(t, acc.Errors, 1)
+	assert.EqualError(t, acc.Errors[0], `host ipv6.example.org: only has IPv6 addresses, which address_family "ipv4" cannot ping`)
+}
+
+func TestIPv6Only(t *testing.T) {
+	assert.True(t, ipv6Only([]string{"2001:db8::1", "::1"}))
+	assert.False(t, ipv6Only([]string{"2001:db8::1", "192.0.2.1"}))
+	assert.False(t, ipv6Only([]string{"::ffff:192.0.2.1"}))
+	assert.False(t, ipv6Only(nil))
+	assert.True(t, ipv6Only([]string{"fe80::1%eth0"}))
+}
+
+func TestSplitZone(t *testing.T) {
+	ip, zone := splitZone("fe80::1%eth0")
+	assert.Equal(t, "fe80::1", ip)
+	assert.Equal(t, "eth0", zone)
+
+	ip, zone = splitZone("2001:db8::1")
+	assert.Equal(t, "2001:db8::1", ip)
+	assert.Equal(t, "", zone)
+
+	ip, zone = splitZone("www.google.com")
+	assert.Equal(t, "www.google.com", ip)
+	assert.Equal(t, "", zone)
+}
+
+func TestPingZonedAddress(t *testing.T) {
+	var binary string
+	var args []string
+	p := Ping{
+		Urls:   []string{"fe80::1%eth0"},
+		Count:  1,
+		Binary: "ping",
+		resolve: func(host string) ([]string, error) {
+			return nil, errors.New("no such host")
+		},
+		pingHost: func(b string, timeout float64, a ...string) (string, error) {
+			binary, args = b, a
+			return linuxPingOutput, nil
+		},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(p.Gather))
+	assert.True(t, acc.HasPoint("ping", map[string]string{"url": "fe80::1%eth0"}, "result_code", 0))
+	assert.Equal(t, "fe80::1%eth0", args[len(args)-1])
+	if runtime.GOOS == "linux" {
+		assert.Equal(t, "ping", binary)
+		assert.Equal(t, []string{"-c", "1", "-n", "-s", "16", "-6", "fe80::1%eth0"}, args)
+	}
+}
+
+func TestIPv6Command(t *testing.T) {
+	args := []string{"-c", "1", "-n", "-s", "16", "ipv6.example.org"}
+
+	binary, linuxArgs := ipv6Command("/bin/ping", args, "linux")
+	assert.Equal(t, "/bin/ping", binary)
+	assert.Equal(t, []string{"-c", "1", "-n", "-s", "16", "-6", "ipv6.example.org"}, linuxArgs)
+	assert.Equal(t, "ipv6.example.org", args[len(args)-1])
+
+	binary, darwinArgs := ipv6Command("/sbin/ping", args, "darwin")
+	assert.Equal(t, "/sbin/ping6", binary)
+	assert.Equal(t, args, darwinArgs)
+
+	binary, _ = ipv6Command("ping", args, "freebsd")
+	assert.Equal(t, "ping6", binary)
+
+	binary, _ = ipv6Command("/usr/local/bin/myping", args, "freebsd")
+	assert.Equal(t, "/usr/local/bin/myping", binary)
+}
+
+func TestMaxStartJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		jitter   time.Duration
+		deadline time.Duration
+		expected time.Duration
+	}{
+		{name: "disabled", jitter: 0, deadline: 10 * time.Second, expected: 0},
+		{name: "no deadline", jitter: time.Minute, deadline: 0, expected: time.Minute},
+		{name: "within deadline", jitter: 2 * time.Second, deadline: 10 * time.Second, expected: 2 * time.Second},
+		// 3 pings with a 1s timeout 1s apart take up to 5s
+		{name: "reduced", jitter: 8 * time.Second, deadline: 10 * time.Second, expected: 5 * time.Second},
+		{name: "no time left", jitter: time.Second, deadline: 4 * time.Second, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Ping{
+				Count:        3,
+				Timeout:      1,
+				PingInterval: 1,
+				Deadline:     internal.Duration{Duration: tt.deadline},
+				StartJitter:  internal.Duration{Duration: tt.jitter},
+			}
+			assert.Equal(t, tt.expected, p.maxStartJitter())
+		})
+	}
+}
+
+func TestPingGatherStartJitter(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:        []string{"www.google.com", "www.reddit.com"},
+		StartJitter: internal.Duration{Duration: 50 * time.Millisecond},
+		pingHost:    mockHostPinger,
+	}
+
+	start := time.Now()
+	require.NoError(t, acc.GatherError(p.Gather))
+	assert.True(t, time.Since(start) < time.Second)
+
+	for _, url := range p.Urls {
+		assert.True(t, acc.HasPoint("ping", map[string]string{"url": url}, "packets_received", 5))
+	}
+}
+
+var timeExceededPingOutput = `
+PING www.google.com (216.58.218.164) 16(44) bytes of data.
+From 192.168.1.1 icmp_seq=1 Time to live exceeded
+From 192.168.1.1 icmp_seq=2 Time to live exceeded
+
+--- www.google.com ping statistics ---
+2 packets transmitted, 0 received, +2 errors, 100% packet loss, time 1001ms
+`
+
+var bsdTimeExceededPingOutput = `
+PING www.google.com (216.58.218.164): 16 data bytes
+36 bytes from 192.168.1.1: Time to live exceeded
+Vr HL TOS  Len   ID Flg  off TTL Pro  cks      Src      Dst
+ 4  5  00 002c 1c2f   0 0000  01  01 d1b6 192.168.1.10  216.58.218.164
+
+--- www.google.com ping statistics ---
+1 packets transmitted, 0 packets received, 100.0% packet loss
+`
+
+func TestGetHopIP(t *testing.T) {
+	assert.Equal(t, "192.168.1.1", getHopIP(timeExceededPingOutput))
+	assert.Equal(t, "192.168.1.1", getHopIP(bsdTimeExceededPingOutput))
+	assert.Equal(t, "", getHopIP(linuxPingOutput))
+}
+
+var sourcePingOutput = `
+PING www.google.com (216.58.218.164) from 192.168.1.10 eth0: 56(84) bytes of data.
+64 bytes from host.net (216.58.218.164): icmp_seq=1 ttl=63 time=35.2 ms
+
+--- www.google.com ping statistics ---
+1 packets transmitted, 1 received, 0% packet loss, time 0ms
+rtt min/avg/max/mdev = 35.225/35.225/35.225/0.000 ms
+`
+
+func TestGetSourceIP(t *testing.T) {
+	assert.Equal(t, "192.168.1.10", getSourceIP(sourcePingOutput))
+	assert.Equal(t, "fe80::1", getSourceIP("PING ::1(::1) from fe80::1 lo: 56 data bytes\n"))
+	assert.Equal(t, "10.0.0.2", getSourceIP("PING 10.0.0.1 (10.0.0.1) from 10.0.0.2 : 56(84) bytes of data.\n"))
+	assert.Equal(t, "", getSourceIP(linuxPingOutput))
+	assert.Equal(t, "", getSourceIP(bsdPingOutput))
+}
+
+func TestPingGatherSourceIP(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:      []string{"www.google.com"},
+		Interface: "eth0",
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			return sourcePingOutput, nil
+		},
+	}
+	acc.GatherError(p.Gather)
+
+	tags := map[string]string{"url": "www.google.com", "source_ip": "192.168.1.10"}
+	assert.True(t, acc.HasPoint("ping", tags, "packets_received", 1))
+}
+
+var reorderedPingOutput = `
+PING www.google.com (216.58.218.164) 56(84) bytes of data.
+64 bytes from host.net (216.58.218.164): icmp_seq=1 ttl=63 time=35.2 ms
+64 bytes from host.net (216.58.218.164): icmp_seq=3 ttl=63 time=35.5 ms
+64 bytes from host.net (216.58.218.164): icmp_seq=2 ttl=63 time=52.1 ms
+64 bytes from host.net (216.58.218.164): icmp_seq=2 ttl=63 time=52.3 ms (DUP!)
+64 bytes from host.net (216.58.218.164): icmp_seq=4 ttl=63 time=35.1 ms
+
+--- www.google.com ping statistics ---
+4 packets transmitted, 4 received, +1 duplicates, 0% packet loss, time 3004ms
+rtt min/avg/max/mdev = 35.1/42.0/52.3/8.4 ms
+`
+
+func TestGetReordered(t *testing.T) {
+	reordered, ok := getReordered(reorderedPingOutput)
+	assert.True(t, ok)
+	assert.Equal(t, 1, reordered)
+
+	reordered, ok = getReordered(linuxPingOutput)
+	assert.True(t, ok)
+	assert.Equal(t, 0, reordered)
+
+	reordered, ok = getReordered(busyBoxPingOutput)
+	assert.True(t, ok)
+	assert.Equal(t, 0, reordered)
+
+	_, ok = getReordered(timeExceededPingOutput)
+	assert.False(t, ok)
+}
+
+func TestPingGatherPerPacket(t *testing.T) {
+	for _, perPacket := range []bool{true, false} {
+		var acc testutil.Accumulator
+		p := Ping{
+			Urls:      []string{"www.google.com"},
+			PerPacket: perPacket,
+			pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+				return reorderedPingOutput, nil
+			},
+		}
+		acc.GatherError(p.Gather)
+
+		assert.Equal(t, perPacket, acc.HasPoint("ping", map[string]string{"url": "www.google.com"}, "reordered_packets", 1))
+	}
+}
+
+func TestGetReplies(t *testing.T) {
+	assert.Equal(t, []reply{
+		{seq: 1, ttl: 63, rtt: 35.2},
+		{seq: 3, ttl: 63, rtt: 35.5},
+		{seq: 2, ttl: 63, rtt: 52.1},
+		{seq: 2, ttl: 63, rtt: 52.3, duplicate: true},
+		{seq: 4, ttl: 63, rtt: 35.1},
+	}, getReplies(reorderedPingOutput))
+
+	assert.Empty(t, getReplies(timeExceededPingOutput))
+}
+
+func TestPingGatherReplies(t *testing.T) {
+	for _, duplicates := range []bool{false, true} {
+		var acc testutil.Accumulator
+		p := Ping{
+			Urls:             []string{"www.google.com"},
+			PingInterval:     0.5,
+			PerPacket:        true,
+			ReportDuplicates: duplicates,
+			pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+				return reorderedPingOutput, nil
+			},
+		}
+		require.NoError(t, acc.GatherError(p.Gather))
+
+		var replies []*testutil.Metric
+		for _, m := range acc.Metrics {
+			if m.Measurement == "ping_reply" {
+				replies = append(replies, m)
+			}
+		}
+		if !duplicates {
+			require.Len(t, replies, 4)
+			assert.False(t, acc.HasTag("ping_reply", "duplicate"))
+		} else {
+			require.Len(t, replies, 5)
+			assert.Equal(t, map[string]string{"url": "www.google.com", "duplicate": "true"}, replies[3].Tags)
+		}
+
+		assert.Equal(t, map[string]string{"url": "www.google.com"}, replies[1].Tags)
+		assert.Equal(t, map[string]interface{}{"seq": 3, "ttl": 63, "response_ms": 35.5}, replies[1].Fields)
+		assert.Equal(t, time.Second, replies[1].Time.Sub(replies[0].Time))
+	}
+}
+
+func TestArgsTTL(t *testing.T) {
+	p := Ping{
+		Count: 2,
+		TTL:   3,
+	}
+
+	systemCases := []struct {
+		system string
+		flag   string
+	}{
+		{"linux", "-t"},
+		{"darwin", "-m"},
+		{"freebsd", "-m"},
+		{"netbsd", "-T"},
+		{"openbsd", "-t"},
+	}
+	for _, c := range systemCases {
+		args := p.args("www.google.com", c.system)
+		assert.Equal(t, []string{"-c", "2", "-n", "-s", "16", c.flag, "3", "www.google.com"}, args, c.system)
+	}
+}
+
+func TestPingGatherHopIP(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls: []string{"www.google.com"},
+		TTL:  1,
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			return timeExceededPingOutput, nil
+		},
+	}
+	acc.GatherError(p.Gather)
+
+	tags := map[string]string{"url": "www.google.com", "hop_ip": "192.168.1.1"}
+	assert.True(t, acc.HasPoint("ping", tags, "packets_received", 0))
+}
+
+func TestPingGatherProbeSeq(t *testing.T) {
+	p := Ping{
+		Urls:         []string{"www.google.com", "www.reddit.com"},
+		EmitProbeSeq: true,
+		pingHost:     mockHostPinger,
+	}
+
+	for seq := int64(1); seq <= 3; seq++ {
+		var acc testutil.Accumulator
+		require.NoError(t, acc.GatherError(p.Gather))
+		for _, url := range p.Urls {
+			assert.True(t, acc.HasPoint("ping", map[string]string{"url": url}, "probe_seq", seq))
+		}
+	}
+
+	// a url added later starts its own sequence
+	p.Urls = append(p.Urls, "localhost")
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(p.Gather))
+	assert.True(t, acc.HasPoint("ping", map[string]string{"url": "www.google.com"}, "probe_seq", int64(4)))
+	assert.True(t, acc.HasPoint("ping", map[string]string{"url": "localhost"}, "probe_seq", int64(1)))
+}
+
+func TestPingGatherNoProbeSeq(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:     []string{"www.google.com"},
+		pingHost: mockHostPinger,
+	}
+	require.NoError(t, acc.GatherError(p.Gather))
+	assert.False(t, acc.HasField("ping", "probe_seq"))
+}
+
+func TestPingGatherTTLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		expected string
+	}{
+		{name: "two ttls", out: flappingTTLPingOutput, expected: "61,63"},
+		{name: "three ttls", out: linuxPingOutputWithVaryingTTL, expected: "63,64,255"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var acc testutil.Accumulator
+			p := Ping{
+				Urls: []string{"localhost"},
+				pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+					return tt.out, nil
+				},
+			}
+			acc.GatherError(p.Gather)
+			assert.True(t, acc.HasPoint("ping", map[string]string{"url": "localhost"}, "ttls", tt.expected))
+		})
+	}
+}
+
+func TestPingGatherSingleTTL(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:     []string{"www.google.com"},
+		pingHost: mockHostPinger,
+	}
+	acc.GatherError(p.Gather)
+	assert.True(t, acc.HasPoint("ping", map[string]string{"url": "www.google.com"}, "ttl_min", 63))
+	assert.False(t, acc.HasField("ping", "ttls"))
+}
@@ -1,3 +1,4 @@
+//go:build windows
 // +build windows
 
 package ping
@@ -5,12 +6,12 @@ package ping
 import (
 	"errors"
 	"fmt"
+	"log"
 	"net"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/influxdata/telegraf"
@@ -18,32 +19,15 @@ import (
 	"github.com/influxdata/telegraf/plugins/inputs"
 )
 
-// HostPinger is a function that runs the "ping" function using a list of
-// passed arguments. This can be easily switched with a mocked ping function
-// for unit test purposes (see ping_test.go)
-type HostPinger func(binary string, timeout float64, args ...string) (string, error)
-
-type Ping struct {
-	wg sync.WaitGroup
-
-	// Number of pings to send (ping -c <COUNT>)
-	Count int
-
-	// Ping timeout, in seconds. 0 means no timeout (ping -W <TIMEOUT>)
-	Timeout float64
-
-	// URLs to ping
-	Urls []string
-
-	// Ping executable binary
-	Binary string
-
-	// Arguments for ping command.
-	// when `Arguments` is not empty, other options (ping_interval, timeout, etc) will be ignored
-	Arguments []string
-
-	// host ping function
-	pingHost HostPinger
+// windowsOptions are the options supported by ping.exe, the others are
+// ignored on Windows
+var windowsOptions = map[string]bool{
+	"urls":      true,
+	"count":     true,
+	"timeout":   true,
+	"size":      true,
+	"binary":    true,
+	"arguments": true,
 }
 
 func (s *Ping) Description() string {
@@ -60,6 +44,9 @@ const sampleConfig = `
 	## Ping timeout, in seconds. 0.0 means default timeout (ping -w <TIMEOUT>)
 	# timeout = 0.0
 
+	## Number of data bytes sent in each packet. 0 == default (ping -l <SIZE>)
+	# size = 0
+
 	## Specify the ping executable binary, default is "ping"
 	# binary = "ping"
 
@@ -73,6 +60,13 @@ func (s *Ping) SampleConfig() string {
 }
 
 func (p *Ping) Gather(acc telegraf.Accumulator) error {
+	if !p.initialized {
+		if ignored := p.changedOptions(windowsOptions); len(ignored) > 0 {
+			log.Printf("W! [inputs.ping] %s not supported on Windows, ignoring them", strings.Join(ignored, ", "))
+		}
+		p.initialized = true
+	}
+
 	if p.Count < 1 {
 		p.Count = 1
 	}
@@ -116,7 +110,7 @@ func (p *Ping) pingToURL(u string, acc telegraf.Accumulator) {
 		// Combine go err + stderr output
 		pendingError = errors.New(strings.TrimSpace(out) + ", " + err.Error())
 	}
-	trans, recReply, receivePacket, avg, min, max, err := processPingOutput(out)
+	trans, recReply, receivePacket, avg, min, max, err := processPingOutputWindows(out)
 	if err != nil {
 		// fatal error
 		if pendingError != nil {
@@ -174,15 +168,19 @@ func (p *Ping) args(url string) []string {
 		args = append(args, "-w", strconv.FormatFloat(p.Timeout*1000, 'f', 0, 64))
 	}
 
+	if p.Size > 0 {
+		args = append(args, "-l", strconv.Itoa(p.Size))
+	}
+
 	args = append(args, url)
 
 	return args
 }
 
-// processPingOutput takes in a string output from the ping command
+// processPingOutputWindows takes in a string output from the ping.exe command
 // based on linux implementation but using regex ( multilanguage support )
 // It returns (<transmitted packets>, <received reply>, <received packet>, <average response>, <min response>, <max response>)
-func processPingOutput(out string) (int, int, int, int, int, int, error) {
+func processPingOutputWindows(out string) (int, int, int, int, int, int, error) {
 	// So find a line contain 3 numbers except reply lines
 	var stats, aproxs []string = nil, nil
 	err := errors.New("Fatal error processing ping output")
@@ -249,11 +247,8 @@ func (p *Ping) timeout() float64 {
 
 func init() {
 	inputs.Add("ping", func() telegraf.Input {
-		return &Ping{
-			pingHost:  hostPinger,
-			Count:     1,
-			Binary:    "ping",
-			Arguments: []string{},
-		}
+		p := newPing()
+		p.pingHost = hostPinger
+		return p
 	})
 }
@@ -1,3 +1,4 @@
+//go:build windows
 // +build windows
 
 package ping
@@ -42,7 +43,7 @@ Approximate round trip times in milli-seconds:
 `
 
 func TestHost(t *testing.T) {
-	trans, recReply, recPacket, avg, min, max, err := processPingOutput(winPLPingOutput)
+	trans, recReply, recPacket, avg, min, max, err := processPingOutputWindows(winPLPingOutput)
 	assert.NoError(t, err)
 	assert.Equal(t, 4, trans, "4 packets were transmitted")
 	assert.Equal(t, 4, recReply, "4 packets were reply")
@@ -51,7 +52,7 @@ func TestHost(t *testing.T) {
 	assert.Equal(t, 46, min, "Min 46")
 	assert.Equal(t, 57, max, "max 57")
 
-	trans, recReply, recPacket, avg, min, max, err = processPingOutput(winENPingOutput)
+	trans, recReply, recPacket, avg, min, max, err = processPingOutputWindows(winENPingOutput)
 	assert.NoError(t, err)
 	assert.Equal(t, 4, trans, "4 packets were transmitted")
 	assert.Equal(t, 4, recReply, "4 packets were reply")
@@ -142,6 +143,18 @@ func TestArguments(t *testing.T) {
 	require.True(t, reflect.DeepEqual(actual, arguments), "Expected : %s Actual: %s", arguments, actual)
 }
 
+func TestArgs(t *testing.T) {
+	p := Ping{
+		Count:   2,
+		Timeout: 1.5,
+		Size:    64,
+	}
+
+	actual := p.args("www.google.com")
+	expected := []string{"-n", "2", "-w", "1500", "-l", "64", "www.google.com"}
+	require.True(t, reflect.DeepEqual(expected, actual), "Expected : %s Actual: %s", expected, actual)
+}
+
 var lossyPingOutput = `
 Badanie thecodinglove.com [66.6.44.4] z 9800 bajtami danych:
 Upłynął limit czasu żądania.
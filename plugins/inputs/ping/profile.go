@@ -0,0 +1,93 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// checkProfiles validates the profiles
+func (p *Ping) checkProfiles() error {
+	names := make(map[string]bool, len(p.Profiles))
+	for _, prof := range p.Profiles {
+		if prof.Name == "" {
+			return fmt.Errorf("profile without a name")
+		}
+		if names[prof.Name] {
+			return fmt.Errorf("duplicate profile %q", prof.Name)
+		}
+		names[prof.Name] = true
+
+		if prof.Every < 0 || prof.Count < 0 || prof.Size < 0 {
+			return fmt.Errorf("profile %q: every, count and size must not be negative", prof.Name)
+		}
+		if prof.PingInterval > 0 && prof.PingInterval < p.MinPingInterval && p.Method != "tcp" {
+			return fmt.Errorf("profile %q: ping_interval %v is below min_ping_interval %v",
+				prof.Name, prof.PingInterval, p.MinPingInterval)
+		}
+	}
+	return nil
+}
+
+// activeProfile returns the first profile whose every divides the number of
+// the gather, counting from 1, or nil if none does
+func (p *Ping) activeProfile(gather int64) *profile {
+	for i := range p.Profiles {
+		every := int64(p.Profiles[i].Every)
+		if every <= 1 || gather%every == 0 {
+			return &p.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// useProfile applies the options of the profile active in the next gather and
+// returns an accumulator adding its name as the profile tag, along with a
+// function restoring the options of the plugin
+func (p *Ping) useProfile(acc telegraf.Accumulator) (telegraf.Accumulator, func()) {
+	p.gathers++
+	prof := p.activeProfile(p.gathers)
+	if prof == nil {
+		return acc, func() {}
+	}
+
+	count, interval, size := p.Count, p.PingInterval, p.Size
+	if prof.Count > 0 {
+		p.Count = prof.Count
+	}
+	if prof.PingInterval > 0 {
+		p.PingInterval = prof.PingInterval
+	}
+	if prof.Size > 0 {
+		p.Size = prof.Size
+	}
+	restore := func() {
+		p.Count, p.PingInterval, p.Size = count, interval, size
+	}
+	return &profileAccumulator{Accumulator: acc, name: prof.Name}, restore
+}
+
+// profileAccumulator adds the profile tag to every ping metric
+type profileAccumulator struct {
+	telegraf.Accumulator
+	name string
+}
+
+func (a *profileAccumulator) AddFields(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	if measurement == "ping" {
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags["profile"] = a.name
+	}
+	a.Accumulator.AddFields(measurement, fields, tags, t...)
+}
@@ -0,0 +1,97 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActiveProfile(t *testing.T) {
+	p := Ping{
+		Profiles: []profile{
+			{Name: "detailed", Every: 3},
+			{Name: "liveness"},
+		},
+	}
+
+	var names []string
+	for gather := int64(1); gather <= 6; gather++ {
+		names = append(names, p.activeProfile(gather).Name)
+	}
+	assert.Equal(t, []string{"liveness", "liveness", "detailed", "liveness", "liveness", "detailed"}, names)
+
+	p.Profiles = []profile{{Name: "detailed", Every: 3}}
+	assert.Nil(t, p.activeProfile(1))
+}
+
+func TestGatherProfiles(t *testing.T) {
+	var args [][]string
+	p := Ping{
+		Urls:         []string{"localhost"},
+		Count:        1,
+		PingInterval: 1.0,
+		Profiles: []profile{
+			{Name: "detailed", Every: 2, Count: 20, PingInterval: 0.5, Size: 56},
+		},
+		pingHost: func(binary string, timeout float64, a ...string) (string, error) {
+			args = append(args, a)
+			return linuxPingOutput, nil
+		},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(p.Gather))
+	require.NoError(t, acc.GatherError(p.Gather))
+	require.NoError(t, acc.GatherError(p.Gather))
+
+	require.Len(t, args, 3)
+	assert.Equal(t, []string{"-c", "1", "-n", "-s", "16", "-i", "1", "localhost"}, args[0])
+	assert.Equal(t, []string{"-c", "20", "-n", "-s", "56", "-i", "0.5", "localhost"}, args[1])
+	assert.Equal(t, args[0], args[2])
+
+	require.Len(t, acc.Metrics, 3)
+	assert.Equal(t, map[string]string{"url": "localhost"}, acc.Metrics[0].Tags)
+	assert.Equal(t, map[string]string{"url": "localhost", "profile": "detailed"}, acc.Metrics[1].Tags)
+	assert.Equal(t, map[string]string{"url": "localhost"}, acc.Metrics[2].Tags)
+}
+
+func TestCheckProfiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles []profile
+		expected string
+	}{
+		{
+			name:     "no name",
+			profiles: []profile{{Count: 5}},
+			expected: "profile without a name",
+		},
+		{
+			name:     "duplicate",
+			profiles: []profile{{Name: "a"}, {Name: "a"}},
+			expected: `duplicate profile "a"`,
+		},
+		{
+			name:     "negative",
+			profiles: []profile{{Name: "a", Every: -1}},
+			expected: `profile "a": every, count and size must not be negative`,
+		},
+		{
+			name:     "interval",
+			profiles: []profile{{Name: "a", PingInterval: 0.01}},
+			expected: `profile "a": ping_interval 0.01 is below min_ping_interval 0.2`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Ping{MinPingInterval: 0.2, Profiles: tt.profiles}
+			require.EqualError(t, p.checkProfiles(), tt.expected)
+		})
+	}
+}
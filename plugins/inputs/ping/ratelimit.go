@@ -0,0 +1,60 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+)
+
+// rateLimited returns true if the loss of a probe at the configured interval
+// is explained by ICMP rate limiting of the target, that is if a slower probe
+// loses at most half as many packets
+func rateLimited(loss, slowLoss float64) bool {
+	return loss > 0 && slowLoss <= loss/2
+}
+
+// slowProbeLoss pings u again from iface at rate_limit_probe_interval and
+// returns the percentage of packets lost
+func (p *Ping) slowProbeLoss(u, iface string) (float64, error) {
+	args := withInterval(p.interfaceArgs(u, runtime.GOOS, iface), p.RateLimitProbeInterval)
+	totalTimeout := float64(p.Count)*p.Timeout + float64(p.Count-1)*p.RateLimitProbeInterval
+
+	out, err := p.pingHost(p.binary(), p.commandTimeout(totalTimeout), args...)
+	trans, rec, _, _, _, _, _, parseErr := processPingOutput(out)
+	if parseErr != nil {
+		if err != nil {
+			return 0, err
+		}
+		return 0, parseErr
+	}
+	if trans == 0 {
+		return 0, fmt.Errorf("no packets transmitted")
+	}
+	return float64(trans-rec) / float64(trans) * 100.0, nil
+}
+
+// withInterval returns ping arguments with the interval between packets
+// replaced by interval
+func withInterval(args []string, interval float64) []string {
+	value := strconv.FormatFloat(interval, 'f', -1, 64)
+	result := make([]string, 0, len(args)+2)
+	replaced := false
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-i" && i+1 < len(args) {
+			result = append(result, "-i", value)
+			replaced = true
+			i++
+			continue
+		}
+		result = append(result, args[i])
+	}
+	if !replaced {
+		// the url is the last argument
+		last := len(result) - 1
+		result = append(result[:last], "-i", value, args[len(args)-1])
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimited(t *testing.T) {
+	tests := []struct {
+		loss     float64
+		slowLoss float64
+		expected bool
+	}{
+		{loss: 0, slowLoss: 0, expected: false},
+		{loss: 40, slowLoss: 0, expected: true},
+		{loss: 40, slowLoss: 20, expected: true},
+		{loss: 40, slowLoss: 30, expected: false},
+		{loss: 40, slowLoss: 40, expected: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, rateLimited(tt.loss, tt.slowLoss),
+			"loss %v, slow loss %v", tt.loss, tt.slowLoss)
+	}
+}
+
+func TestWithInterval(t *testing.T) {
+	assert.Equal(t,
+		[]string{"-c", "5", "-i", "1", "-W", "1", "example.org"},
+		withInterval([]string{"-c", "5", "-i", "0.2", "-W", "1", "example.org"}, 1))
+	assert.Equal(t,
+		[]string{"-c", "5", "-i", "2.5", "example.org"},
+		withInterval([]string{"-c", "5", "example.org"}, 2.5))
+}
+
+// pingOutputWithLoss returns ping output for 10 packets of which lost are lost
+func pingOutputWithLoss(lost int) string {
+	return fmt.Sprintf(`
+--- www.google.com ping statistics ---
+10 packets transmitted, %d received, %d%% packet loss, time 9000ms
+rtt min/avg/max/mdev = 35.225/43.628/51.806/5.325 ms
+`, 10-lost, lost*10)
+}
+
+func TestPingGatherRateLimited(t *testing.T) {
+	tests := []struct {
+		name     string
+		fastLost int
+		slowLost int
+		expected bool
+	}{
+		// a target policing ICMP loses fewer packets when pinged slower
+		{name: "loss scales with rate", fastLost: 4, slowLost: 0, expected: true},
+		// genuine loss does not depend on the send rate
+		{name: "loss independent of rate", fastLost: 4, slowLost: 4, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var acc testutil.Accumulator
+			p := Ping{
+				Urls:                   []string{"www.google.com"},
+				Count:                  10,
+				PingInterval:           0.2,
+				DetectRateLimiting:     true,
+				RateLimitProbeInterval: 1,
+				pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+					for i, arg := range args {
+						if arg == "-i" && args[i+1] == "1" {
+							return pingOutputWithLoss(tt.slowLost), nil
+						}
+					}
+					return pingOutputWithLoss(tt.fastLost), nil
+				},
+			}
+			require.NoError(t, acc.GatherError(p.Gather))
+
+			tags := map[string]string{"url": "www.google.com"}
+			assert.True(t, acc.HasPoint("ping", tags, "percent_packet_loss", 40.0))
+			assert.True(t, acc.HasPoint("ping", tags, "rate_limited", tt.expected))
+		})
+	}
+}
+
+func TestPingGatherRateLimitedNoLoss(t *testing.T) {
+	var acc testutil.Accumulator
+	probes := 0
+	p := Ping{
+		Urls:                   []string{"www.google.com"},
+		Count:                  10,
+		DetectRateLimiting:     true,
+		RateLimitProbeInterval: 1,
+		pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+			probes++
+			return pingOutputWithLoss(0), nil
+		},
+	}
+	require.NoError(t, acc.GatherError(p.Gather))
+
+	assert.Equal(t, 1, probes)
+	assert.True(t, acc.HasPoint("ping", map[string]string{"url": "www.google.com"}, "rate_limited", false))
+}
+
+func TestRateLimitProbeIntervalTooSmall(t *testing.T) {
+	p := Ping{
+		PingInterval:           1,
+		DetectRateLimiting:     true,
+		RateLimitProbeInterval: 1,
+	}
+	require.Error(t, p.initialize())
+}
@@ -0,0 +1,122 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// tcpResultCodes are the result codes of a url none of whose connections
+// succeeded, by the error_type of the last failed connection
+var tcpResultCodes = map[string]int{
+	"other":       2,
+	"refused":     3,
+	"timeout":     4,
+	"unreachable": 5,
+}
+
+// tcpErrorType classifies the error of a failed connection as "refused",
+// "timeout", "unreachable" or "other"
+func tcpErrorType(err error) string {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return "timeout"
+	}
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	switch err {
+	case syscall.ECONNREFUSED:
+		return "refused"
+	case syscall.ETIMEDOUT:
+		return "timeout"
+	case syscall.EHOSTUNREACH, syscall.ENETUNREACH:
+		return "unreachable"
+	}
+	return "other"
+}
+
+// tcpPingToURL times count TCP connections to a url and adds the same metric
+// as pingToURL, a failed connection counts as a lost packet. The added fields
+// are also returned.
+func (p *Ping) tcpPingToURL(u string, acc telegraf.Accumulator) map[string]interface{} {
+	tags := p.urlTags(u)
+	fields := map[string]interface{}{"result_code": 0}
+
+	host, port, err := splitHostPort(u)
+	if err == nil && port == 0 {
+		port = p.TCPPort
+		if port == 0 {
+			err = fmt.Errorf("no port, set tcp_port or use host:port")
+		}
+	}
+	if err != nil {
+		acc.AddError(fmt.Errorf("host %s: %s", u, err))
+		fields["result_code"] = 2
+		acc.AddFields("ping", fields, tags)
+		return fields
+	}
+
+	if _, err := p.lookupHost(host, fields); err != nil {
+		acc.AddError(err)
+		fields["result_code"] = 1
+		acc.AddFields("ping", fields, tags)
+		return fields
+	}
+
+	count := p.Count
+	if count < 1 {
+		count = 1
+	}
+	dialer := net.Dialer{
+		Timeout: time.Duration(p.Timeout * float64(time.Second)),
+		Control: markControl(p.FirewallMark),
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	var rtts []float64
+	var errorType string
+	refused := false
+	for i := 0; i < count; i++ {
+		if i > 0 && p.PingInterval > 0 {
+			time.Sleep(time.Duration(p.PingInterval * float64(time.Second)))
+		}
+
+		start := time.Now()
+		conn, err := dialer.Dial("tcp", addr)
+		if err != nil {
+			errorType = tcpErrorType(err)
+			refused = refused || errorType == "refused"
+			continue
+		}
+		rtts = append(rtts, float64(time.Since(start))/float64(time.Millisecond))
+		conn.Close()
+	}
+
+	fields["packets_transmitted"] = count
+	fields["packets_received"] = len(rtts)
+	fields["percent_packet_loss"] = float64(count-len(rtts)) / float64(count) * 100.0
+	// A refused connection is answered by the host, so it is up even though
+	// the port is closed
+	fields["reachable"] = len(rtts) > 0 || refused
+	if len(rtts) == 0 {
+		tags["error_type"] = errorType
+		fields["result_code"] = tcpResultCodes[errorType]
+	}
+	if len(rtts) > 0 {
+		min, avg, max, stddev := rttStats(rtts)
+		p.addResponseFields(fields, min, avg, max, stddev)
+	}
+	acc.AddFields("ping", fields, tags)
+	return fields
+}
@@ -0,0 +1,177 @@
+//go:build !windows
+// +build !windows
+
+package ping
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitHostPort(t *testing.T) {
+	tests := []struct {
+		url  string
+		host string
+		port int
+		err  bool
+	}{
+		{url: "db.example.com", host: "db.example.com"},
+		{url: "db.example.com:5432", host: "db.example.com", port: 5432},
+		{url: "127.0.0.1:80", host: "127.0.0.1", port: 80},
+		{url: "::1", host: "::1"},
+		{url: "fe80::1:2", host: "fe80::1:2"},
+		{url: "[::1]", host: "::1"},
+		{url: "[::1]:443", host: "::1", port: 443},
+		{url: "db.example.com:http", err: true},
+		{url: "db.example.com:0", err: true},
+		{url: "db.example.com:65536", err: true},
+		{url: "[::1]:", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			host, port, err := splitHostPort(tt.url)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.host, host)
+			assert.Equal(t, tt.port, port)
+		})
+	}
+}
+
+func TestTCPGather(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	n, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:       []string{"127.0.0.1", "localhost:" + port},
+		Method:     "tcp",
+		TCPPort:    n,
+		Count:      2,
+		Timeout:    1,
+		OutputUnit: "ms",
+	}
+	require.NoError(t, acc.GatherError(p.Gather))
+
+	for _, url := range p.Urls {
+		tags := map[string]string{"url": url}
+		assert.True(t, acc.HasPoint("ping", tags, "packets_transmitted", 2))
+		assert.True(t, acc.HasPoint("ping", tags, "packets_received", 2))
+		assert.True(t, acc.HasPoint("ping", tags, "percent_packet_loss", 0.0))
+		assert.True(t, acc.HasPoint("ping", tags, "result_code", 0))
+		assert.True(t, acc.HasFloatField("ping", "average_response_ms"))
+	}
+}
+
+func TestTCPGatherNoPort(t *testing.T) {
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:   []string{"localhost"},
+		Method: "tcp",
+		Count:  1,
+	}
+	acc.GatherError(p.Gather)
+
+	assert.True(t, len(acc.Errors) > 0)
+	assert.True(t, acc.HasPoint("ping", map[string]string{"url": "localhost"}, "result_code", 2))
+}
+
+func TestPortRejectedWithICMP(t *testing.T) {
+	for _, method := range []string{"exec", "fping"} {
+		var acc testutil.Accumulator
+		p := Ping{
+			Urls:   []string{"localhost:80"},
+			Method: method,
+			pingHost: func(binary string, timeout float64, args ...string) (string, error) {
+				t.Errorf("%s: ping should not run for a url with a port", method)
+				return "", nil
+			},
+		}
+		acc.GatherError(p.Gather)
+
+		require.Len(t, acc.Errors, 1)
+		assert.Contains(t, acc.Errors[0].Error(), `a port is only supported with method = "tcp"`)
+		assert.True(t, acc.HasPoint("ping", map[string]string{"url": "localhost:80"}, "result_code", 2))
+	}
+}
+
+func TestTCPGatherRefused(t *testing.T) {
+	// Listen to find a free port and close it again, so that connections
+	// to it are refused
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	var acc testutil.Accumulator
+	p := Ping{
+		Urls:    []string{addr},
+		Method:  "tcp",
+		Count:   2,
+		Timeout: 1,
+	}
+	require.NoError(t, acc.GatherError(p.Gather))
+
+	tags := map[string]string{"url": addr, "error_type": "refused"}
+	assert.True(t, acc.HasPoint("ping", tags, "packets_received", 0))
+	assert.True(t, acc.HasPoint("ping", tags, "result_code", 3))
+	assert.True(t, acc.HasPoint("ping", tags, "reachable", true))
+}
+
+func TestTCPErrorType(t *testing.T) {
+	opErr := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: err}}
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "refused", err: opErr(syscall.ECONNREFUSED), expected: "refused"},
+		{name: "timed out", err: opErr(syscall.ETIMEDOUT), expected: "timeout"},
+		{name: "dial timeout", err: &net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}, expected: "timeout"},
+		{name: "no route", err: opErr(syscall.EHOSTUNREACH), expected: "unreachable"},
+		{name: "network unreachable", err: opErr(syscall.ENETUNREACH), expected: "unreachable"},
+		{name: "other", err: errors.New("too many open files"), expected: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tcpErrorType(tt.err))
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
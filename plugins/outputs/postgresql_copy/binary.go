@@ -0,0 +1,350 @@
+package postgresql_copy
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// binaryHeader starts the data of a COPY in binary format: the signature,
+// the flags and the length of the header extension.
+var binaryHeader = []byte("PGCOPY\n\xff\r\n\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+
+// binaryTrailer ends the data of a COPY in binary format.
+var binaryTrailer = []byte{0xff, 0xff}
+
+// postgresEpoch is the origin of binary timestamps.
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// binaryEncoder appends the binary representation of a non nil value to buf.
+type binaryEncoder func(buf []byte, value interface{}) ([]byte, error)
+
+// binaryEncoders are the encoders of the column types supported by the
+// binary format, keyed by normalized type name.
+var binaryEncoders = map[string]binaryEncoder{
+	"smallint":                    encodeInt(2),
+	"int2":                        encodeInt(2),
+	"integer":                     encodeInt(4),
+	"int":                         encodeInt(4),
+	"int4":                        encodeInt(4),
+	"bigint":                      encodeInt(8),
+	"int8":                        encodeInt(8),
+	"real":                        encodeFloat4,
+	"float4":                      encodeFloat4,
+	"double precision":            encodeFloat8,
+	"float8":                      encodeFloat8,
+	"numeric":                     encodeNumeric,
+	"decimal":                     encodeNumeric,
+	"boolean":                     encodeBool,
+	"bool":                        encodeBool,
+	"text":                        encodeText,
+	"character varying":           encodeText,
+	"varchar":                     encodeText,
+	"character":                   encodeText,
+	"char":                        encodeText,
+	"json":                        encodeText,
+	"jsonb":                       encodeJSONB,
+	"timestamp with time zone":    encodeTimestamp,
+	"timestamptz":                 encodeTimestamp,
+	"timestamp without time zone": encodeTimestamp,
+	"timestamp":                   encodeTimestamp,
+}
+
+// lookupBinaryEncoder returns the encoder of a column type, a domain of
+// domains being encoded as its base type.
+func lookupBinaryEncoder(dataType string, domains map[string]string) (binaryEncoder, error) {
+	for name, definition := range domains {
+		if dataType == quoteIdentifier(name) {
+			dataType = domainBaseType(definition)
+			break
+		}
+	}
+	encode, ok := binaryEncoders[normalizeType(dataType)]
+	if !ok {
+		return nil, fmt.Errorf("type %s is not supported with copy_format \"binary\"", dataType)
+	}
+	return encode, nil
+}
+
+// domainBaseType returns the type of a domain definition, the words before
+// its constraints or default.
+func domainBaseType(definition string) string {
+	var words []string
+	for _, word := range strings.Fields(definition) {
+		switch strings.ToUpper(word) {
+		case "CHECK", "CONSTRAINT", "NOT", "NULL", "DEFAULT", "COLLATE":
+			return strings.Join(words, " ")
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " ")
+}
+
+// appendBinaryRow appends the binary representation of a row of values to
+// buf, encoding every non nil value with the encoder of its column.
+func appendBinaryRow(buf []byte, values []interface{}, encoders []binaryEncoder) ([]byte, error) {
+	buf = appendInt16(buf, int16(len(values)))
+	for i, value := range values {
+		if value == nil {
+			buf = appendInt32(buf, -1)
+			continue
+		}
+
+		// the length is known once the value is encoded
+		start := len(buf)
+		buf = appendInt32(buf, 0)
+		var err error
+		buf, err = encoders[i](buf, value)
+		if err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint32(buf[start:], uint32(len(buf)-start-4))
+	}
+	return buf, nil
+}
+
+func encodeInt(size int) binaryEncoder {
+	min, max := int64(math.MinInt64), int64(math.MaxInt64)
+	switch size {
+	case 2:
+		min, max = math.MinInt16, math.MaxInt16
+	case 4:
+		min, max = math.MinInt32, math.MaxInt32
+	}
+
+	return func(buf []byte, value interface{}) ([]byte, error) {
+		var i int64
+		switch v := value.(type) {
+		case int64:
+			i = v
+		case uint64:
+			if v > uint64(max) {
+				return nil, fmt.Errorf("value %d out of range", v)
+			}
+			i = int64(v)
+		case string:
+			var err error
+			if i, err = strconv.ParseInt(strings.TrimSpace(v), 10, 64); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("cannot encode %T as integer", value)
+		}
+		if i < min || i > max {
+			return nil, fmt.Errorf("value %d out of range", i)
+		}
+
+		switch size {
+		case 2:
+			return appendInt16(buf, int16(i)), nil
+		case 4:
+			return appendInt32(buf, int32(i)), nil
+		default:
+			return appendInt64(buf, i), nil
+		}
+	}
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	default:
+		return 0, fmt.Errorf("cannot encode %T as float", value)
+	}
+}
+
+func encodeFloat4(buf []byte, value interface{}) ([]byte, error) {
+	f, err := toFloat(value)
+	if err != nil {
+		return nil, err
+	}
+	return appendInt32(buf, int32(math.Float32bits(float32(f)))), nil
+}
+
+func encodeFloat8(buf []byte, value interface{}) ([]byte, error) {
+	f, err := toFloat(value)
+	if err != nil {
+		return nil, err
+	}
+	return appendInt64(buf, int64(math.Float64bits(f))), nil
+}
+
+// encodeBool encodes a boolean, accepting the integers 0 and 1 and the
+// strings accepted by strconv.ParseBool like the text format does.
+func encodeBool(buf []byte, value interface{}) ([]byte, error) {
+	var b bool
+	switch v := value.(type) {
+	case bool:
+		b = v
+	case int64:
+		if v != 0 && v != 1 {
+			return nil, fmt.Errorf("cannot encode %d as boolean", v)
+		}
+		b = v == 1
+	case uint64:
+		if v > 1 {
+			return nil, fmt.Errorf("cannot encode %d as boolean", v)
+		}
+		b = v == 1
+	case string:
+		var err error
+		if b, err = strconv.ParseBool(strings.TrimSpace(v)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("cannot encode %T as boolean", value)
+	}
+	if b {
+		return append(buf, 1), nil
+	}
+	return append(buf, 0), nil
+}
+
+func encodeText(buf []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return append(buf, v...), nil
+	case time.Time:
+		return append(buf, v.UTC().Format(time.RFC3339Nano)...), nil
+	case int64:
+		return strconv.AppendInt(buf, v, 10), nil
+	case uint64:
+		return strconv.AppendUint(buf, v, 10), nil
+	case float64:
+		return strconv.AppendFloat(buf, v, 'f', -1, 64), nil
+	case bool:
+		return strconv.AppendBool(buf, v), nil
+	default:
+		if !isComposite(v) {
+			return nil, fmt.Errorf("cannot encode %T as text", value)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(buf, b...), nil
+	}
+}
+
+func encodeJSONB(buf []byte, value interface{}) ([]byte, error) {
+	// version of the jsonb binary format
+	return encodeText(append(buf, 1), value)
+}
+
+// encodeTimestamp encodes a time as microseconds since 2000-01-01 UTC, the
+// nanoseconds being truncated.
+func encodeTimestamp(buf []byte, value interface{}) ([]byte, error) {
+	t, ok := value.(time.Time)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T as timestamp", value)
+	}
+	micros := (t.Unix()-postgresEpoch.Unix())*1000000 + int64(t.Nanosecond()/1000)
+	return appendInt64(buf, micros), nil
+}
+
+var decimalNumber = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+
+// encodeNumeric encodes a number as a numeric: the number of base 10000
+// digits, the weight of the first digit, the sign, the number of decimal
+// digits after the point and the digits.
+func encodeNumeric(buf []byte, value interface{}) ([]byte, error) {
+	var s string
+	switch v := value.(type) {
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case uint64:
+		s = strconv.FormatUint(v, 10)
+	case float64:
+		if math.IsNaN(v) {
+			return append(appendInt16(appendInt16(buf, 0), 0), 0xc0, 0, 0, 0), nil
+		}
+		if math.IsInf(v, 0) {
+			return nil, fmt.Errorf("cannot encode %v as numeric", v)
+		}
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		s = strings.TrimSpace(v)
+		if !decimalNumber.MatchString(s) {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+				return nil, fmt.Errorf("cannot encode %q as numeric", v)
+			}
+			s = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	default:
+		return nil, fmt.Errorf("cannot encode %T as numeric", value)
+	}
+
+	var sign int16
+	if strings.HasPrefix(s, "-") {
+		sign = 0x4000
+		s = s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	scale := int16(len(fracPart))
+
+	// pad both parts to whole base 10000 digits around the point
+	if n := len(intPart) % 4; n > 0 {
+		intPart = strings.Repeat("0", 4-n) + intPart
+	}
+	if n := len(fracPart) % 4; n > 0 {
+		fracPart += strings.Repeat("0", 4-n)
+	}
+	all := intPart + fracPart
+	digits := make([]int16, len(all)/4)
+	for i := range digits {
+		d, _ := strconv.Atoi(all[i*4 : i*4+4])
+		digits[i] = int16(d)
+	}
+
+	weight := int16(len(intPart)/4) - 1
+	for len(digits) > 0 && digits[0] == 0 {
+		digits = digits[1:]
+		weight--
+	}
+	for len(digits) > 0 && digits[len(digits)-1] == 0 {
+		digits = digits[:len(digits)-1]
+	}
+	if len(digits) == 0 {
+		weight, sign = 0, 0
+	}
+
+	buf = appendInt16(buf, int16(len(digits)))
+	buf = appendInt16(buf, weight)
+	buf = appendInt16(buf, sign)
+	buf = appendInt16(buf, scale)
+	for _, d := range digits {
+		buf = appendInt16(buf, d)
+	}
+	return buf, nil
+}
+
+func appendInt16(buf []byte, v int16) []byte {
+	return append(buf, byte(uint16(v)>>8), byte(v))
+}
+
+func appendInt32(buf []byte, v int32) []byte {
+	u := uint32(v)
+	return append(buf, byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+}
+
+func appendInt64(buf []byte, v int64) []byte {
+	u := uint64(v)
+	return append(buf, byte(u>>56), byte(u>>48), byte(u>>40), byte(u>>32),
+		byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+}
@@ -0,0 +1,232 @@
+package postgresql_copy
+
+import (
+	"encoding/binary"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/jackc/pgx/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeNumeric(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{value: int64(0), expected: "0"},
+		{value: int64(-42), expected: "-42"},
+		{value: int64(10000), expected: "10000"},
+		{value: uint64(18446744073709551615), expected: "18446744073709551615"},
+		{value: 123.45, expected: "123.45"},
+		{value: -0.0001, expected: "-0.0001"},
+		{value: 12345678.9, expected: "12345678.9"},
+		{value: "1e-7", expected: "0.0000001"},
+		{value: "99999.00001", expected: "99999.00001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			buf, err := encodeNumeric(nil, tt.value)
+			require.NoError(t, err)
+
+			var n pgtype.Numeric
+			require.NoError(t, n.DecodeBinary(nil, buf))
+			actual := new(big.Rat).SetInt(n.Int)
+			exp := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(n.Exp))), nil))
+			if n.Exp < 0 {
+				actual.Quo(actual, exp)
+			} else {
+				actual.Mul(actual, exp)
+			}
+			expected, ok := new(big.Rat).SetString(tt.expected)
+			require.True(t, ok)
+			require.Equal(t, expected.String(), actual.String())
+		})
+	}
+
+	_, err := encodeNumeric(nil, math.Inf(1))
+	require.Error(t, err)
+	_, err = encodeNumeric(nil, "x")
+	require.Error(t, err)
+}
+
+func abs(i int32) int32 {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+func TestBinaryEncoders(t *testing.T) {
+	ts := time.Date(2019, 6, 1, 12, 30, 45, 123456789, time.UTC)
+
+	buf, err := encodeTimestamp(nil, ts)
+	require.NoError(t, err)
+	var tz pgtype.Timestamptz
+	require.NoError(t, tz.DecodeBinary(nil, buf))
+	require.Equal(t, ts.Truncate(time.Microsecond), tz.Time.UTC())
+
+	buf, err = encodeFloat8(nil, 0.1)
+	require.NoError(t, err)
+	var f8 pgtype.Float8
+	require.NoError(t, f8.DecodeBinary(nil, buf))
+	require.Equal(t, 0.1, f8.Float)
+
+	buf, err = encodeInt(8)(nil, int64(-9007199254740993))
+	require.NoError(t, err)
+	var i8 pgtype.Int8
+	require.NoError(t, i8.DecodeBinary(nil, buf))
+	require.Equal(t, int64(-9007199254740993), i8.Int)
+
+	buf, err = encodeInt(2)(nil, int64(-300))
+	require.NoError(t, err)
+	var i2 pgtype.Int2
+	require.NoError(t, i2.DecodeBinary(nil, buf))
+	require.Equal(t, int16(-300), i2.Int)
+
+	_, err = encodeInt(4)(nil, int64(math.MaxInt32)+1)
+	require.Error(t, err)
+	_, err = encodeInt(8)(nil, uint64(math.MaxUint64))
+	require.Error(t, err)
+	_, err = encodeInt(8)(nil, 1.5)
+	require.Error(t, err)
+
+	buf, err = encodeBool(nil, true)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, buf)
+	buf, err = encodeBool(nil, int64(0))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0}, buf)
+	buf, err = encodeBool(nil, uint64(1))
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, buf)
+	_, err = encodeBool(nil, int64(2))
+	require.Error(t, err)
+
+	buf, err = encodeJSONB(nil, `{"host":"a"}`)
+	require.NoError(t, err)
+	var j pgtype.JSONB
+	require.NoError(t, j.DecodeBinary(nil, buf))
+	require.Equal(t, `{"host":"a"}`, string(j.Bytes))
+}
+
+func TestLookupBinaryEncoder(t *testing.T) {
+	domains := map[string]string{"percentage": "double precision CHECK (VALUE BETWEEN 0 AND 100)"}
+	for _, dataType := range []string{"bigint", "timestamp with time zone", "numeric(10,2)", "character varying(20)", `"percentage"`} {
+		_, err := lookupBinaryEncoder(dataType, domains)
+		require.NoError(t, err, dataType)
+	}
+
+	_, err := lookupBinaryEncoder("inet", domains)
+	require.EqualError(t, err, `type inet is not supported with copy_format "binary"`)
+}
+
+func TestWriteBinary(t *testing.T) {
+	c := &fakeConn{
+		tables: map[string]map[string]string{
+			"cpu": {
+				"time":  "timestamp with time zone",
+				"host":  "text",
+				"usage": "double precision",
+				"count": "bigint",
+			},
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.CopyFormat = "binary"
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 0.1},
+			time.Unix(946684800, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	require.Len(t, c.copies, 1)
+	require.Equal(t, `COPY "cpu" ("time", "host", "usage") FROM STDIN WITH (FORMAT binary)`, c.copies[0].query)
+
+	data := []byte(c.copies[0].data)
+	require.Equal(t, binaryHeader, data[:len(binaryHeader)])
+	data = data[len(binaryHeader):]
+	require.Equal(t, binaryTrailer, data[len(data)-2:])
+	data = data[:len(data)-2]
+
+	expected := []byte{0, 3}
+	expected = append(expected, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0)
+	expected = append(expected, 0, 0, 0, 1, 'a')
+	expected = append(expected, 0, 0, 0, 8)
+	bits := make([]byte, 8)
+	binary.BigEndian.PutUint64(bits, math.Float64bits(0.1))
+	expected = append(expected, bits...)
+	require.Equal(t, expected, data)
+}
+
+func TestWriteBoolean(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("ping",
+			map[string]string{},
+			map[string]interface{}{"up": true},
+			time.Unix(946684800, 0)),
+		testutil.MustMetric("ping",
+			map[string]string{},
+			map[string]interface{}{"up": false},
+			time.Unix(946684800, 0)),
+	}
+
+	for _, format := range []string{"text", "binary"} {
+		t.Run(format, func(t *testing.T) {
+			c := &fakeConn{}
+			p := newTestPostgresqlCopy(c)
+			p.AutoCreate = true
+			p.CopyFormat = format
+
+			require.NoError(t, p.Write(metrics))
+			require.Equal(t, []string{`CREATE TABLE IF NOT EXISTS "ping" ("time" timestamptz, "up" boolean)`}, c.execs)
+			require.Len(t, c.copies, 1)
+
+			if format == "text" {
+				require.Equal(t, "2000-01-01T00:00:00Z\ttrue\n2000-01-01T00:00:00Z\tfalse\n", c.copies[0].data)
+				return
+			}
+			data := []byte(c.copies[0].data)
+			data = data[len(binaryHeader) : len(data)-len(binaryTrailer)]
+			row := []byte{0, 2, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+			var expected []byte
+			expected = append(append(expected, row...), 1)
+			expected = append(append(expected, row...), 0)
+			require.Equal(t, expected, data)
+		})
+	}
+}
+
+func TestWriteBinaryUnsupportedType(t *testing.T) {
+	c := &fakeConn{
+		tables: map[string]map[string]string{
+			"cpu": {
+				"time": "timestamp with time zone",
+				"host": "inet",
+			},
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.CopyFormat = "binary"
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "10.0.0.1"},
+			map[string]interface{}{},
+			time.Unix(0, 0)),
+	}
+	require.EqualError(t, p.Write(metrics),
+		`copying into table cpu: column host of table cpu: type inet is not supported with copy_format "binary"`)
+}
+
+func TestConnectInvalidCopyFormat(t *testing.T) {
+	p := &PostgresqlCopy{CopyFormat: "csv"}
+	require.EqualError(t, p.Connect(), `invalid copy_format "csv", must be "text" or "binary"`)
+}
@@ -0,0 +1,82 @@
+package postgresql_copy
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// writeBuffer holds the metrics accepted by Write until they are flushed,
+// every flush_interval or once flush_buffer_size metrics are buffered. It is
+// locked for the duration of a flush so that metrics are written in order.
+type writeBuffer struct {
+	sync.Mutex
+	metrics []telegraf.Metric
+	// failed is set when the last flush failed, the next Write then flushes
+	// instead of accepting more metrics, so that the buffer does not grow
+	// while the database is unavailable.
+	failed bool
+}
+
+// bufferWrite adds metrics to the buffer, flushing it if it is full or the
+// last flush failed. When that flush fails the metrics of this Write are
+// removed from the buffer again and the error is returned, so that Telegraf
+// keeps them, while the metrics accepted by earlier writes stay buffered.
+func (p *PostgresqlCopy) bufferWrite(metrics []telegraf.Metric) error {
+	b := p.buffer
+	b.Lock()
+	defer b.Unlock()
+
+	accepted := len(b.metrics)
+	b.metrics = append(b.metrics, metrics...)
+	if !b.failed && (p.FlushBufferSize <= 0 || len(b.metrics) < p.FlushBufferSize) {
+		return nil
+	}
+
+	if err := p.write(b.metrics); err != nil {
+		b.metrics = b.metrics[:accepted]
+		b.failed = true
+		return err
+	}
+	b.metrics = nil
+	b.failed = false
+	return nil
+}
+
+// flushBuffer writes all buffered metrics. They stay buffered if the write
+// fails.
+func (p *PostgresqlCopy) flushBuffer() error {
+	b := p.buffer
+	b.Lock()
+	defer b.Unlock()
+
+	if len(b.metrics) == 0 {
+		return nil
+	}
+	if err := p.write(b.metrics); err != nil {
+		b.failed = true
+		return err
+	}
+	b.metrics = nil
+	b.failed = false
+	return nil
+}
+
+// flushLoop flushes the buffer every interval until done is closed.
+func (p *PostgresqlCopy) flushLoop(interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := p.flushBuffer(); err != nil {
+				log.Printf("E! [outputs.postgresql_copy] Flushing buffered metrics failed, retrying on next write: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package postgresql_copy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func bufferMetric(usage float64) []telegraf.Metric {
+	return []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": usage},
+			time.Unix(0, 0)),
+	}
+}
+
+func TestBufferWriteSize(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.FlushBufferSize = 3
+	p.buffer = &writeBuffer{}
+
+	require.NoError(t, p.Write(bufferMetric(1)))
+	require.NoError(t, p.Write(bufferMetric(2)))
+	require.Empty(t, c.copies)
+
+	require.NoError(t, p.Write(bufferMetric(3)))
+	require.Len(t, c.copies, 1)
+	require.Equal(t, 3, strings.Count(c.copies[0].data, "\n"))
+	require.Empty(t, p.buffer.metrics)
+}
+
+func TestBufferWriteFailed(t *testing.T) {
+	fail := true
+	c := &fakeConn{
+		copyErr: func(data string) error {
+			if fail {
+				return errors.New("disk full")
+			}
+			return nil
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.FlushBufferSize = 2
+	p.buffer = &writeBuffer{}
+
+	require.NoError(t, p.Write(bufferMetric(1)))
+	// the metrics of the failed write are left to Telegraf
+	require.EqualError(t, p.Write(bufferMetric(2)), "copying into table cpu: disk full")
+	require.Len(t, p.buffer.metrics, 1)
+
+	// the next write flushes even though the buffer is not full
+	fail = false
+	require.NoError(t, p.Write(bufferMetric(2)))
+	require.Len(t, c.copies, 1)
+	require.Equal(t, "1970-01-01T00:00:00Z\t1\n1970-01-01T00:00:00Z\t2\n", c.copies[0].data)
+	require.False(t, p.buffer.failed)
+}
+
+func TestBufferFlushInterval(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.FlushInterval = internal.Duration{Duration: 10 * time.Millisecond}
+	p.buffer = &writeBuffer{}
+	p.done = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.flushLoop(p.FlushInterval.Duration, p.done)
+	}()
+
+	require.NoError(t, p.Write(bufferMetric(1)))
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.Lock()
+		n := len(c.copies)
+		c.Unlock()
+		if n == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, p.Close())
+	require.Len(t, c.copies, 1)
+}
+
+func TestBufferClose(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.FlushInterval = internal.Duration{Duration: time.Hour}
+	p.buffer = &writeBuffer{}
+
+	require.NoError(t, p.Write(bufferMetric(1)))
+	require.NoError(t, p.Write(bufferMetric(2)))
+	require.Empty(t, c.copies)
+
+	require.NoError(t, p.Close())
+	require.Len(t, c.copies, 1)
+	require.Equal(t, 2, strings.Count(c.copies[0].data, "\n"))
+}
+
+func TestBufferCloseReleases(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	acquired := 0
+	p.acquire = func() (conn, error) {
+		acquired++
+		return c, nil
+	}
+	p.FlushInterval = internal.Duration{Duration: time.Hour}
+	p.buffer = &writeBuffer{}
+	p.done = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.flushLoop(p.FlushInterval.Duration, p.done)
+	}()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, p.Write(bufferMetric(float64(i))))
+	}
+	require.NoError(t, p.Close())
+	require.Len(t, c.copies, 1)
+	require.Equal(t, 5, strings.Count(c.copies[0].data, "\n"))
+	require.Equal(t, 1, acquired)
+	require.Equal(t, acquired, c.released)
+
+	// closing again neither writes nor blocks on the stopped flush loop
+	require.NoError(t, p.Close())
+	require.Len(t, c.copies, 1)
+}
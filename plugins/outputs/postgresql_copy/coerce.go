@@ -0,0 +1,192 @@
+package postgresql_copy
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// typeKind is the kind of values a column type of column_types holds.
+type typeKind int
+
+const (
+	// kindOther is a type values are written to unchanged.
+	kindOther typeKind = iota
+	kindInteger
+	kindFloat
+	kindNumeric
+	kindBoolean
+	kindText
+)
+
+var typeKinds = map[string]typeKind{
+	"smallint":          kindInteger,
+	"int2":              kindInteger,
+	"integer":           kindInteger,
+	"int":               kindInteger,
+	"int4":              kindInteger,
+	"bigint":            kindInteger,
+	"int8":              kindInteger,
+	"real":              kindFloat,
+	"float4":            kindFloat,
+	"float":             kindFloat,
+	"float8":            kindFloat,
+	"double precision":  kindFloat,
+	"numeric":           kindNumeric,
+	"decimal":           kindNumeric,
+	"boolean":           kindBoolean,
+	"bool":              kindBoolean,
+	"text":              kindText,
+	"varchar":           kindText,
+	"character varying": kindText,
+	"char":              kindText,
+	"character":         kindText,
+}
+
+// lookupTypeKind returns the kind of a column type.
+func lookupTypeKind(dataType string) typeKind {
+	return typeKinds[normalizeType(dataType)]
+}
+
+// normalizeType returns the lowercase name of a column type without its
+// modifiers, like the precision of numeric(10,2), and with single spaces.
+func normalizeType(dataType string) string {
+	name := strings.ToLower(dataType)
+	if i := strings.Index(name, "("); i >= 0 {
+		name = name[:i]
+	}
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// parseColumnTypes parses the column_types option into the kind of every
+// column.
+func parseColumnTypes(types map[string]string) (map[string]typeKind, error) {
+	kinds := make(map[string]typeKind, len(types))
+	for column, dataType := range types {
+		if strings.TrimSpace(dataType) == "" {
+			return nil, fmt.Errorf("column_types %s: empty type", column)
+		}
+		kinds[column] = lookupTypeKind(dataType)
+	}
+	return kinds, nil
+}
+
+// parseColumnLengths returns the length of the columns of column_types with a
+// character type of limited length, like 255 for varchar(255).
+func parseColumnLengths(types map[string]string) map[string]int {
+	lengths := make(map[string]int)
+	for column, dataType := range types {
+		if lookupTypeKind(dataType) != kindText {
+			continue
+		}
+		start, end := strings.Index(dataType, "("), strings.Index(dataType, ")")
+		if start < 0 || end < start {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(dataType[start+1 : end]))
+		if err == nil && n > 0 {
+			lengths[column] = n
+		}
+	}
+	return lengths
+}
+
+// truncateString returns the first length characters of s.
+func truncateString(s string, length int) string {
+	if utf8.RuneCountInString(s) <= length {
+		return s
+	}
+	var n int
+	for i := range s {
+		if n == length {
+			return s[:i]
+		}
+		n++
+	}
+	return s
+}
+
+// coerceValue returns value as a value of kind. A value of another type is
+// converted if convert is set and the conversion is possible, otherwise
+// false is returned.
+func coerceValue(value interface{}, kind typeKind, convert bool) (interface{}, bool) {
+	if fitsKind(value, kind) {
+		return value, true
+	}
+	if !convert {
+		return nil, false
+	}
+
+	switch kind {
+	case kindInteger:
+		switch v := value.(type) {
+		case float64:
+			v = math.Round(v)
+			if v < math.MinInt64 || v >= math.MaxInt64 || math.IsNaN(v) {
+				return nil, false
+			}
+			return int64(v), true
+		case bool:
+			return boolToInt(v), true
+		case string:
+			i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			return i, err == nil
+		}
+	case kindFloat, kindNumeric:
+		switch v := value.(type) {
+		case bool:
+			return boolToInt(v), true
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			return f, err == nil
+		}
+	case kindBoolean:
+		switch v := value.(type) {
+		case int64:
+			return v != 0, true
+		case uint64:
+			return v != 0, true
+		case float64:
+			return v != 0, true
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			return b, err == nil
+		}
+	}
+	return nil, false
+}
+
+// fitsKind returns true if value can be written unchanged to a column of
+// kind.
+func fitsKind(value interface{}, kind typeKind) bool {
+	switch kind {
+	case kindInteger:
+		switch v := value.(type) {
+		case int64:
+			return true
+		case uint64:
+			return v <= math.MaxInt64
+		}
+		return false
+	case kindFloat, kindNumeric:
+		switch value.(type) {
+		case int64, uint64, float64:
+			return true
+		}
+		return false
+	case kindBoolean:
+		_, ok := value.(bool)
+		return ok
+	default:
+		return true
+	}
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,183 @@
+package postgresql_copy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupTypeKind(t *testing.T) {
+	require.Equal(t, kindInteger, lookupTypeKind("BIGINT"))
+	require.Equal(t, kindFloat, lookupTypeKind("double  precision"))
+	require.Equal(t, kindNumeric, lookupTypeKind("numeric(10,2)"))
+	require.Equal(t, kindText, lookupTypeKind("varchar(20)"))
+	require.Equal(t, kindOther, lookupTypeKind("inet"))
+}
+
+func TestCoerceValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		kind     typeKind
+		convert  bool
+		expected interface{}
+		ok       bool
+	}{
+		{name: "integer fits", value: int64(3), kind: kindInteger, expected: int64(3), ok: true},
+		{name: "unsigned fits", value: uint64(3), kind: kindInteger, expected: uint64(3), ok: true},
+		{name: "unsigned overflow", value: uint64(18446744073709551615), kind: kindInteger, convert: true},
+		{name: "float to integer", value: 2.6, kind: kindInteger, convert: true, expected: int64(3), ok: true},
+		{name: "float to integer dropped", value: 2.0, kind: kindInteger},
+		{name: "string to integer", value: "42", kind: kindInteger, convert: true, expected: int64(42), ok: true},
+		{name: "invalid string to integer", value: "x", kind: kindInteger, convert: true},
+		{name: "integer to float", value: int64(1), kind: kindFloat, expected: int64(1), ok: true},
+		{name: "bool to float", value: true, kind: kindFloat, convert: true, expected: int64(1), ok: true},
+		{name: "string to boolean", value: "true", kind: kindBoolean, convert: true, expected: true, ok: true},
+		{name: "integer to boolean", value: int64(0), kind: kindBoolean, convert: true, expected: false, ok: true},
+		{name: "anything to text", value: 1.5, kind: kindText, expected: 1.5, ok: true},
+		{name: "anything to other", value: "10.0.0.1", kind: kindOther, expected: "10.0.0.1", ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok := coerceValue(tt.value, tt.kind, tt.convert)
+			require.Equal(t, tt.ok, ok)
+			if ok {
+				require.Equal(t, tt.expected, value)
+			}
+		})
+	}
+}
+
+func TestAutoCreateColumnTypes(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+	p.ColumnTypes = map[string]string{"bytes": "bigint", "ratio": "double precision"}
+	kinds, err := parseColumnTypes(p.ColumnTypes)
+	require.NoError(t, err)
+	p.typeKinds = kinds
+	p.OnTypeError = "coerce"
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("net",
+			map[string]string{},
+			map[string]interface{}{"bytes": 1.0, "ratio": int64(1)},
+			time.Unix(0, 0)),
+		testutil.MustMetric("net",
+			map[string]string{},
+			map[string]interface{}{"bytes": int64(2), "ratio": 0.5},
+			time.Unix(1, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "net" ("time" timestamptz, "bytes" bigint, "ratio" double precision)`,
+	}, c.execs)
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "net" ("time", "bytes", "ratio") FROM STDIN`,
+		data: "1970-01-01T00:00:00Z\t1\t1\n" +
+			"1970-01-01T00:00:01Z\t2\t0.5\n",
+	}}, c.copies)
+}
+
+func TestWriteColumnTypesDrop(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	kinds, err := parseColumnTypes(map[string]string{"bytes": "bigint"})
+	require.NoError(t, err)
+	p.typeKinds = kinds
+	p.OnTypeError = "drop"
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("net",
+			map[string]string{},
+			map[string]interface{}{"bytes": 1.0},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "net" ("time", "bytes") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\t\\N\n",
+	}}, c.copies)
+}
+
+func TestConnectColumnTypes(t *testing.T) {
+	p := &PostgresqlCopy{OnTypeError: "ignore"}
+	require.EqualError(t, p.Connect(), `invalid on_type_error "ignore", must be "coerce" or "drop"`)
+
+	p = &PostgresqlCopy{
+		ColumnTypes:   map[string]string{"usage": "float8"},
+		ColumnDomains: map[string]string{"usage": "percentage"},
+	}
+	require.EqualError(t, p.Connect(), "column usage has both a column_types and a column_domains entry")
+
+	p = &PostgresqlCopy{ColumnTypes: map[string]string{"usage": " "}}
+	require.EqualError(t, p.Connect(), "column_types usage: empty type")
+
+	p = &PostgresqlCopy{OnStringOverflow: "ignore"}
+	require.EqualError(t, p.Connect(), `invalid on_string_overflow "ignore", must be "error", "truncate" or "drop"`)
+}
+
+func TestParseColumnLengths(t *testing.T) {
+	require.Equal(t, map[string]int{"host": 8, "code": 2}, parseColumnLengths(map[string]string{
+		"host":    "varchar(8)",
+		"code":    "character( 2 )",
+		"message": "text",
+		"ratio":   "numeric(10,2)",
+		"name":    "varchar",
+	}))
+}
+
+func TestTruncateString(t *testing.T) {
+	require.Equal(t, "abc", truncateString("abcdef", 3))
+	require.Equal(t, "abc", truncateString("abc", 3))
+	require.Equal(t, "héé", truncateString("hééllo", 3))
+}
+
+func TestWriteStringOverflow(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("log",
+			map[string]string{},
+			map[string]interface{}{"message": "too long"},
+			time.Unix(0, 0)),
+	}
+
+	tests := []struct {
+		policy   string
+		data     string
+		expected string
+	}{
+		{policy: "truncate", data: "1970-01-01T00:00:00Z\ttoo l\n"},
+		{policy: "drop", data: "1970-01-01T00:00:00Z\t\\N\n"},
+		{policy: "error", expected: "copying into table log: column message: value of 8 characters is longer than 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			c := &fakeConn{}
+			p := newTestPostgresqlCopy(c)
+			p.ColumnTypes = map[string]string{"message": "varchar(5)"}
+			kinds, err := parseColumnTypes(p.ColumnTypes)
+			require.NoError(t, err)
+			p.typeKinds = kinds
+			p.typeLengths = parseColumnLengths(p.ColumnTypes)
+			p.OnStringOverflow = tt.policy
+
+			err = p.Write(metrics)
+			if tt.expected != "" {
+				require.EqualError(t, err, tt.expected)
+				require.Empty(t, c.copies)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, []fakeCopy{{
+				query: `COPY "log" ("time", "message") FROM STDIN`,
+				data:  tt.data,
+			}}, c.copies)
+		})
+	}
+}
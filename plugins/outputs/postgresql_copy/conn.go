@@ -0,0 +1,140 @@
+package postgresql_copy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/stdlib"
+)
+
+// conn is a single database connection used for the duration of a Write.
+type conn interface {
+	// Exec runs a statement, discarding the rows it returns.
+	Exec(ctx context.Context, query string, args ...interface{}) error
+	// Columns returns the data type of every column of table in schema, the
+	// current schema if empty, keyed by the column name. Columns that cannot
+	// be written, identity columns GENERATED ALWAYS and generated columns,
+	// have the data type generatedType. It returns an empty map if the table
+	// does not exist.
+	Columns(ctx context.Context, schema, table string) (map[string]string, error)
+	// HasExtension returns true if the extension is installed in the
+	// database.
+	HasExtension(ctx context.Context, name string) (bool, error)
+	// HasSchema returns true if the schema exists in the database.
+	HasSchema(ctx context.Context, name string) (bool, error)
+	// Copy runs a COPY ... FROM STDIN statement reading the text formatted
+	// rows from r and returns the number of rows copied. A COPY still running
+	// once ctx is done is aborted and the connection is lost.
+	Copy(ctx context.Context, query string, r io.Reader) (int64, error)
+	// Alive returns false once the connection failed, the pool then replaces
+	// it with a new connection.
+	Alive() bool
+	// Release returns the connection to the pool.
+	Release() error
+}
+
+// pgxConn is a conn backed by a pgx connection acquired from a sql.DB pool.
+type pgxConn struct {
+	db      *sql.DB
+	conn    *pgx.Conn
+	dialect dialect
+	// options of the statements, set to use the simple protocol with
+	// pool_mode = "transaction"
+	options *pgx.QueryExOptions
+}
+
+// acquirePgxConn acquires a connection of db. With simpleProtocol the
+// statements with arguments are not prepared, as a statement prepared outside
+// of a transaction may not exist on the server connection a transaction
+// pooler runs it on.
+func acquirePgxConn(db *sql.DB, d dialect, simpleProtocol bool) (conn, error) {
+	c, err := stdlib.AcquireConn(db)
+	if err != nil {
+		return nil, err
+	}
+	pc := &pgxConn{db: db, conn: c, dialect: d}
+	if simpleProtocol {
+		pc.options = &pgx.QueryExOptions{SimpleProtocol: true}
+	}
+	return pc, nil
+}
+
+func (c *pgxConn) Exec(ctx context.Context, query string, args ...interface{}) error {
+	_, err := c.conn.ExecEx(ctx, query, c.options, args...)
+	return err
+}
+
+func (c *pgxConn) Columns(ctx context.Context, schema, table string) (map[string]string, error) {
+	rows, err := c.conn.QueryEx(ctx, c.dialect.columnsSQL(), c.options, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]string)
+	for rows.Next() {
+		var name, dataType string
+		var generated bool
+		if err := rows.Scan(&name, &dataType, &generated); err != nil {
+			return nil, err
+		}
+		if generated {
+			dataType = generatedType
+		}
+		columns[name] = dataType
+	}
+	return columns, rows.Err()
+}
+
+func (c *pgxConn) HasExtension(ctx context.Context, name string) (bool, error) {
+	var installed bool
+	err := c.conn.QueryRowEx(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = $1)", c.options, name).Scan(&installed)
+	return installed, err
+}
+
+func (c *pgxConn) HasSchema(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := c.conn.QueryRowEx(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1)", c.options, name).Scan(&exists)
+	return exists, err
+}
+
+func (c *pgxConn) Copy(ctx context.Context, query string, r io.Reader) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// CopyFromReader takes no context, a COPY still running once ctx is done
+	// is interrupted by closing the connection, which makes the server abort
+	// the statement
+	done := make(chan struct{})
+	closed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.conn.Close()
+			closed <- true
+		case <-done:
+			closed <- false
+		}
+	}()
+
+	tag, err := c.conn.CopyFromReader(r, query)
+	close(done)
+	if <-closed && err != nil {
+		return 0, fmt.Errorf("COPY aborted: %s", ctx.Err())
+	}
+	return tag.RowsAffected(), err
+}
+
+func (c *pgxConn) Alive() bool {
+	return c.conn.IsAlive()
+}
+
+func (c *pgxConn) Release() error {
+	return stdlib.ReleaseConn(c.db, c.conn)
+}
@@ -0,0 +1,74 @@
+package postgresql_copy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// dialect holds the differences between databases speaking the PostgreSQL
+// wire protocol. The zero value is the postgres dialect.
+type dialect struct {
+	// hiddenColumns is set when information_schema.columns lists columns
+	// that are not part of the table as written, like the rowid primary
+	// key CockroachDB adds to tables without one.
+	hiddenColumns bool
+	// copyOptions are added to the options of every COPY statement.
+	copyOptions []string
+}
+
+var dialects = map[string]dialect{
+	"postgres":  {},
+	"cockroach": {hiddenColumns: true},
+	// Without ROWS_PER_TRANSACTION older YugabyteDB versions copy a whole
+	// batch in one distributed transaction, which fails for large batches.
+	"yugabyte": {copyOptions: []string{"ROWS_PER_TRANSACTION 1000"}},
+}
+
+// lookupDialect returns the dialect of the dialect option, postgres if empty.
+func lookupDialect(name string) (dialect, error) {
+	if name == "" {
+		return dialect{}, nil
+	}
+	d, ok := dialects[name]
+	if !ok {
+		names := make([]string, 0, len(dialects))
+		for name := range dialects {
+			names = append(names, fmt.Sprintf("%q", name))
+		}
+		sort.Strings(names)
+		return dialect{}, fmt.Errorf("invalid dialect %q, must be one of %s", name, strings.Join(names, ", "))
+	}
+	return d, nil
+}
+
+// columnsSQL returns the query listing the columns of a table, their data
+// type and whether they are generated, its parameters are the schema, the
+// current schema if empty, and the table name.
+func (d dialect) columnsSQL() string {
+	query := `
+SELECT column_name, data_type,
+  COALESCE(is_generated = 'ALWAYS' OR identity_generation = 'ALWAYS', false)
+FROM information_schema.columns
+WHERE table_schema = COALESCE(NULLIF($1, ''), current_schema()) AND table_name = $2`
+	if d.hiddenColumns {
+		query += ` AND is_hidden = 'NO'`
+	}
+	return query
+}
+
+// copySQL returns the COPY statement of columns of table, in the text format
+// unless format is "binary".
+func (d dialect) copySQL(schema, table string, columns []string, format string) string {
+	query := "COPY " + quoteTable(schema, table) + " (" + strings.Join(quoteIdentifiers(columns), ", ") + ") FROM STDIN"
+
+	var options []string
+	if format == "binary" {
+		options = append(options, "FORMAT binary")
+	}
+	options = append(options, d.copyOptions...)
+	if len(options) > 0 {
+		query += " WITH (" + strings.Join(options, ", ") + ")"
+	}
+	return query
+}
@@ -0,0 +1,73 @@
+package postgresql_copy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupDialect(t *testing.T) {
+	d, err := lookupDialect("")
+	require.NoError(t, err)
+	require.Equal(t, dialect{}, d)
+
+	for name := range dialects {
+		_, err := lookupDialect(name)
+		require.NoError(t, err)
+	}
+
+	_, err = lookupDialect("mysql")
+	require.EqualError(t, err, `invalid dialect "mysql", must be one of "cockroach", "postgres", "yugabyte"`)
+}
+
+func TestDialectColumnsSQL(t *testing.T) {
+	require.NotContains(t, dialects["postgres"].columnsSQL(), "is_hidden")
+	require.NotContains(t, dialects["yugabyte"].columnsSQL(), "is_hidden")
+	require.Contains(t, dialects["cockroach"].columnsSQL(), "AND is_hidden = 'NO'")
+	require.Contains(t, dialects["postgres"].columnsSQL(), "identity_generation = 'ALWAYS'")
+}
+
+func TestWriteDialect(t *testing.T) {
+	tests := []struct {
+		dialect  string
+		expected string
+	}{
+		{"postgres", `COPY "cpu" ("time", "usage") FROM STDIN`},
+		{"cockroach", `COPY "cpu" ("time", "usage") FROM STDIN`},
+		{"yugabyte", `COPY "cpu" ("time", "usage") FROM STDIN WITH (ROWS_PER_TRANSACTION 1000)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			c := &fakeConn{}
+			p := newTestPostgresqlCopy(c)
+			p.dialect = dialects[tt.dialect]
+
+			metrics := []telegraf.Metric{
+				testutil.MustMetric("cpu",
+					map[string]string{},
+					map[string]interface{}{"usage": 1.5},
+					time.Unix(0, 0)),
+			}
+			require.NoError(t, p.Write(metrics))
+
+			require.Len(t, c.copies, 1)
+			require.Equal(t, tt.expected, c.copies[0].query)
+		})
+	}
+}
+
+func TestConnectInvalidDialect(t *testing.T) {
+	p := &PostgresqlCopy{Dialect: "mysql"}
+	require.Error(t, p.Connect())
+}
+
+func TestDialectCopySQLBinary(t *testing.T) {
+	require.Equal(t, `COPY "cpu" ("time", "usage") FROM STDIN WITH (FORMAT binary)`,
+		dialects["postgres"].copySQL("", "cpu", []string{"time", "usage"}, "binary"))
+	require.Equal(t, `COPY "cpu" ("time", "usage") FROM STDIN WITH (FORMAT binary, ROWS_PER_TRANSACTION 1000)`,
+		dialects["yugabyte"].copySQL("", "cpu", []string{"time", "usage"}, "binary"))
+}
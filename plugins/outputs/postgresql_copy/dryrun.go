@@ -0,0 +1,93 @@
+package postgresql_copy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"log"
+)
+
+// dryRunRows is the number of rows of a COPY logged with dry_run.
+const dryRunRows = 5
+
+// dryRunConn is the conn of dry_run, which logs the statements instead of
+// running them. Every table is reported as missing, so that the statements
+// creating it with auto_create are logged as well.
+type dryRunConn struct{}
+
+func (dryRunConn) Exec(ctx context.Context, query string, args ...interface{}) error {
+	if len(args) > 0 {
+		log.Printf("I! [outputs.postgresql_copy] Dry run: %s %v", query, args)
+	} else {
+		log.Printf("I! [outputs.postgresql_copy] Dry run: %s", query)
+	}
+	return nil
+}
+
+func (dryRunConn) Columns(ctx context.Context, schema, table string) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func (dryRunConn) HasExtension(ctx context.Context, name string) (bool, error) {
+	return true, nil
+}
+
+func (dryRunConn) HasSchema(ctx context.Context, name string) (bool, error) {
+	return true, nil
+}
+
+func (dryRunConn) Copy(ctx context.Context, query string, r io.Reader) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	n := copyRowCount(data)
+	log.Printf("I! [outputs.postgresql_copy] Dry run: %s (%d rows)", query, n)
+	if bytes.HasPrefix(data, binaryHeader) {
+		return n, nil
+	}
+	for i, row := range bytes.SplitN(data, []byte("\n"), dryRunRows+1) {
+		if i == dryRunRows || len(row) == 0 {
+			break
+		}
+		log.Printf("I! [outputs.postgresql_copy] Dry run: %s", row)
+	}
+	return n, nil
+}
+
+func (dryRunConn) Alive() bool {
+	return true
+}
+
+func (dryRunConn) Release() error {
+	return nil
+}
+
+// copyRowCount returns the number of rows of the data of a COPY, in the text
+// or binary format.
+func copyRowCount(data []byte) int64 {
+	if !bytes.HasPrefix(data, binaryHeader) {
+		return int64(bytes.Count(data, []byte("\n")))
+	}
+
+	var rows int64
+	data = data[len(binaryHeader):]
+	for len(data) >= 2 {
+		fields := int16(binary.BigEndian.Uint16(data))
+		data = data[2:]
+		if fields < 0 {
+			break
+		}
+		rows++
+		for i := int16(0); i < fields; i++ {
+			size := int32(binary.BigEndian.Uint32(data))
+			data = data[4:]
+			if size > 0 {
+				data = data[size:]
+			}
+		}
+	}
+	return rows
+}
@@ -0,0 +1,55 @@
+package postgresql_copy
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	p := outputs.Outputs["postgresql_copy"]().(*PostgresqlCopy)
+	p.Address = "host=db.invalid user=telegraf password=secret"
+	p.AutoCreate = true
+	p.DryRun = true
+	p.PoolStatsInterval.Duration = 0
+	require.NoError(t, p.Connect())
+	require.Nil(t, p.db)
+
+	var metrics []telegraf.Metric
+	for i := 0; i < 7; i++ {
+		metrics = append(metrics, testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": float64(i)},
+			time.Unix(int64(i), 0)))
+	}
+	require.NoError(t, p.Write(metrics))
+	require.NoError(t, p.Close())
+
+	out := buf.String()
+	require.Contains(t, out, `Dry run: CREATE TABLE IF NOT EXISTS "cpu" ("time" timestamptz, "host" text, "usage" float8)`)
+	require.Contains(t, out, `Dry run: COPY "cpu" ("time", "host", "usage") FROM STDIN (7 rows)`)
+	require.Contains(t, out, "Dry run: 1970-01-01T00:00:04Z\ta\t4\n")
+	require.NotContains(t, out, "1970-01-01T00:00:05Z")
+}
+
+func TestCopyRowCount(t *testing.T) {
+	require.Equal(t, int64(2), copyRowCount([]byte("1970-01-01T00:00:00Z\t1.5\n1970-01-01T00:00:01Z\ta\\nb\n")))
+
+	var data []byte
+	data = append(data, binaryHeader...)
+	data = append(data, 0, 2, 0, 0, 0, 1, 'a', 0xff, 0xff, 0xff, 0xff)
+	data = append(data, 0, 2, 0, 0, 0, 0, 0, 0, 0, 2, 'b', 'c')
+	data = append(data, binaryTrailer...)
+	require.Equal(t, int64(2), copyRowCount(data))
+}
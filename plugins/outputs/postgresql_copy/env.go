@@ -0,0 +1,160 @@
+package postgresql_copy
+
+import (
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// libpqEnv maps the environment variables of libpq to the connection string
+// parameters they provide a default for.
+var libpqEnv = [][2]string{
+	{"PGHOST", "host"},
+	{"PGPORT", "port"},
+	{"PGDATABASE", "dbname"},
+	{"PGUSER", "user"},
+	{"PGPASSWORD", "password"},
+	{"PGSSLMODE", "sslmode"},
+	{"PGSSLROOTCERT", "sslrootcert"},
+	{"PGSSLCERT", "sslcert"},
+	{"PGSSLKEY", "sslkey"},
+	{"PGCONNECT_TIMEOUT", "connect_timeout"},
+	{"PGAPPNAME", "application_name"},
+}
+
+// getenv returns the value of an environment variable, it is replaced by
+// tests.
+var getenv = os.Getenv
+
+var (
+	dsnParam      = regexp.MustCompile(`([a-zA-Z_]+)\s*=`)
+	dsnValueParam = regexp.MustCompile(`([a-zA-Z_]+)\s*=\s*('[^']*'|\S+)`)
+)
+
+// dsnParams returns the names of the parameters of a key/value connection
+// string.
+func dsnParams(address string) map[string]bool {
+	names := make(map[string]bool)
+	for _, m := range dsnParam.FindAllStringSubmatch(address, -1) {
+		names[m[1]] = true
+	}
+	return names
+}
+
+// dsnValue returns the value of the parameter name of a key/value connection
+// string, the last one if repeated, or an empty string if it is not set.
+func dsnValue(address, name string) string {
+	var value string
+	for _, m := range dsnValueParam.FindAllStringSubmatch(address, -1) {
+		if m[1] == name {
+			value = strings.Trim(m[2], "'")
+		}
+	}
+	return value
+}
+
+// removeDSNParam returns a key/value connection string without the parameter
+// name, so that it can be set again without repeating it.
+func removeDSNParam(address, name string) string {
+	matches := dsnValueParam.FindAllStringSubmatchIndex(address, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		if address[m[2]:m[3]] == name {
+			address = strings.TrimRight(address[:m[0]], " \t") + address[m[1]:]
+		}
+	}
+	return strings.TrimSpace(address)
+}
+
+// redactAddress returns a connection string with its passwords replaced, to
+// be logged.
+func redactAddress(address string) string {
+	const redacted = "xxxxx"
+	if u, err := url.Parse(address); err == nil && u.Scheme != "" {
+		if u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+			}
+		}
+		query := u.Query()
+		if query.Get("password") != "" {
+			query.Set("password", redacted)
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+
+	matches := dsnValueParam.FindAllStringSubmatchIndex(address, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		if address[m[2]:m[3]] == "password" {
+			address = address[:m[4]] + redacted + address[m[5]:]
+		}
+	}
+	return address
+}
+
+// isSocket returns true if host is the directory of a unix socket rather than
+// a host name.
+func isSocket(host string) bool {
+	return strings.HasPrefix(host, "/")
+}
+
+// uriParams returns the names of the parameters of a postgres:// connection
+// string, including those of its user, host and path.
+func uriParams(u *url.URL) map[string]bool {
+	names := make(map[string]bool)
+	for name := range u.Query() {
+		names[name] = true
+	}
+	if u.User != nil {
+		names["user"] = true
+		if _, ok := u.User.Password(); ok {
+			names["password"] = true
+		}
+	}
+	if u.Hostname() != "" {
+		names["host"] = true
+	}
+	if u.Port() != "" {
+		names["port"] = true
+	}
+	if u.Path != "" && u.Path != "/" {
+		names["dbname"] = true
+	}
+	return names
+}
+
+// setURIParam sets a parameter of a postgres:// connection string, in its
+// user, host or path for those held there.
+func setURIParam(u *url.URL, query url.Values, name, value string) {
+	switch name {
+	case "host":
+		port := u.Port()
+		u.Host = value
+		if port != "" {
+			u.Host += ":" + port
+		}
+	case "port":
+		u.Host = u.Hostname() + ":" + value
+	case "dbname":
+		u.Path = "/" + value
+	case "user":
+		if u.User != nil {
+			if password, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(value, password)
+				return
+			}
+		}
+		u.User = url.User(value)
+	case "password":
+		username := ""
+		if u.User != nil {
+			username = u.User.Username()
+		}
+		u.User = url.UserPassword(username, value)
+	default:
+		query.Set(name, value)
+	}
+}
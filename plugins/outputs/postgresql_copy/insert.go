@@ -0,0 +1,72 @@
+package postgresql_copy
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+)
+
+// maxParameters is the largest number of parameters of a statement, the
+// number of rows of an INSERT is limited so that their values fit.
+const maxParameters = 65535
+
+// insert writes metrics into table with multi-row INSERT statements with one
+// parameter per value, for insert_mode = "insert". Every statement has at
+// most batch_size rows, and no more than fit in maxParameters. It returns the
+// number of rows written.
+func (p *PostgresqlCopy) insert(ctx context.Context, c conn, table string, columns []string, metrics []telegraf.Metric) (int64, error) {
+	size := maxParameters / len(columns)
+	if p.BatchSize > 0 && p.BatchSize < size {
+		size = p.BatchSize
+	}
+
+	var written int64
+	layout := p.layout()
+	for start := 0; start < len(metrics); start += size {
+		end := start + size
+		if end > len(metrics) {
+			end = len(metrics)
+		}
+
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for _, m := range metrics[start:end] {
+			values, err := rowValues(m, columns, layout, p.transforms)
+			if err != nil {
+				return written, err
+			}
+			args = append(args, values...)
+		}
+		if err := c.Exec(ctx, insertSQL(p.schemaOf(table), table, columns, end-start), args...); err != nil {
+			return written, err
+		}
+		written += int64(end - start)
+	}
+	return written, nil
+}
+
+// insertSQL returns the INSERT statement of rows rows of columns, with the
+// parameters of a row following those of the row before it.
+func insertSQL(schema, table string, columns []string, rows int) string {
+	var b bytes.Buffer
+	b.WriteString("INSERT INTO " + quoteTable(schema, table) +
+		" (" + strings.Join(quoteIdentifiers(columns), ", ") + ") VALUES ")
+	n := 0
+	for row := 0; row < rows; row++ {
+		if row > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for i := range columns {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package postgresql_copy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertSQL(t *testing.T) {
+	require.Equal(t,
+		`INSERT INTO "telemetry"."cpu" ("time", "host", "usage") VALUES ($1, $2, $3), ($4, $5, $6)`,
+		insertSQL("telemetry", "cpu", []string{"time", "host", "usage"}, 2))
+}
+
+func TestWriteInsert(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "b"},
+			map[string]interface{}{"usage": 2.5},
+			time.Unix(10, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "c"},
+			map[string]interface{}{"usage": 3.5},
+			time.Unix(20, 0)),
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.InsertMode = "insert"
+	p.BatchSize = 2
+	written := p.tableStats("cpu").rowsWritten.Get()
+	require.NoError(t, p.Write(metrics))
+
+	require.Empty(t, c.copies)
+	require.Equal(t, []string{
+		`INSERT INTO "cpu" ("time", "host", "usage") VALUES ($1, $2, $3), ($4, $5, $6)`,
+		`INSERT INTO "cpu" ("time", "host", "usage") VALUES ($1, $2, $3)`,
+	}, c.execs)
+	require.Equal(t, [][]interface{}{
+		{time.Unix(0, 0), "a", 1.5, time.Unix(10, 0), "b", 2.5},
+		{time.Unix(20, 0), "c", 3.5},
+	}, c.args)
+	require.Equal(t, int64(3), p.tableStats("cpu").rowsWritten.Get()-written)
+}
+
+func TestInsertMaxParameters(t *testing.T) {
+	fields := make(map[string]interface{}, 999)
+	for i := 0; i < 999; i++ {
+		fields[fmt.Sprintf("f%03d", i)] = 1.0
+	}
+	metrics := make([]telegraf.Metric, 70)
+	for i := range metrics {
+		metrics[i] = testutil.MustMetric("wide", nil, fields, time.Unix(int64(i), 0))
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.InsertMode = "insert"
+	require.NoError(t, p.Write(metrics))
+
+	// 1000 columns fit 65 rows in 65535 parameters
+	require.Len(t, c.args, 2)
+	require.Len(t, c.args[0], 65000)
+	require.Len(t, c.args[1], 5000)
+}
+
+func TestConnectInsert(t *testing.T) {
+	p := &PostgresqlCopy{InsertMode: "insert", CopyFormat: "binary"}
+	require.EqualError(t, p.Connect(), `insert_mode "insert" cannot be used with copy_format "binary"`)
+
+	p = &PostgresqlCopy{InsertMode: "insert", IsolateRowErrors: true}
+	require.EqualError(t, p.Connect(), `insert_mode "insert" cannot be used with isolate_row_errors`)
+}
@@ -0,0 +1,60 @@
+package postgresql_copy
+
+import (
+	"log"
+	"math"
+	"strconv"
+
+	"github.com/influxdata/telegraf"
+)
+
+// isNonFinite returns true if value is a NaN or infinite float.
+func isNonFinite(value interface{}) bool {
+	f, ok := value.(float64)
+	return ok && (math.IsNaN(f) || math.IsInf(f, 0))
+}
+
+// formatFloat returns the text representation of a float, NaN and the
+// infinities as the literals accepted by double precision.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	default:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+}
+
+// dropNonFinite returns metrics without those with a NaN or infinite field
+// that is written, for on_nonfinite = "drop".
+func (p *PostgresqlCopy) dropNonFinite(metrics []telegraf.Metric) []telegraf.Metric {
+	if p.OnNonFinite != "drop" {
+		return metrics
+	}
+
+	layout := p.layout()
+	kept := metrics[:0:0]
+	for _, m := range metrics {
+		if key, ok := nonFiniteField(m, layout.forMeasurement(m.Name())); ok {
+			log.Printf("D! [outputs.postgresql_copy] Dropping metric %s with non-finite field %s", m.Name(), key)
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// nonFiniteField returns the key of the first written field of m with a NaN
+// or infinite value.
+func nonFiniteField(m telegraf.Metric, layout columnLayout) (string, bool) {
+	for _, field := range m.FieldList() {
+		if layout.keepField(field.Key) && isNonFinite(field.Value) {
+			return field.Key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,82 @@
+package postgresql_copy
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteNonFinite(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("m",
+			map[string]string{},
+			map[string]interface{}{"a": math.NaN(), "b": math.Inf(1), "c": math.Inf(-1)},
+			time.Unix(0, 0)),
+		testutil.MustMetric("m",
+			map[string]string{},
+			map[string]interface{}{"a": 1.5, "b": 2.0, "c": 3.0},
+			time.Unix(1, 0)),
+	}
+
+	tests := []struct {
+		policy   string
+		data     string
+		expected string
+	}{
+		{policy: "write", data: "1970-01-01T00:00:00Z\tNaN\tInfinity\t-Infinity\n1970-01-01T00:00:01Z\t1.5\t2\t3\n"},
+		{policy: "null", data: "1970-01-01T00:00:00Z\t\\N\t\\N\t\\N\n1970-01-01T00:00:01Z\t1.5\t2\t3\n"},
+		{policy: "drop", data: "1970-01-01T00:00:01Z\t1.5\t2\t3\n"},
+		{policy: "error", expected: "copying into table m: column a: non-finite value NaN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			c := &fakeConn{}
+			p := newTestPostgresqlCopy(c)
+			p.OnNonFinite = tt.policy
+
+			err := p.Write(metrics)
+			if tt.expected != "" {
+				require.EqualError(t, err, tt.expected)
+				require.Empty(t, c.copies)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, []fakeCopy{{
+				query: `COPY "m" ("time", "a", "b", "c") FROM STDIN`,
+				data:  tt.data,
+			}}, c.copies)
+		})
+	}
+}
+
+func TestFormatFieldsJSONNonFinite(t *testing.T) {
+	m := testutil.MustMetric("m",
+		map[string]string{},
+		map[string]interface{}{"a": math.NaN(), "b": math.Inf(-1)},
+		time.Unix(0, 0))
+
+	s, err := formatFieldsJSON(m, columnLayout{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, `{"a":"NaN","b":"-Infinity"}`, s)
+
+	s, err = formatFieldsJSON(m, columnLayout{onNonFinite: "null"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, `{"a":null,"b":null}`, s)
+
+	m = testutil.MustMetric("m",
+		map[string]string{},
+		map[string]interface{}{"a": math.NaN(), "b": 1.5},
+		time.Unix(0, 0))
+	_, err = formatFieldsJSON(m, columnLayout{onNonFinite: "error"}, nil)
+	require.EqualError(t, err, "field a: non-finite value NaN")
+}
+
+func TestConnectInvalidOnNonFinite(t *testing.T) {
+	p := &PostgresqlCopy{OnNonFinite: "skip"}
+	require.EqualError(t, p.Connect(), `invalid on_nonfinite "skip", must be "write", "null", "drop" or "error"`)
+}
@@ -0,0 +1,93 @@
+package postgresql_copy
+
+import (
+	"fmt"
+)
+
+// tableOverride is a [[table]] of the configuration, writing the metrics of
+// a measurement to a table of its own, like an existing table of another
+// schema. Options left empty keep the value of the plugin.
+type tableOverride struct {
+	Measurement string            `toml:"measurement"`
+	Name        string            `toml:"name"`
+	Schema      string            `toml:"schema"`
+	TimeColumn  string            `toml:"time_column"`
+	ColumnNames map[string]string `toml:"column_names"`
+
+	// columnNames are the column_names of the plugin with those of the
+	// override applied.
+	columnNames map[string]string
+}
+
+// parseTableOverrides validates the table overrides and returns them keyed by
+// measurement and by table. The table of an override defaults to its
+// measurement, and a table cannot be the table of two overrides.
+func parseTableOverrides(overrides []tableOverride, columnNames map[string]string) (map[string]*tableOverride, map[string]*tableOverride, error) {
+	if len(overrides) == 0 {
+		return nil, nil, nil
+	}
+
+	byMeasurement := make(map[string]*tableOverride, len(overrides))
+	byTable := make(map[string]*tableOverride, len(overrides))
+	for i := range overrides {
+		o := &overrides[i]
+		if o.Measurement == "" {
+			return nil, nil, fmt.Errorf("table override without a measurement")
+		}
+		if _, ok := byMeasurement[o.Measurement]; ok {
+			return nil, nil, fmt.Errorf("duplicate table override of measurement %q", o.Measurement)
+		}
+		if o.Name == "" {
+			o.Name = o.Measurement
+		}
+		if other, ok := byTable[o.Name]; ok {
+			return nil, nil, fmt.Errorf("measurements %q and %q are both overridden to table %s", other.Measurement, o.Measurement, o.Name)
+		}
+
+		o.columnNames = columnNames
+		if len(o.ColumnNames) > 0 {
+			o.columnNames = make(map[string]string, len(columnNames)+len(o.ColumnNames))
+			for key, column := range columnNames {
+				o.columnNames[key] = column
+			}
+			for key, column := range o.ColumnNames {
+				o.columnNames[key] = column
+			}
+		}
+		byMeasurement[o.Measurement] = o
+		byTable[o.Name] = o
+	}
+	return byMeasurement, byTable, nil
+}
+
+// forMeasurement returns the layout of the metrics of the measurement name,
+// with the options of its table override if it has one. The table of an
+// override is never the single table, so it has no name column.
+func (l columnLayout) forMeasurement(name string) columnLayout {
+	o, ok := l.overrides[name]
+	if !ok {
+		return l
+	}
+	l.table = ""
+	if o.TimeColumn != "" {
+		l.timeColumn = o.TimeColumn
+	}
+	l.columnNames = o.columnNames
+	return l
+}
+
+// forTable returns the layout of the metrics written to table.
+func (l columnLayout) forTable(table string) columnLayout {
+	if o, ok := l.overrideTables[table]; ok {
+		return l.forMeasurement(o.Measurement)
+	}
+	return l
+}
+
+// schemaOf returns the schema of table, that of its table override if set.
+func (p *PostgresqlCopy) schemaOf(table string) string {
+	if o, ok := p.overrideTables[table]; ok && o.Schema != "" {
+		return o.Schema
+	}
+	return p.Schema
+}
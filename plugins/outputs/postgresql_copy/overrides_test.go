@@ -0,0 +1,104 @@
+package postgresql_copy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTableOverrides(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage_idle": 98.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("mem",
+			map[string]string{},
+			map[string]interface{}{"free": int64(42)},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+	p.SingleTable = true
+	p.TableName = "metrics"
+	overrides, overrideTables, err := parseTableOverrides([]tableOverride{{
+		Measurement: "cpu",
+		Name:        "legacy_cpu",
+		Schema:      "legacy",
+		TimeColumn:  "ts",
+		ColumnNames: map[string]string{"usage_idle": "idle"},
+	}}, nil)
+	require.NoError(t, err)
+	p.overrides, p.overrideTables = overrides, overrideTables
+
+	require.NoError(t, p.Write(metrics))
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "legacy"."legacy_cpu" ("ts" timestamptz, "host" text, "idle" float8)`,
+		`CREATE TABLE IF NOT EXISTS "metrics" ("time" timestamptz, "name" text, "free" int8)`,
+	}, c.execs)
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "legacy"."legacy_cpu" ("ts", "host", "idle") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\ta\t98.5\n",
+	}, {
+		query: `COPY "metrics" ("time", "name", "free") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\tmem\t42\n",
+	}}, c.copies)
+}
+
+func TestTableOverrideOtherMeasurement(t *testing.T) {
+	overrides, overrideTables, err := parseTableOverrides([]tableOverride{{Measurement: "cpu_legacy", Name: "cpu"}}, nil)
+	require.NoError(t, err)
+	layout := columnLayout{overrides: overrides, overrideTables: overrideTables}
+
+	table, err := layout.tableOf(testutil.MustMetric("cpu_legacy", nil, map[string]interface{}{"usage": 1.5}, time.Unix(0, 0)))
+	require.NoError(t, err)
+	require.Equal(t, "cpu", table)
+
+	_, err = layout.tableOf(testutil.MustMetric("cpu", nil, map[string]interface{}{"usage": 1.5}, time.Unix(0, 0)))
+	require.EqualError(t, err, `measurement "cpu" is written to table cpu of the table override of measurement "cpu_legacy"`)
+}
+
+func TestParseTableOverrides(t *testing.T) {
+	overrides, overrideTables, err := parseTableOverrides([]tableOverride{
+		{Measurement: "cpu", ColumnNames: map[string]string{"usage_idle": "idle"}},
+		{Measurement: "mem"},
+	}, map[string]string{"host": "hostname", "usage_idle": "usage"})
+	require.NoError(t, err)
+	require.Equal(t, "cpu", overrides["cpu"].Name)
+	require.Equal(t, map[string]string{"host": "hostname", "usage_idle": "idle"}, overrides["cpu"].columnNames)
+	require.Equal(t, map[string]string{"host": "hostname", "usage_idle": "usage"}, overrides["mem"].columnNames)
+	require.Equal(t, overrides["mem"], overrideTables["mem"])
+
+	tests := []struct {
+		name      string
+		overrides []tableOverride
+		expected  string
+	}{
+		{
+			name:      "no measurement",
+			overrides: []tableOverride{{Name: "cpu"}},
+			expected:  "table override without a measurement",
+		},
+		{
+			name:      "duplicate",
+			overrides: []tableOverride{{Measurement: "cpu"}, {Measurement: "cpu", Name: "cpu2"}},
+			expected:  `duplicate table override of measurement "cpu"`,
+		},
+		{
+			name:      "shared table",
+			overrides: []tableOverride{{Measurement: "cpu"}, {Measurement: "cpu2", Name: "cpu"}},
+			expected:  `measurements "cpu" and "cpu2" are both overridden to table cpu`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseTableOverrides(tt.overrides, nil)
+			require.EqualError(t, err, tt.expected)
+		})
+	}
+}
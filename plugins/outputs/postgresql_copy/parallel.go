@@ -0,0 +1,93 @@
+package postgresql_copy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/influxdata/telegraf"
+)
+
+// poolSize returns the maximum number of open connections of the pool,
+// max_open_connections or write_concurrency if 0. 0 is unlimited.
+func (p *PostgresqlCopy) poolSize() int {
+	if p.MaxOpenConnections > 0 {
+		return p.MaxOpenConnections
+	}
+	if p.WriteConcurrency > 0 {
+		return p.WriteConcurrency
+	}
+	return 0
+}
+
+// writeParallel writes the metrics of every table as a batch of its own, on
+// its own connection, for parallel_tables. At most poolSize tables are
+// written at the same time. Every table is written even if others fail, and
+// the errors of all failed tables are returned together. The tables that
+// succeeded are committed, so they are written again when Telegraf retries
+// the batch.
+func (p *PostgresqlCopy) writeParallel(metrics []telegraf.Metric) error {
+	layout := p.layout()
+	byTable := make(map[string][]telegraf.Metric)
+	for _, m := range metrics {
+		table, err := layout.tableOf(m)
+		if err != nil {
+			return err
+		}
+		byTable[table] = append(byTable[table], m)
+	}
+	if len(byTable) <= 1 {
+		return p.writeBatch(metrics)
+	}
+
+	tables := make([]string, 0, len(byTable))
+	for table := range byTable {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	size := p.poolSize()
+	if size <= 0 || size > len(tables) {
+		size = len(tables)
+	}
+	sem := make(chan struct{}, size)
+	var wg sync.WaitGroup
+	errs := make([]error, len(tables))
+	for i, table := range tables {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, batch []telegraf.Metric) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = p.writeBatch(batch)
+		}(i, byTable[table])
+	}
+	wg.Wait()
+
+	return tableErrors(tables, errs)
+}
+
+// tableErrors returns the errors of the failed tables, errs[i] being the
+// error of tables[i], as a single error naming every failed table.
+func tableErrors(tables []string, errs []error) error {
+	var failed, messages []string
+	var first error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if first == nil {
+			first = err
+		}
+		failed = append(failed, tables[i])
+		messages = append(messages, err.Error())
+	}
+	if len(failed) <= 1 {
+		return first
+	}
+	return fmt.Errorf("writing %d of %d tables failed (%s): %s",
+		len(failed), len(tables), strings.Join(failed, ", "), strings.Join(messages, "; "))
+}
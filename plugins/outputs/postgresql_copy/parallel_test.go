@@ -0,0 +1,97 @@
+package postgresql_copy
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func parallelMetrics() []telegraf.Metric {
+	var metrics []telegraf.Metric
+	for _, name := range []string{"cpu", "disk", "mem"} {
+		metrics = append(metrics, testutil.MustMetric(name,
+			map[string]string{},
+			map[string]interface{}{"value": 1.5},
+			time.Unix(0, 0)))
+	}
+	return metrics
+}
+
+func TestWriteParallelTables(t *testing.T) {
+	c := &fakeConn{}
+	pool := &concurrencyPool{size: 2}
+	p := newTestPostgresqlCopy(c)
+	p.ParallelTables = true
+	p.MaxOpenConnections = 2
+	p.acquire = func() (conn, error) {
+		pool.Lock()
+		defer pool.Unlock()
+		require.True(t, pool.inUse < pool.size, "pool exhausted")
+		pool.inUse++
+		if pool.inUse > pool.maxInUse {
+			pool.maxInUse = pool.inUse
+		}
+		return &concurrencyConn{fakeConn: c, pool: pool}, nil
+	}
+
+	require.NoError(t, p.Write(parallelMetrics()))
+	require.Equal(t, 2, pool.maxInUse)
+
+	var queries []string
+	for _, cp := range c.copies {
+		queries = append(queries, cp.query)
+	}
+	sort.Strings(queries)
+	require.Equal(t, []string{
+		`COPY "cpu" ("time", "value") FROM STDIN`,
+		`COPY "disk" ("time", "value") FROM STDIN`,
+		`COPY "mem" ("time", "value") FROM STDIN`,
+	}, queries)
+}
+
+func TestWriteParallelTablesErrors(t *testing.T) {
+	c := &fakeConn{
+		copyErr: func(data string) error {
+			return errors.New("disk full")
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.ParallelTables = true
+	p.MaxOpenConnections = 2
+
+	err := p.Write(parallelMetrics())
+	require.EqualError(t, err, "writing 3 of 3 tables failed (cpu, disk, mem): "+
+		"copying into table cpu: disk full; copying into table disk: disk full; copying into table mem: disk full")
+
+	// a single failed table is returned as is, the others are still written
+	c = &fakeConn{
+		copyErr: func(data string) error {
+			if strings.Contains(data, "fail") {
+				return errors.New("disk full")
+			}
+			return nil
+		},
+	}
+	p = newTestPostgresqlCopy(c)
+	p.ParallelTables = true
+	p.MaxOpenConnections = 2
+	metrics := parallelMetrics()
+	metrics[1].AddField("note", "fail")
+
+	require.EqualError(t, p.Write(metrics), "copying into table disk: disk full")
+	require.Len(t, c.copies, 2)
+}
+
+func TestConnectParallelTables(t *testing.T) {
+	p := &PostgresqlCopy{ParallelTables: true, BatchTransaction: "write"}
+	require.EqualError(t, p.Connect(), `parallel_tables cannot be used with batch_transaction "write"`)
+
+	p = &PostgresqlCopy{ParallelTables: true, InsertMode: "staging"}
+	require.EqualError(t, p.Connect(), `parallel_tables cannot be used with insert_mode "staging"`)
+}
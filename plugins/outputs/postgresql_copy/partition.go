@@ -0,0 +1,83 @@
+package postgresql_copy
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// partitionLayouts are the suffixes of the partitions of a table, by
+// partition_by, formatted from the start of the partition.
+var partitionLayouts = map[string]string{
+	"day":   "20060102",
+	"month": "200601",
+}
+
+// partitionRange returns the UTC start and end of the partition of
+// partition_by holding t.
+func partitionRange(partitionBy string, t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	switch partitionBy {
+	case "month":
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	}
+}
+
+// partitionName returns the name of the partition of table starting at
+// start, the table name followed by the day or month of the partition.
+func partitionName(partitionBy, table string, start time.Time) string {
+	return table + "_" + start.Format(partitionLayouts[partitionBy])
+}
+
+// createPartitions creates the partitions of table holding the timestamps of
+// metrics that have not been created by an earlier write. Partitions that
+// already exist in the database are left as they are.
+func (p *PostgresqlCopy) createPartitions(ctx context.Context, c conn, table string, metrics []telegraf.Metric) error {
+	starts := make(map[time.Time]time.Time)
+	for _, m := range metrics {
+		start, end := partitionRange(p.PartitionBy, m.Time())
+		starts[start] = end
+	}
+	sorted := make([]time.Time, 0, len(starts))
+	for start := range starts {
+		sorted = append(sorted, start)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.partitions == nil {
+		p.partitions = make(map[string]bool)
+	}
+
+	for _, start := range sorted {
+		partition := partitionName(p.PartitionBy, table, start)
+		if p.partitions[partition] {
+			continue
+		}
+		if err := c.Exec(ctx, createPartitionSQL(p.schemaOf(table), table, partition, start, starts[start])); err != nil {
+			return err
+		}
+		p.partitions[partition] = true
+	}
+	return nil
+}
+
+// partitionBySQL returns the clause of a CREATE TABLE statement partitioning
+// the table by range of its time column.
+func partitionBySQL(timeColumn string) string {
+	return " PARTITION BY RANGE (" + quoteIdentifier(timeColumn) + ")"
+}
+
+func createPartitionSQL(schema, table, partition string, start, end time.Time) string {
+	return "CREATE TABLE IF NOT EXISTS " + quoteTable(schema, partition) +
+		" PARTITION OF " + quoteTable(schema, table) +
+		" FOR VALUES FROM (" + quoteLiteral(start.Format(time.RFC3339)) +
+		") TO (" + quoteLiteral(end.Format(time.RFC3339)) + ")"
+}
@@ -0,0 +1,68 @@
+package postgresql_copy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionRange(t *testing.T) {
+	ts := time.Date(2019, 12, 31, 23, 30, 0, 0, time.FixedZone("", -3600))
+
+	start, end := partitionRange("day", ts)
+	require.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), start)
+	require.Equal(t, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), end)
+	require.Equal(t, "cpu_20200101", partitionName("day", "cpu", start))
+
+	start, end = partitionRange("month", ts)
+	require.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), start)
+	require.Equal(t, time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), end)
+	require.Equal(t, "cpu_202001", partitionName("month", "cpu", start))
+}
+
+func TestAutoCreatePartitions(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 1.5},
+			time.Date(2019, 10, 16, 0, 0, 1, 0, time.UTC)),
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 2.5},
+			time.Date(2019, 10, 15, 12, 0, 0, 0, time.UTC)),
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+	p.PartitionBy = "day"
+	p.Schema = "telemetry"
+
+	require.NoError(t, p.Write(metrics))
+	require.NoError(t, p.Write(metrics[:1]))
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "telemetry"."cpu" ("time" timestamptz, "usage" float8) PARTITION BY RANGE ("time")`,
+		`CREATE TABLE IF NOT EXISTS "telemetry"."cpu_20191015" PARTITION OF "telemetry"."cpu" ` +
+			`FOR VALUES FROM ('2019-10-15T00:00:00Z') TO ('2019-10-16T00:00:00Z')`,
+		`CREATE TABLE IF NOT EXISTS "telemetry"."cpu_20191016" PARTITION OF "telemetry"."cpu" ` +
+			`FOR VALUES FROM ('2019-10-16T00:00:00Z') TO ('2019-10-17T00:00:00Z')`,
+	}, c.execs)
+	require.Len(t, c.copies, 2)
+}
+
+func TestConnectPartitionBy(t *testing.T) {
+	p := &PostgresqlCopy{PartitionBy: "week", AutoCreate: true}
+	require.EqualError(t, p.Connect(), `invalid partition_by "week", must be "day" or "month"`)
+
+	p = &PostgresqlCopy{PartitionBy: "day"}
+	require.EqualError(t, p.Connect(), "partition_by requires auto_create")
+
+	p = &PostgresqlCopy{PartitionBy: "day", AutoCreate: true, TimescaleDB: true}
+	require.EqualError(t, p.Connect(), "partition_by cannot be used with timescaledb")
+
+	p = &PostgresqlCopy{PartitionBy: "day", AutoCreate: true, Dialect: "cockroach"}
+	require.EqualError(t, p.Connect(), "partition_by requires the postgres dialect")
+}
@@ -0,0 +1,1807 @@
+package postgresql_copy
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"github.com/influxdata/telegraf/selfstat"
+	"github.com/jackc/pgx"
+	_ "github.com/jackc/pgx/stdlib"
+)
+
+type PostgresqlCopy struct {
+	Address            string
+	Schema             string
+	SetSearchPath      bool   `toml:"set_search_path"`
+	SSLMode            string `toml:"sslmode"`
+	SSLCA              string `toml:"ssl_ca"`
+	SSLCert            string `toml:"ssl_cert"`
+	SSLKey             string `toml:"ssl_key"`
+	Timeout            internal.Duration
+	CopyTimeout        internal.Duration `toml:"copy_timeout"`
+	ConnectTimeout     internal.Duration `toml:"connect_timeout"`
+	ApplicationName    string            `toml:"application_name"`
+	TimeColumn         string            `toml:"time_column"`
+	TimestampPrecision string            `toml:"timestamp_precision"`
+	TagsAsJSONB        bool              `toml:"tags_as_jsonb"`
+	FieldsAsJSONB      bool              `toml:"fields_as_jsonb"`
+	SingleTable        bool              `toml:"single_table"`
+	IncludeMeasurement bool              `toml:"include_measurement_column"`
+	TableName          string            `toml:"table_name"`
+	TableTemplate      string            `toml:"table_template"`
+	MaxRetries         int               `toml:"max_retries"`
+	ColumnRenames      map[string]string `toml:"column_renames"`
+	SanitizeColumns    bool              `toml:"sanitize_columns"`
+	ColumnNames        map[string]string `toml:"column_names"`
+	WriteConcurrency   int               `toml:"write_concurrency"`
+	MaxOpenConnections int               `toml:"max_open_connections"`
+	ParallelTables     bool              `toml:"parallel_tables"`
+	MaxIdleConnections int               `toml:"max_idle_connections"`
+	ConnMaxLifetime    internal.Duration `toml:"connection_max_lifetime"`
+	PoolStatsInterval  internal.Duration `toml:"pool_stats_interval"`
+	ColumnTransforms   map[string]string `toml:"column_transforms"`
+	Dialect            string
+	IsolateRowErrors   bool              `toml:"isolate_row_errors"`
+	RejectTable        string            `toml:"reject_table"`
+	BatchSize          int               `toml:"batch_size"`
+	BatchTransaction   string            `toml:"batch_transaction"`
+	InsertMode         string            `toml:"insert_mode"`
+	CopyFormat         string            `toml:"copy_format"`
+	ConflictColumns    []string          `toml:"conflict_columns"`
+	AutoCreate         bool              `toml:"auto_create"`
+	TimescaleDB        bool              `toml:"timescaledb"`
+	ChunkTimeInterval  internal.Duration `toml:"chunk_time_interval"`
+	AutoAddColumns     bool              `toml:"auto_add_columns"`
+	Domains            map[string]string `toml:"domains"`
+	ColumnDomains      map[string]string `toml:"column_domains"`
+	ColumnTypes        map[string]string `toml:"column_types"`
+	OnTypeError        string            `toml:"on_type_error"`
+	OnStringOverflow   string            `toml:"on_string_overflow"`
+	OnNonFinite        string            `toml:"on_nonfinite"`
+	DryRun             bool              `toml:"dry_run"`
+	TagColumnPrefix    string            `toml:"tag_column_prefix"`
+	FieldColumnPrefix  string            `toml:"field_column_prefix"`
+	FlushInterval      internal.Duration `toml:"flush_interval"`
+	FlushBufferSize    int               `toml:"flush_buffer_size"`
+	PartitionBy        string            `toml:"partition_by"`
+	Indexes            [][]string        `toml:"indexes"`
+	OnTableCollision   string            `toml:"on_table_collision"`
+	PoolMode           string            `toml:"pool_mode"`
+	EmptyStringToNull  bool              `toml:"convert_empty_string_to_null"`
+	EmptyTagToNull     bool              `toml:"convert_empty_tag_to_null"`
+	TagInclude         []string          `toml:"tag_include"`
+	TagExclude         []string          `toml:"tag_exclude"`
+	FieldInclude       []string          `toml:"field_include"`
+	FieldExclude       []string          `toml:"field_exclude"`
+	Tables             []tableOverride   `toml:"table"`
+
+	db *sql.DB
+	// done stops the pool stats polling and the buffer flushing started by
+	// Connect
+	done chan struct{}
+	wg   sync.WaitGroup
+	// acquire returns the connection used by a Write, it can be replaced
+	// with a fake connection for unit test purposes.
+	acquire func() (conn, error)
+	// stagingSuffix returns the suffix of the staging tables created with
+	// pool_mode = "transaction", randomSuffix if nil.
+	stagingSuffix func() string
+	// tables caches the columns of every table whose schema has been
+	// managed, keyed by table name. It is guarded by mu as batches may be
+	// written concurrently.
+	mu     sync.Mutex
+	tables map[string]map[string]string
+	// transforms are the parsed column_transforms, keyed by column name.
+	transforms map[string]transform
+	// tableTemplate is the parsed table_template, nil if not set.
+	tableTemplate *template.Template
+	// tableNames detects the table_template names colliding once
+	// sanitized, nil without table_template.
+	tableNames *tableNames
+	// tagFilter and fieldFilter are the compiled tag_include and
+	// tag_exclude, and field_include and field_exclude, nil if not set.
+	tagFilter   filter.Filter
+	fieldFilter filter.Filter
+	// overrides and overrideTables are the table overrides, keyed by
+	// measurement and by table, nil if none is set.
+	overrides      map[string]*tableOverride
+	overrideTables map[string]*tableOverride
+	// typeKinds are the kinds of the column_types, keyed by column name.
+	typeKinds map[string]typeKind
+	// typeLengths are the lengths of the column_types of a character type
+	// of limited length, keyed by column name.
+	typeLengths map[string]int
+	dialect     dialect
+	// rowsSkipped counts the rows skipped with isolate_row_errors.
+	rowsSkipped selfstat.Stat
+	// statsTags are the tags of the internal metrics.
+	statsTags map[string]string
+	// stats are the internal metrics of every table written, keyed by table
+	// name. It is guarded by mu.
+	stats map[string]*tableStats
+	// domainsCreated is set once the domains have been created, it is
+	// guarded by mu.
+	domainsCreated bool
+	// rejectTableCreated is set once reject_table has been created, it is
+	// guarded by mu.
+	rejectTableCreated bool
+	// partitions are the partitions created with partition_by, keyed by
+	// name. It is guarded by mu.
+	partitions map[string]bool
+	// buffer holds the metrics written until they are flushed, nil unless
+	// flush_interval or flush_buffer_size is set.
+	buffer *writeBuffer
+}
+
+// Columns maps a table name to the ordered list of columns written to it.
+type Columns map[string][]string
+
+const (
+	// tagsColumn is the column holding all tags with tags_as_jsonb.
+	tagsColumn = "tags"
+	// fieldsColumn is the column holding all fields with fields_as_jsonb.
+	fieldsColumn = "fields"
+	// nameColumn is the column holding the measurement name with
+	// single_table.
+	nameColumn = "name"
+	// measurementColumn is the column holding the measurement name with
+	// include_measurement_column.
+	measurementColumn = "measurement"
+)
+
+// timestampPrecisions are the durations timestamps are truncated to, by
+// timestamp_precision.
+var timestampPrecisions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// columnLayout describes how metrics are mapped to tables, and how their
+// time, tags and fields are mapped to columns.
+type columnLayout struct {
+	// table, if set, is the single table all metrics are written to, with
+	// the measurement name in nameColumn.
+	table string
+	// tableTemplate, if set, returns the table of every metric.
+	tableTemplate *template.Template
+	// tableNames, if set, resolves the tables of tableTemplate names that
+	// collide once sanitized.
+	tableNames *tableNames
+	timeColumn string
+	// includeMeasurement writes the measurement name to measurementColumn
+	// of every table.
+	includeMeasurement bool
+	// precision is the duration timestamps are truncated to, if set.
+	precision time.Duration
+	// tagsAsJSONB writes all tags to tagsColumn instead of one column per
+	// tag.
+	tagsAsJSONB bool
+	// fieldsAsJSONB writes all fields to fieldsColumn instead of one column
+	// per field.
+	fieldsAsJSONB bool
+	// columnNames maps tag and field keys to their column, other keys are
+	// sanitized with sanitizeColumns.
+	columnNames     map[string]string
+	sanitizeColumns bool
+	// tagPrefix and fieldPrefix are prepended to the columns of tag and
+	// field keys not in columnNames.
+	tagPrefix   string
+	fieldPrefix string
+	// tagFilter and fieldFilter, if set, exclude the tags and fields they
+	// do not match from both columns and values.
+	tagFilter   filter.Filter
+	fieldFilter filter.Filter
+	// types are the kinds of the columns with a declared type, values
+	// that do not fit are converted with coerceTypes, otherwise NULL.
+	types       map[string]typeKind
+	coerceTypes bool
+	// lengths are the lengths of the columns with a declared type like
+	// varchar(255), longer strings are handled by stringOverflow.
+	lengths        map[string]int
+	stringOverflow string
+	// onNonFinite is the handling of NaN and infinite field values.
+	onNonFinite string
+	// emptyStringNull writes empty tag and field values as NULL.
+	emptyStringNull bool
+	// emptyTagNull writes empty tag values as NULL, like missing tags.
+	emptyTagNull bool
+	// overrides and overrideTables are the table overrides, keyed by
+	// measurement and by table.
+	overrides      map[string]*tableOverride
+	overrideTables map[string]*tableOverride
+}
+
+// tableOf returns the table m is written to, the table of its table override
+// if it has one. The table of an override is an error for the metrics of
+// other measurements.
+func (l columnLayout) tableOf(m telegraf.Metric) (string, error) {
+	if o, ok := l.overrides[m.Name()]; ok {
+		return o.Name, nil
+	}
+	table, err := l.defaultTableOf(m)
+	if err != nil {
+		return "", err
+	}
+	if o, ok := l.overrideTables[table]; ok {
+		return "", fmt.Errorf("measurement %q is written to table %s of the table override of measurement %q", m.Name(), table, o.Measurement)
+	}
+	return table, nil
+}
+
+// defaultTableOf returns the table m is written to without table overrides.
+// A metric the table template fails for is written to the table of its
+// sanitized measurement name. Names that collide once sanitized are resolved
+// with tableNames.
+func (l columnLayout) defaultTableOf(m telegraf.Metric) (string, error) {
+	if l.table != "" {
+		return l.table, nil
+	}
+	if l.tableTemplate == nil {
+		return m.Name(), nil
+	}
+
+	table, source, err := executeTableTemplate(l.tableTemplate, m)
+	if err != nil {
+		log.Printf("W! [outputs.postgresql_copy] table_template failed for %s: %s", m.Name(), err)
+		table, source = sanitizeIdentifier(m.Name()), m.Name()
+	}
+	if l.tableNames == nil {
+		return table, nil
+	}
+	return l.tableNames.resolve(table, source)
+}
+
+// columnOf returns the column of the tag or field key.
+func (l columnLayout) columnOf(key string) string {
+	if column, ok := l.columnNames[key]; ok {
+		return column
+	}
+	if l.sanitizeColumns {
+		return sanitizeIdentifier(key)
+	}
+	return key
+}
+
+// tagColumn returns the column of the tag key.
+func (l columnLayout) tagColumn(key string) string {
+	if column, ok := l.columnNames[key]; ok {
+		return column
+	}
+	return l.tagPrefix + l.columnOf(key)
+}
+
+// fieldColumn returns the column of the field key.
+func (l columnLayout) fieldColumn(key string) string {
+	if column, ok := l.columnNames[key]; ok {
+		return column
+	}
+	return l.fieldPrefix + l.columnOf(key)
+}
+
+// keepTag returns true if the tag key is written.
+func (l columnLayout) keepTag(key string) bool {
+	return l.tagFilter == nil || l.tagFilter.Match(key)
+}
+
+// keepField returns true if the field key is written.
+func (l columnLayout) keepField(key string) bool {
+	return l.fieldFilter == nil || l.fieldFilter.Match(key)
+}
+
+// tags returns the tags of m that are written, without the empty ones with
+// convert_empty_tag_to_null.
+func (l columnLayout) tags(m telegraf.Metric) map[string]string {
+	if l.tagFilter == nil && !l.emptyTagNull {
+		return m.Tags()
+	}
+	tags := make(map[string]string, len(m.TagList()))
+	for _, tag := range m.TagList() {
+		if l.keepTag(tag.Key) && (tag.Value != "" || !l.emptyTagNull) {
+			tags[tag.Key] = tag.Value
+		}
+	}
+	return tags
+}
+
+// tagValue returns the value of the tag of m written to column.
+func (l columnLayout) tagValue(m telegraf.Metric, column string) (string, bool) {
+	if l.tagsAsJSONB {
+		return "", false
+	}
+	for _, tag := range m.TagList() {
+		if l.tagColumn(tag.Key) == column && l.keepTag(tag.Key) {
+			return tag.Value, true
+		}
+	}
+	return "", false
+}
+
+// fieldValue returns the value of the field of m written to column.
+func (l columnLayout) fieldValue(m telegraf.Metric, column string) (interface{}, bool) {
+	if l.fieldsAsJSONB {
+		return nil, false
+	}
+	for _, field := range m.FieldList() {
+		if l.fieldColumn(field.Key) == column && l.keepField(field.Key) {
+			return field.Value, true
+		}
+	}
+	return nil, false
+}
+
+// layout returns the columnLayout configured by p.
+func (p *PostgresqlCopy) layout() columnLayout {
+	var table string
+	if p.SingleTable {
+		table = p.TableName
+	}
+	return columnLayout{
+		table:              table,
+		tableTemplate:      p.tableTemplate,
+		tableNames:         p.tableNames,
+		timeColumn:         p.TimeColumn,
+		includeMeasurement: p.IncludeMeasurement,
+		precision:          timestampPrecisions[p.TimestampPrecision],
+		tagsAsJSONB:        p.TagsAsJSONB,
+		fieldsAsJSONB:      p.FieldsAsJSONB,
+		columnNames:        p.ColumnNames,
+		sanitizeColumns:    p.SanitizeColumns,
+		tagPrefix:          p.TagColumnPrefix,
+		fieldPrefix:        p.FieldColumnPrefix,
+		tagFilter:          p.tagFilter,
+		fieldFilter:        p.fieldFilter,
+		types:              p.typeKinds,
+		coerceTypes:        p.OnTypeError != "drop",
+		lengths:            p.typeLengths,
+		stringOverflow:     p.OnStringOverflow,
+		onNonFinite:        p.OnNonFinite,
+		emptyStringNull:    p.EmptyStringToNull,
+		emptyTagNull:       p.EmptyTagToNull,
+		overrides:          p.overrides,
+		overrideTables:     p.overrideTables,
+	}
+}
+
+// reserved returns true if name is a column of the layout that cannot be
+// used by a tag or field.
+func (l columnLayout) reserved(name string) bool {
+	return name == l.timeColumn ||
+		(l.table != "" && name == nameColumn) ||
+		(l.includeMeasurement && name == measurementColumn) ||
+		(l.tagsAsJSONB && name == tagsColumn) ||
+		(l.fieldsAsJSONB && name == fieldsColumn)
+}
+
+var sampleConfig = `
+  ## A github.com/jackc/pgx connection string.
+  ## See https://godoc.org/github.com/jackc/pgx#ParseDSN
+  ## The parameters missing from the address and options default to the libpq
+  ## environment variables, like PGHOST, PGUSER, PGPASSWORD and PGDATABASE.
+  ## A host starting with a "/" is the directory of a unix socket, for example
+  ## "host=/var/run/postgresql user=postgres".
+  address = "host=localhost user=postgres sslmode=disable"
+
+  ## Schema of the tables written to, qualifying all table names. Tables are
+  ## in the current schema of the connection if empty. With set_search_path
+  ## the schema is also set as search_path of every connection.
+  # schema = ""
+  # set_search_path = false
+
+  ## TLS options, replacing the sslmode, sslrootcert, sslcert and sslkey
+  ## parameters of the address when set. Use sslmode = "verify-full" with the
+  ## CA of an internal PKI to verify the server certificate.
+  # sslmode = "verify-full"
+  # ssl_ca = "/etc/telegraf/ca.pem"
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+
+  ## Timeout for all queries, including the COPY of a batch.
+  # timeout = "5s"
+
+  ## Timeout of a single COPY, 0 for none. A COPY running longer is aborted
+  ## by closing its connection and the batch is retried on a new connection.
+  # copy_timeout = "0s"
+
+  ## Timeout for establishing a connection, rounded up to whole seconds, 0
+  ## for none. Replaces the connect_timeout parameter of the address when set.
+  # connect_timeout = "0s"
+
+  ## Name reported to the server as application_name, shown in
+  ## pg_stat_activity. Used when neither the address nor PGAPPNAME set one,
+  ## empty to leave it unset.
+  # application_name = "telegraf"
+
+  ## Name of the column holding the metric timestamp.
+  # time_column = "time"
+
+  ## Precision of the written timestamps, one of "ns", "us", "ms" or "s".
+  ## Timestamps are truncated to it, PostgreSQL itself stores microseconds.
+  # timestamp_precision = "ns"
+
+  ## Write all tags of a metric as a JSON object to a single "tags" jsonb
+  ## column, instead of one column per tag.
+  # tags_as_jsonb = false
+
+  ## Write all fields of a metric as a JSON object to a single "fields" jsonb
+  ## column, instead of one column per field.
+  # fields_as_jsonb = false
+
+  ## Write all metrics to the single table_name table, with the measurement
+  ## name in a "name" column, instead of one table per measurement.
+  # single_table = false
+  # table_name = "metrics"
+
+  ## Write the measurement name to a "measurement" column of every table, for
+  ## queries across tables or tables that are later merged or renamed.
+  ## Cannot be combined with single_table.
+  # include_measurement_column = false
+
+  ## Template of the table name of every metric, instead of the measurement
+  ## name. The measurement name is available as {{.Measurement}} and the tags
+  ## as {{.Tags.<key>}}, a missing tag is empty. The result is lowercased and
+  ## every character other than a letter, digit or "_" replaced by "_".
+  # table_template = "metrics_{{.Measurement}}"
+
+  ## Handling of table_template names that only differ before they are
+  ## sanitized, like "cpu-usage" and "cpu_usage": "error" fails the write,
+  ## "suffix" writes all but the first name to a table suffixed with a hash
+  ## of the name, like "cpu_usage_4ca24e03".
+  # on_table_collision = "error"
+
+  ## Lowercase the columns of tags and fields and replace every character
+  ## other than a letter, digit or "_" with "_", so "Disk.Free" is written to
+  ## the "disk_free" column.
+  # sanitize_columns = false
+
+  ## Columns of specific tag and field keys, overriding sanitize_columns.
+  # [outputs.postgresql_copy.column_names]
+  #   "cpu.usage" = "cpu_usage_percent"
+
+  ## Prefixes of the columns of tags and fields not in column_names, so that
+  ## a tag and a field with the same key are written to different columns.
+  ## Without them the tag value is written and the field value lost.
+  # tag_column_prefix = ""
+  # field_column_prefix = ""
+
+  ## Glob patterns of the tags and fields written, the others never become
+  ## columns nor are written to the tags and fields jsonb columns. A key is
+  ## written if it matches an include pattern, or there are none, and no
+  ## exclude pattern.
+  # tag_include = []
+  # tag_exclude = ["container_id"]
+  # field_include = []
+  # field_exclude = []
+
+  ## Number of times a write is retried on a new connection when the
+  ## connection to the database fails, for example when it restarts.
+  # max_retries = 1
+
+  ## Create the table of a measurement that does not exist yet, with a column
+  ## per tag and field typed after the values of the first batch.
+  # auto_create = false
+
+  ## Turn the tables created with auto_create into TimescaleDB hypertables
+  ## partitioned on the time column, with chunks of chunk_time_interval. The
+  ## default interval of TimescaleDB is used if chunk_time_interval is 0.
+  # timescaledb = false
+  # chunk_time_interval = "0s"
+
+  ## Partition the tables created with auto_create by range of the time
+  ## column, either by "day" or by "month", instead of creating regular
+  ## tables. The partition holding the timestamps of a batch is created
+  ## before it is written, as <table>_YYYYMMDD or <table>_YYYYMM.
+  # partition_by = ""
+
+  ## Indexes created on the tables created with auto_create, each a list of
+  ## columns. An index with a column the created table does not have is
+  ## skipped.
+  # indexes = [["time"], ["host", "time"]]
+
+  ## Add the columns of new tags and fields to existing tables, typed like
+  ## the columns of a created table.
+  # auto_add_columns = false
+
+  ## Domains created before the tables and columns using them, from the
+  ## domain name to its definition. Domains are only used by auto_create
+  ## and auto_add_columns.
+  # [outputs.postgresql_copy.domains]
+  #   percentage = "float8 CHECK (VALUE BETWEEN 0 AND 100)"
+
+  ## Domains used as type of created columns, from the column to the domain
+  ## name, instead of the type derived from the values.
+  # [outputs.postgresql_copy.column_domains]
+  #   usage_percent = "percentage"
+
+  ## Types of the columns of tags and fields, used instead of the type
+  ## derived from the values when creating columns. Values of these columns
+  ## are converted to the type before they are written.
+  # [outputs.postgresql_copy.column_types]
+  #   bytes = "bigint"
+  #   ratio = "double precision"
+
+  ## Write empty string tag and field values as NULL, like missing ones,
+  ## instead of as empty strings.
+  # convert_empty_string_to_null = false
+
+  ## Write empty string tag values as NULL, like missing tags, and leave them
+  ## out of the tags column of tags_as_jsonb. Field values are kept as they
+  ## are.
+  # convert_empty_tag_to_null = false
+
+  ## Handling of a value that does not fit the type of its column_types
+  ## entry: "coerce" converts it if possible, like 1.0 to 1 or "true" to
+  ## true, and "drop" writes NULL instead. Values that cannot be converted
+  ## are written as NULL in both cases.
+  # on_type_error = "coerce"
+
+  ## Handling of a string longer than the length of its column_types entry,
+  ## like varchar(255): "error" fails the row, "truncate" writes its first
+  ## characters up to the length and "drop" writes NULL instead.
+  # on_string_overflow = "error"
+
+  ## Handling of NaN and infinite float fields: "write" writes them as the
+  ## 'NaN', 'Infinity' and '-Infinity' literals of double precision, "null"
+  ## writes NULL instead, "drop" drops the metric and "error" fails the row.
+  # on_nonfinite = "write"
+
+  ## Database the output writes to, one of "postgres", "cockroach" for
+  ## CockroachDB or "yugabyte" for YugabyteDB.
+  # dialect = "postgres"
+
+  ## Number of batches written concurrently, each on its own connection.
+  ## The metrics of a write are split by series so that the metrics of a
+  ## series are still written in order, there is no ordering between series.
+  # write_concurrency = 1
+
+  ## Write the tables of a batch concurrently, each with its own COPY on its
+  ## own connection, at most max_open_connections (write_concurrency if 0)
+  ## at a time. Every table is written even if others fail, the errors of
+  ## all failed tables are reported. The whole batch is retried when a table
+  ## fails, which copies the tables that succeeded again and duplicates their
+  ## rows. Cannot be used with batch_transaction = "write" or insert_mode =
+  ## "staging", which commit all tables together.
+  # parallel_tables = false
+
+  ## Connection pool limits. The pool opens at most max_open_connections
+  ## connections, write_concurrency if 0, and keeps up to
+  ## max_idle_connections of them open between writes, all if 0. Connections
+  ## older than connection_max_lifetime are closed and replaced once released,
+  ## 0 keeps them open until they fail.
+  # max_open_connections = 0
+  # max_idle_connections = 0
+  # connection_max_lifetime = "0s"
+
+  ## Interval at which the connection pool usage (open, in use and idle
+  ## connections, waits for a connection) is reported as internal metrics,
+  ## collected with the internal input. 0 disables the pool metrics.
+  # pool_stats_interval = "10s"
+
+  ## Columns to rename before writing, from the old to the new column name.
+  ## A column is only renamed when the old column exists and the new one
+  ## does not, so data written before a metric key was renamed is kept in
+  ## the same column.
+  # [outputs.postgresql_copy.column_renames]
+  #   usage = "usage_percent"
+
+  ## Transforms applied to numeric field values before writing, keyed by
+  ## column name. Transformed values are written as floats. Available
+  ## transforms are "multiply <factor>", "clamp <min> <max>" and "abs".
+  # [outputs.postgresql_copy.column_transforms]
+  #   latency = "multiply 0.001"
+  #   usage_percent = "clamp 0 100"
+
+  ## Write every batch in a transaction and every row under its own
+  ## savepoint, so that a row that cannot be written is skipped instead of
+  ## failing the whole batch. This is much slower than a single COPY per
+  ## table, skipped rows are logged and counted in the rows_skipped internal
+  ## metric.
+  # isolate_row_errors = false
+
+  ## Table the rows that cannot be written are written to, with the error and
+  ## the metric as JSON, instead of failing the batch or being skipped. A COPY
+  ## that fails is written again row by row, which is much slower than a
+  ## single COPY. The table is created with auto_create. Empty to disable.
+  # reject_table = ""
+
+  ## Maximum number of rows per COPY, the rows of a table are split into
+  ## several COPY statements if needed. 0 copies all rows of a table at once.
+  # batch_size = 0
+
+  ## With batch_size, either "chunk" to commit every COPY on its own, or
+  ## "write" to commit all COPY statements of a write in one transaction.
+  # batch_transaction = "chunk"
+
+  ## How rows are written, either "copy" to COPY them into the tables, or
+  ## "upsert" to COPY them into a temporary table and insert them from there
+  ## with INSERT ... ON CONFLICT (conflict_columns) DO UPDATE, which requires
+  ## a unique index on conflict_columns and is several times slower, or
+  ## "staging" to COPY them into a temporary table and insert them from there
+  ## with INSERT ... SELECT, committing all tables of a write at once, or
+  ## "insert" to write them with multi-row INSERT statements, for servers
+  ## and poolers without COPY, which is several times slower.
+  # insert_mode = "copy"
+  # conflict_columns = ["time", "host"]
+
+  ## Format of the COPY data, either "text" or "binary". The binary format
+  ## takes less CPU to encode and keeps the exact bits of floats, but only
+  ## supports columns of numeric, boolean, text, json and timestamp types.
+  # copy_format = "text"
+
+  ## Pooling mode of a connection pooler like PgBouncer between Telegraf and
+  ## the database, either "session" or "transaction". With "transaction" every
+  ## write runs in a single transaction, like with batch_transaction =
+  ## "write", the search_path of set_search_path is set in that transaction,
+  ## statements are not prepared and the upsert and staging insert modes copy
+  ## into a regular table instead of a temporary one.
+  # pool_mode = "session"
+
+  ## Buffer the written metrics and write them together, every
+  ## flush_interval or once flush_buffer_size metrics are buffered, to
+  ## amortize the cost of a COPY over several small writes. The buffered
+  ## metrics are flushed on shutdown. 0 for both writes every batch right
+  ## away.
+  # flush_interval = "0s"
+  # flush_buffer_size = 0
+
+  ## Log the statements and the first rows of every COPY instead of running
+  ## them, without connecting to the database.
+  # dry_run = false
+
+  ## Tables of specific measurements, overriding the table the measurement
+  ## is written to, its schema, its time column and the columns of its keys,
+  ## for example to write to an existing table. The table defaults to the
+  ## measurement name and no other measurement can be written to it.
+  # [[outputs.postgresql_copy.table]]
+  #   measurement = "cpu"
+  #   name = "legacy_cpu"
+  #   schema = "legacy"
+  #   time_column = "ts"
+  #   [outputs.postgresql_copy.table.column_names]
+  #     usage_idle = "idle"
+`
+
+func (p *PostgresqlCopy) Connect() error {
+	transforms, err := parseTransforms(p.ColumnTransforms)
+	if err != nil {
+		return err
+	}
+	p.transforms = transforms
+
+	typeKinds, err := parseColumnTypes(p.ColumnTypes)
+	if err != nil {
+		return err
+	}
+	for column := range p.ColumnTypes {
+		if _, ok := p.ColumnDomains[column]; ok {
+			return fmt.Errorf("column %s has both a column_types and a column_domains entry", column)
+		}
+	}
+	p.typeKinds = typeKinds
+	p.typeLengths = parseColumnLengths(p.ColumnTypes)
+
+	switch p.OnTypeError {
+	case "", "coerce", "drop":
+	default:
+		return fmt.Errorf("invalid on_type_error %q, must be \"coerce\" or \"drop\"", p.OnTypeError)
+	}
+
+	switch p.OnStringOverflow {
+	case "", "error", "truncate", "drop":
+	default:
+		return fmt.Errorf("invalid on_string_overflow %q, must be \"error\", \"truncate\" or \"drop\"", p.OnStringOverflow)
+	}
+
+	switch p.OnNonFinite {
+	case "", "write", "null", "drop", "error":
+	default:
+		return fmt.Errorf("invalid on_nonfinite %q, must be \"write\", \"null\", \"drop\" or \"error\"", p.OnNonFinite)
+	}
+
+	if len(p.TagInclude) > 0 || len(p.TagExclude) > 0 {
+		tagFilter, err := filter.NewIncludeExcludeFilter(p.TagInclude, p.TagExclude)
+		if err != nil {
+			return fmt.Errorf("invalid tag_include or tag_exclude: %s", err)
+		}
+		p.tagFilter = tagFilter
+	}
+	if len(p.FieldInclude) > 0 || len(p.FieldExclude) > 0 {
+		fieldFilter, err := filter.NewIncludeExcludeFilter(p.FieldInclude, p.FieldExclude)
+		if err != nil {
+			return fmt.Errorf("invalid field_include or field_exclude: %s", err)
+		}
+		p.fieldFilter = fieldFilter
+	}
+
+	tableTemplate, err := parseTableTemplate(p.TableTemplate)
+	if err != nil {
+		return err
+	}
+	if tableTemplate != nil && p.SingleTable {
+		return fmt.Errorf("table_template cannot be used with single_table")
+	}
+	p.tableTemplate = tableTemplate
+
+	switch p.OnTableCollision {
+	case "", "error", "suffix":
+	default:
+		return fmt.Errorf("invalid on_table_collision %q, must be \"error\" or \"suffix\"", p.OnTableCollision)
+	}
+	if tableTemplate != nil {
+		p.tableNames = newTableNames(p.OnTableCollision)
+	}
+
+	if p.TimeColumn == "" {
+		p.TimeColumn = "time"
+	}
+
+	overrides, overrideTables, err := parseTableOverrides(p.Tables, p.ColumnNames)
+	if err != nil {
+		return err
+	}
+	p.overrides, p.overrideTables = overrides, overrideTables
+
+	if p.SetSearchPath && p.Schema == "" {
+		return fmt.Errorf("set_search_path requires schema")
+	}
+
+	if p.SingleTable && p.TableName == "" {
+		return fmt.Errorf("single_table requires table_name")
+	}
+
+	if p.IncludeMeasurement && p.SingleTable {
+		return fmt.Errorf("include_measurement_column cannot be combined with single_table, which writes the measurement to the name column")
+	}
+
+	if _, ok := timestampPrecisions[p.TimestampPrecision]; !ok && p.TimestampPrecision != "" {
+		return fmt.Errorf("invalid timestamp_precision %q, must be \"ns\", \"us\", \"ms\" or \"s\"", p.TimestampPrecision)
+	}
+
+	if p.TimescaleDB && !p.AutoCreate {
+		return fmt.Errorf("timescaledb requires auto_create")
+	}
+
+	if len(p.Indexes) > 0 && !p.AutoCreate {
+		return fmt.Errorf("indexes requires auto_create")
+	}
+	for _, index := range p.Indexes {
+		if len(index) == 0 {
+			return fmt.Errorf("indexes cannot contain an empty column list")
+		}
+	}
+
+	if _, ok := partitionLayouts[p.PartitionBy]; !ok && p.PartitionBy != "" {
+		return fmt.Errorf("invalid partition_by %q, must be \"day\" or \"month\"", p.PartitionBy)
+	}
+	if p.PartitionBy != "" {
+		if !p.AutoCreate {
+			return fmt.Errorf("partition_by requires auto_create")
+		}
+		if p.TimescaleDB {
+			return fmt.Errorf("partition_by cannot be used with timescaledb")
+		}
+		if p.Dialect != "" && p.Dialect != "postgres" {
+			return fmt.Errorf("partition_by requires the postgres dialect")
+		}
+	}
+
+	switch p.CopyFormat {
+	case "", "text", "binary":
+	default:
+		return fmt.Errorf("invalid copy_format %q, must be \"text\" or \"binary\"", p.CopyFormat)
+	}
+
+	switch p.InsertMode {
+	case "", "copy":
+	case "upsert":
+		if len(p.ConflictColumns) == 0 {
+			return fmt.Errorf("insert_mode \"upsert\" requires conflict_columns")
+		}
+		if p.IsolateRowErrors {
+			return fmt.Errorf("insert_mode \"upsert\" cannot be used with isolate_row_errors")
+		}
+		if p.RejectTable != "" {
+			return fmt.Errorf("insert_mode \"upsert\" cannot be used with reject_table")
+		}
+	case "insert":
+		if p.IsolateRowErrors {
+			return fmt.Errorf("insert_mode \"insert\" cannot be used with isolate_row_errors")
+		}
+		if p.RejectTable != "" {
+			return fmt.Errorf("insert_mode \"insert\" cannot be used with reject_table")
+		}
+		if p.CopyFormat == "binary" {
+			return fmt.Errorf("insert_mode \"insert\" cannot be used with copy_format \"binary\"")
+		}
+	case "staging":
+		if p.IsolateRowErrors {
+			return fmt.Errorf("insert_mode \"staging\" cannot be used with isolate_row_errors")
+		}
+		if p.RejectTable != "" {
+			return fmt.Errorf("insert_mode \"staging\" cannot be used with reject_table")
+		}
+	default:
+		return fmt.Errorf("invalid insert_mode %q, must be \"copy\", \"upsert\", \"staging\" or \"insert\"", p.InsertMode)
+	}
+
+	switch p.BatchTransaction {
+	case "", "chunk", "write":
+	default:
+		return fmt.Errorf("invalid batch_transaction %q, must be \"chunk\" or \"write\"", p.BatchTransaction)
+	}
+
+	if p.ParallelTables {
+		// each table is written in its own transaction
+		if p.BatchTransaction == "write" {
+			return fmt.Errorf("parallel_tables cannot be used with batch_transaction \"write\"")
+		}
+		if p.InsertMode == "staging" {
+			return fmt.Errorf("parallel_tables cannot be used with insert_mode \"staging\"")
+		}
+	}
+
+	if p.InsertMode == "staging" {
+		// all tables of a write are inserted in a single transaction
+		p.BatchTransaction = "write"
+	}
+
+	switch p.PoolMode {
+	case "", "session":
+	case "transaction":
+		// a transaction pooler only keeps the server connection for the
+		// duration of a transaction
+		p.BatchTransaction = "write"
+	default:
+		return fmt.Errorf("invalid pool_mode %q, must be \"session\" or \"transaction\"", p.PoolMode)
+	}
+
+	d, err := lookupDialect(p.Dialect)
+	if err != nil {
+		return err
+	}
+	p.dialect = d
+	address, err := p.connectionString()
+	if err != nil {
+		return err
+	}
+	log.Printf("D! [outputs.postgresql_copy] Connecting with %s", redactAddress(address))
+
+	p.statsTags = statsTags(address)
+	p.rowsSkipped = selfstat.Register("postgresql_copy", "rows_skipped", p.statsTags)
+
+	if p.PoolStatsInterval.Duration > 0 || p.FlushInterval.Duration > 0 {
+		p.done = make(chan struct{})
+	}
+	if p.DryRun {
+		log.Printf("I! [outputs.postgresql_copy] dry_run is enabled, statements are logged instead of run")
+		p.acquire = func() (conn, error) {
+			return dryRunConn{}, nil
+		}
+	} else if err := p.open(address); err != nil {
+		p.done = nil
+		return err
+	}
+
+	if p.FlushInterval.Duration > 0 || p.FlushBufferSize > 0 {
+		p.buffer = &writeBuffer{}
+	}
+	if p.FlushInterval.Duration > 0 {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.flushLoop(p.FlushInterval.Duration, p.done)
+		}()
+	}
+	return nil
+}
+
+// open opens the connection pool of address and checks that the database
+// can be reached.
+func (p *PostgresqlCopy) open(address string) error {
+	db, err := sql.Open("pgx", address)
+	if err != nil {
+		return err
+	}
+	p.configurePool(db)
+	p.db = db
+	p.acquire = func() (conn, error) {
+		return acquirePgxConn(db, p.dialect, p.PoolMode == "transaction")
+	}
+
+	if err := p.checkConnection(); err != nil {
+		db.Close()
+		p.db = nil
+		return fmt.Errorf("connecting to database %q on %q: %s", p.statsTags["database"], p.statsTags["server"], err)
+	}
+
+	if p.PoolStatsInterval.Duration > 0 {
+		stats := newPoolStats(p.statsTags)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			stats.poll(db, p.PoolStatsInterval.Duration, p.done)
+		}()
+	}
+	return nil
+}
+
+// checkConnection runs a statement on a new connection, so that a wrong
+// address or an unavailable database fails Connect instead of the first write,
+// and checks that the schema exists.
+func (p *PostgresqlCopy) checkConnection() error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout.Duration)
+	defer cancel()
+
+	c, err := p.acquire()
+	if err != nil {
+		return err
+	}
+	defer c.Release()
+
+	if err := c.Exec(ctx, "SELECT 1"); err != nil {
+		return err
+	}
+	if p.Schema == "" {
+		return nil
+	}
+	exists, err := c.HasSchema(ctx, p.Schema)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("schema %s does not exist", p.Schema)
+	}
+	return nil
+}
+
+// configurePool applies the connection pool options to db. The pool holds
+// write_concurrency connections unless max_open_connections is set, and keeps
+// them all open between writes unless max_idle_connections is set.
+func (p *PostgresqlCopy) configurePool(db *sql.DB) {
+	maxOpen := p.poolSize()
+	if maxOpen > 0 {
+		db.SetMaxOpenConns(maxOpen)
+	}
+
+	maxIdle := p.MaxIdleConnections
+	if maxIdle <= 0 {
+		maxIdle = maxOpen
+	}
+	if maxIdle > 0 {
+		db.SetMaxIdleConns(maxIdle)
+	}
+
+	// Expired connections are closed when they are released after a write,
+	// or when found dead, and replaced by new connections on demand
+	db.SetConnMaxLifetime(p.ConnMaxLifetime.Duration)
+}
+
+// Close stops the background loops, writes the buffered metrics and closes
+// the connection pool. It can be called more than once, and without Connect.
+func (p *PostgresqlCopy) Close() error {
+	if p.done != nil {
+		close(p.done)
+		p.wg.Wait()
+		p.done = nil
+	}
+
+	var flushErr error
+	if p.buffer != nil {
+		p.buffer.Lock()
+		n := len(p.buffer.metrics)
+		p.buffer.Unlock()
+		if flushErr = p.flushBuffer(); flushErr != nil {
+			log.Printf("E! [outputs.postgresql_copy] Flushing buffered metrics failed, %d metrics lost: %s", n, flushErr)
+		}
+	}
+
+	if p.db == nil {
+		return flushErr
+	}
+	db := p.db
+	p.db = nil
+	if err := db.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
+
+func (p *PostgresqlCopy) SampleConfig() string {
+	return sampleConfig
+}
+
+func (p *PostgresqlCopy) Description() string {
+	return "Send metrics to PostgreSQL using COPY"
+}
+
+func (p *PostgresqlCopy) Write(metrics []telegraf.Metric) error {
+	if p.buffer != nil {
+		return p.bufferWrite(metrics)
+	}
+	return p.write(metrics)
+}
+
+// write writes metrics in write_concurrency concurrent batches.
+func (p *PostgresqlCopy) write(metrics []telegraf.Metric) error {
+	metrics = p.dropNonFinite(metrics)
+	writeBatch := p.writeBatch
+	if p.ParallelTables {
+		writeBatch = p.writeParallel
+	}
+	batches := splitBatches(metrics, p.WriteConcurrency)
+	if len(batches) == 1 {
+		return writeBatch(batches[0])
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(batches))
+	for i, batch := range batches {
+		wg.Add(1)
+		go func(i int, batch []telegraf.Metric) {
+			defer wg.Done()
+			errs[i] = writeBatch(batch)
+		}(i, batch)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitBatches splits metrics into at most n batches written concurrently.
+// All metrics of a series go to the same batch so that they are written in
+// order.
+func splitBatches(metrics []telegraf.Metric, n int) [][]telegraf.Metric {
+	if n <= 1 {
+		return [][]telegraf.Metric{metrics}
+	}
+
+	var batches [][]telegraf.Metric
+	series := make(map[uint64]int)
+	for _, m := range metrics {
+		i, ok := series[m.HashID()]
+		if !ok {
+			i = len(series) % n
+			series[m.HashID()] = i
+		}
+		if i == len(batches) {
+			batches = append(batches, nil)
+		}
+		batches[i] = append(batches[i], m)
+	}
+	if len(batches) == 0 {
+		return [][]telegraf.Metric{metrics}
+	}
+	return batches
+}
+
+// writeBatch writes metrics using a single connection, retrying up to
+// max_retries times on a new connection when the connection fails. Errors
+// of the statements themselves, like invalid values, are not retried.
+func (p *PostgresqlCopy) writeBatch(metrics []telegraf.Metric) error {
+	for retries := 0; ; retries++ {
+		connLost, err := p.tryWriteBatch(metrics)
+		if err == nil || !connLost || retries >= p.MaxRetries {
+			return err
+		}
+		log.Printf("W! [outputs.postgresql_copy] Connection failed, retrying write: %s", err)
+	}
+}
+
+// tryWriteBatch writes metrics using a single connection and reports whether
+// an error is due to the connection failing.
+func (p *PostgresqlCopy) tryWriteBatch(metrics []telegraf.Metric) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout.Duration)
+	defer cancel()
+
+	c, err := p.acquire()
+	if err != nil {
+		return true, err
+	}
+	defer c.Release()
+
+	if err := p.writeTables(ctx, c, metrics); err != nil {
+		return !c.Alive(), err
+	}
+	return false, nil
+}
+
+// writeTables writes metrics with one COPY per table.
+func (p *PostgresqlCopy) writeTables(ctx context.Context, c conn, metrics []telegraf.Metric) error {
+	layout := p.layout()
+	columns, err := buildColumns(metrics, layout)
+	if err != nil {
+		return err
+	}
+	byTable := make(map[string][]telegraf.Metric)
+	for _, m := range metrics {
+		table, err := layout.tableOf(m)
+		if err != nil {
+			return err
+		}
+		byTable[table] = append(byTable[table], m)
+	}
+
+	tables := make([]string, 0, len(columns))
+	for table := range columns {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	transaction := p.IsolateRowErrors || p.BatchTransaction == "write"
+	if transaction {
+		if err := c.Exec(ctx, "BEGIN"); err != nil {
+			return err
+		}
+		if p.SetSearchPath && p.PoolMode == "transaction" {
+			if err := c.Exec(ctx, "SET LOCAL search_path TO "+quoteIdentifier(p.Schema)); err != nil {
+				c.Exec(ctx, "ROLLBACK")
+				return err
+			}
+		}
+	}
+
+	// rows written in the transaction only count once it is committed
+	written := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		n, err := p.writeTable(ctx, c, table, columns[table], byTable[table])
+		if transaction {
+			written[table] = n
+		} else {
+			p.tableStats(table).rowsWritten.Incr(n)
+		}
+		if err != nil {
+			if transaction {
+				c.Exec(ctx, "ROLLBACK")
+			}
+			return err
+		}
+	}
+
+	if transaction {
+		if err := c.Exec(ctx, "COMMIT"); err != nil {
+			return err
+		}
+		for table, n := range written {
+			p.tableStats(table).rowsWritten.Incr(n)
+		}
+	}
+	return nil
+}
+
+// writeTable writes the metrics of a single table and returns the number of
+// rows written, including on error the rows written before it.
+func (p *PostgresqlCopy) writeTable(ctx context.Context, c conn, table string, columns []string, metrics []telegraf.Metric) (int64, error) {
+	if err := p.manageSchema(ctx, c, table, columns, metrics); err != nil {
+		return 0, fmt.Errorf("managing schema of table %s: %s", table, err)
+	}
+	columns = p.writableColumns(table, columns)
+	if p.PartitionBy != "" {
+		if err := p.createPartitions(ctx, c, table, metrics); err != nil {
+			return 0, fmt.Errorf("creating partitions of table %s: %s", table, err)
+		}
+	}
+
+	copyMetrics := p.copy
+	if p.IsolateRowErrors {
+		copyMetrics = p.copyRows
+	}
+	if p.InsertMode == "insert" {
+		copyMetrics = p.insert
+	}
+	n, err := copyMetrics(ctx, c, table, columns, metrics)
+	if err != nil {
+		p.tableStats(table).copyErrors.Incr(1)
+		return n, fmt.Errorf("copying into table %s: %s", table, err)
+	}
+	return n, nil
+}
+
+// copy writes metrics into table with one COPY statement per batch_size
+// rows, or a single one if batch_size is 0, and returns the number of rows
+// written.
+func (p *PostgresqlCopy) copy(ctx context.Context, c conn, table string, columns []string, metrics []telegraf.Metric) (int64, error) {
+	size := p.BatchSize
+	if size <= 0 || size > len(metrics) {
+		size = len(metrics)
+	}
+
+	encoders, err := p.encoders(table, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	query := p.dialect.copySQL(p.schemaOf(table), table, columns, p.CopyFormat)
+	for start := 0; start < len(metrics); start += size {
+		end := start + size
+		if end > len(metrics) {
+			end = len(metrics)
+		}
+
+		var buf bytes.Buffer
+		p.beginCopy(&buf)
+		var rowErr error
+		for _, m := range metrics[start:end] {
+			if rowErr = p.writeRow(&buf, m, columns, encoders); rowErr != nil {
+				break
+			}
+		}
+		p.endCopy(&buf)
+		if rowErr != nil && p.RejectTable == "" {
+			return written, rowErr
+		}
+		if p.RejectTable != "" {
+			var n int64
+			var err error
+			if rowErr != nil {
+				n, err = p.copyRowsOrReject(ctx, c, table, columns, metrics[start:end])
+			} else {
+				n, err = p.copyOrReject(ctx, c, table, query, columns, metrics[start:end], &buf)
+			}
+			written += n
+			if err != nil {
+				return written, err
+			}
+			continue
+		}
+		if p.InsertMode == "upsert" || p.InsertMode == "staging" {
+			insert := p.upsert
+			if p.InsertMode == "staging" {
+				insert = p.stage
+			}
+			if err := insert(ctx, c, table, columns, &buf); err != nil {
+				return written, err
+			}
+			written += int64(end - start)
+			continue
+		}
+		copyCtx, cancel := p.copyContext(ctx)
+		n, err := c.Copy(copyCtx, query, &buf)
+		cancel()
+		if err != nil {
+			return written, err
+		}
+		p.checkCopied(table, int64(end-start), n)
+		written += n
+	}
+	return written, nil
+}
+
+// checkCopied compares the number of rows a COPY into table wrote, as
+// reported by the server, with the number of rows sent. Rows missing are
+// counted as dropped.
+func (p *PostgresqlCopy) checkCopied(table string, sent, copied int64) {
+	if copied == sent {
+		return
+	}
+	log.Printf("W! [outputs.postgresql_copy] COPY into table %s wrote %d rows of %d", table, copied, sent)
+	if copied < sent {
+		p.tableStats(table).rowsDropped.Incr(sent - copied)
+	}
+}
+
+// copyContext returns the context of a single COPY, done after copy_timeout
+// if set.
+func (p *PostgresqlCopy) copyContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.CopyTimeout.Duration <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, p.CopyTimeout.Duration)
+}
+
+// copyRows writes metrics into table with one COPY per row, each under a
+// savepoint of the transaction of the batch. A row that fails is rolled back
+// to its savepoint and skipped, or written to reject_table if set, the other
+// rows are still written. It returns the number of rows written.
+func (p *PostgresqlCopy) copyRows(ctx context.Context, c conn, table string, columns []string, metrics []telegraf.Metric) (int64, error) {
+	encoders, err := p.encoders(table, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+
+	query := p.dialect.copySQL(p.schemaOf(table), table, columns, p.CopyFormat)
+	for _, m := range metrics {
+		var buf bytes.Buffer
+		p.beginCopy(&buf)
+		if err := p.writeRow(&buf, m, columns, encoders); err != nil {
+			if err := p.skipRow(ctx, c, table, m, err); err != nil {
+				return written, err
+			}
+			continue
+		}
+		p.endCopy(&buf)
+
+		if err := c.Exec(ctx, "SAVEPOINT row"); err != nil {
+			return written, err
+		}
+		copyCtx, cancel := p.copyContext(ctx)
+		n, err := c.Copy(copyCtx, query, &buf)
+		cancel()
+		if err != nil {
+			if copyCtx.Err() != nil || !c.Alive() {
+				return written, err
+			}
+			if err := c.Exec(ctx, "ROLLBACK TO SAVEPOINT row"); err != nil {
+				return written, err
+			}
+			p.tableStats(table).copyErrors.Incr(1)
+			if err := p.skipRow(ctx, c, table, m, err); err != nil {
+				return written, err
+			}
+			continue
+		}
+		if err := c.Exec(ctx, "RELEASE SAVEPOINT row"); err != nil {
+			return written, err
+		}
+		p.checkCopied(table, 1, n)
+		written += n
+	}
+	return written, nil
+}
+
+// skipRow writes m, the row of table that failed with err, to reject_table
+// if set and otherwise drops it.
+func (p *PostgresqlCopy) skipRow(ctx context.Context, c conn, table string, m telegraf.Metric, err error) error {
+	if p.RejectTable != "" {
+		log.Printf("W! [outputs.postgresql_copy] Rejecting row of table %s: %s", table, err)
+		if err := p.reject(ctx, c, table, m, err); err != nil {
+			return fmt.Errorf("writing to reject_table: %s", err)
+		}
+		p.tableStats(table).rowsRejected.Incr(1)
+		return nil
+	}
+
+	log.Printf("W! [outputs.postgresql_copy] Skipping row of table %s: %s", table, err)
+	if p.rowsSkipped != nil {
+		p.rowsSkipped.Incr(1)
+	}
+	p.tableStats(table).rowsDropped.Incr(1)
+	return nil
+}
+
+// tableStats returns the internal metrics of table, registering them on the
+// first write to the table.
+func (p *PostgresqlCopy) tableStats(table string) *tableStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats, ok := p.stats[table]
+	if !ok {
+		if p.stats == nil {
+			p.stats = make(map[string]*tableStats)
+		}
+		stats = newTableStats(p.statsTags, table)
+		p.stats[table] = stats
+	}
+	return stats
+}
+
+// encoders returns the binary encoders of columns of table with
+// copy_format = "binary", or nil with the text format.
+func (p *PostgresqlCopy) encoders(table string, columns []string) ([]binaryEncoder, error) {
+	if p.CopyFormat != "binary" {
+		return nil, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	encoders := make([]binaryEncoder, len(columns))
+	for i, column := range columns {
+		dataType, ok := p.tables[table][column]
+		if !ok {
+			return nil, fmt.Errorf("column %s of table %s does not exist", column, table)
+		}
+		encode, err := lookupBinaryEncoder(dataType, p.Domains)
+		if err != nil {
+			return nil, fmt.Errorf("column %s of table %s: %s", column, table, err)
+		}
+		encoders[i] = encode
+	}
+	return encoders, nil
+}
+
+// beginCopy writes what precedes the rows of a COPY to buf.
+func (p *PostgresqlCopy) beginCopy(buf *bytes.Buffer) {
+	if p.CopyFormat == "binary" {
+		buf.Write(binaryHeader)
+	}
+}
+
+// endCopy writes what follows the rows of a COPY to buf.
+func (p *PostgresqlCopy) endCopy(buf *bytes.Buffer) {
+	if p.CopyFormat == "binary" {
+		buf.Write(binaryTrailer)
+	}
+}
+
+// writeRow writes the COPY representation of m to buf, in the binary format
+// if encoders are set and in the text format otherwise.
+func (p *PostgresqlCopy) writeRow(buf *bytes.Buffer, m telegraf.Metric, columns []string, encoders []binaryEncoder) error {
+	if encoders != nil {
+		values, err := rowValues(m, columns, p.layout(), p.transforms)
+		if err != nil {
+			return err
+		}
+		row, err := appendBinaryRow(nil, values, encoders)
+		if err != nil {
+			return err
+		}
+		buf.Write(row)
+		return nil
+	}
+
+	values, err := buildValues(m, columns, p.layout(), p.transforms)
+	if err != nil {
+		return err
+	}
+	for i, value := range values {
+		if i > 0 {
+			buf.WriteByte('\t')
+		}
+		buf.WriteString(value)
+	}
+	buf.WriteByte('\n')
+	return nil
+}
+
+// buildColumns returns the columns of every table written by metrics, one
+// table per measurement unless the layout has a single table. The time column
+// comes first, followed by the name column with single_table, the measurement
+// column with include_measurement_column, the tags column
+// with tags_as_jsonb and the fields column with fields_as_jsonb, then by the
+// sorted union of the columns of the tag and field keys of all metrics of the
+// table that are written to their own column. Two different keys of a table
+// with the same column are an error, while a tag and a field with the same key
+// share their column unless tag_column_prefix or field_column_prefix tell them
+// apart, the tag value taking precedence.
+func buildColumns(metrics []telegraf.Metric, layout columnLayout) (Columns, error) {
+	// keys holds the key of every column, by table
+	keys := make(map[string]map[string]string)
+	add := func(table, column, key string) error {
+		if other, ok := keys[table][column]; ok && other != key {
+			return fmt.Errorf("table %s: keys %q and %q are both written to column %q", table, other, key, column)
+		}
+		keys[table][column] = key
+		return nil
+	}
+	for _, m := range metrics {
+		table, err := layout.tableOf(m)
+		if err != nil {
+			return nil, err
+		}
+		if keys[table] == nil {
+			keys[table] = make(map[string]string)
+		}
+		layout := layout.forMeasurement(m.Name())
+		if !layout.tagsAsJSONB {
+			for _, tag := range m.TagList() {
+				if !layout.keepTag(tag.Key) {
+					continue
+				}
+				if err := add(table, layout.tagColumn(tag.Key), tag.Key); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if !layout.fieldsAsJSONB {
+			for _, field := range m.FieldList() {
+				if !layout.keepField(field.Key) {
+					continue
+				}
+				if err := add(table, layout.fieldColumn(field.Key), field.Key); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	columns := make(Columns, len(keys))
+	for table, set := range keys {
+		layout := layout.forTable(table)
+		names := make([]string, 0, len(set))
+		for name := range set {
+			if !layout.reserved(name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		prefix := []string{layout.timeColumn}
+		if layout.table != "" {
+			prefix = append(prefix, nameColumn)
+		}
+		if layout.includeMeasurement {
+			prefix = append(prefix, measurementColumn)
+		}
+		if layout.tagsAsJSONB {
+			prefix = append(prefix, tagsColumn)
+		}
+		if layout.fieldsAsJSONB {
+			prefix = append(prefix, fieldsColumn)
+		}
+		columns[table] = append(prefix, names...)
+	}
+	return columns, nil
+}
+
+// buildValues returns the text COPY representation of the values of m for
+// every column, as returned by rowValues.
+func buildValues(m telegraf.Metric, columns []string, layout columnLayout, transforms map[string]transform) ([]string, error) {
+	row, err := rowValues(m, columns, layout, transforms)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, len(row))
+	for i, value := range row {
+		if value == nil {
+			values[i] = `\N`
+			continue
+		}
+		s, err := formatValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %s", columns[i], err)
+		}
+		values[i] = s
+	}
+	return values, nil
+}
+
+// rowValues returns the values of m for every column, nil for a column the
+// metric has no tag or field for, or an empty string with
+// convert_empty_string_to_null, or an empty tag with
+// convert_empty_tag_to_null. Field values of columns with a transform
+// are transformed first, then values of columns with a declared type are
+// coerced to it, or nil if they do not fit. Strings longer than the length
+// of their declared type are handled by on_string_overflow.
+func rowValues(m telegraf.Metric, columns []string, layout columnLayout, transforms map[string]transform) ([]interface{}, error) {
+	layout = layout.forMeasurement(m.Name())
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if column == layout.timeColumn {
+			t := m.Time()
+			if layout.precision > 0 {
+				t = t.Truncate(layout.precision)
+			}
+			values[i] = t
+			continue
+		}
+		if (layout.table != "" && column == nameColumn) ||
+			(layout.includeMeasurement && column == measurementColumn) {
+			values[i] = m.Name()
+			continue
+		}
+		if layout.tagsAsJSONB && column == tagsColumn {
+			b, err := json.Marshal(layout.tags(m))
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %s", column, err)
+			}
+			values[i] = string(b)
+			continue
+		}
+		if layout.fieldsAsJSONB && column == fieldsColumn {
+			s, err := formatFieldsJSON(m, layout, transforms)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %s", column, err)
+			}
+			values[i] = s
+			continue
+		}
+
+		var value interface{}
+		if tag, ok := layout.tagValue(m, column); ok {
+			if tag == "" && layout.emptyTagNull {
+				continue
+			}
+			value = tag
+		} else if field, ok := layout.fieldValue(m, column); ok {
+			var err error
+			value, err = transformField(column, field, transforms)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			continue
+		}
+		if s, ok := value.(string); ok && s == "" && layout.emptyStringNull {
+			continue
+		}
+		if isNonFinite(value) {
+			switch layout.onNonFinite {
+			case "error":
+				return nil, fmt.Errorf("column %s: non-finite value %v", column, value)
+			case "null", "drop":
+				// with drop, only a transform can still produce one
+				continue
+			}
+		}
+
+		if kind, ok := layout.types[column]; ok {
+			var fits bool
+			value, fits = coerceValue(value, kind, layout.coerceTypes)
+			if !fits {
+				continue
+			}
+		}
+		if length, ok := layout.lengths[column]; ok {
+			if s, ok := value.(string); ok && utf8.RuneCountInString(s) > length {
+				switch layout.stringOverflow {
+				case "truncate":
+					log.Printf("D! [outputs.postgresql_copy] Truncating value of column %s to %d characters", column, length)
+					value = truncateString(s, length)
+				case "drop":
+					log.Printf("D! [outputs.postgresql_copy] Dropping value of column %s longer than %d characters", column, length)
+					continue
+				default:
+					return nil, fmt.Errorf("column %s: value of %d characters is longer than %d", column, utf8.RuneCountInString(s), length)
+				}
+			}
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// transformField returns the value of the field key, transformed if the
+// field has a transform.
+func transformField(key string, value interface{}, transforms map[string]transform) (interface{}, error) {
+	t, ok := transforms[key]
+	if !ok {
+		return value, nil
+	}
+	value, err := applyTransform(t, value)
+	if err != nil {
+		return nil, fmt.Errorf("column %s: %s", key, err)
+	}
+	return value, nil
+}
+
+// formatFieldsJSON returns the fields of m that are written as a JSON object,
+// transformed like field columns. Integers are encoded exactly, without a
+// conversion to float. NaN and infinite values, which JSON cannot represent,
+// are written as strings like "NaN", or as null with on_nonfinite = "null".
+func formatFieldsJSON(m telegraf.Metric, layout columnLayout, transforms map[string]transform) (string, error) {
+	fields := make(map[string]interface{}, len(m.FieldList()))
+	for _, field := range m.FieldList() {
+		if !layout.keepField(field.Key) {
+			continue
+		}
+		value, err := transformField(field.Key, field.Value, transforms)
+		if err != nil {
+			return "", err
+		}
+		if f, ok := value.(float64); ok && isNonFinite(f) {
+			switch layout.onNonFinite {
+			case "error":
+				return "", fmt.Errorf("field %s: non-finite value %v", field.Key, f)
+			case "null", "drop":
+				value = nil
+			default:
+				value = formatFloat(f)
+			}
+		}
+		fields[field.Key] = value
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// formatValue returns the text COPY representation of a value.
+func formatValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	case string:
+		return escapeCopy(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return formatFloat(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		if !isComposite(v) {
+			return "", fmt.Errorf("unexpected type: %T: %#v", v, v)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return escapeCopy(string(b)), nil
+	}
+}
+
+// isComposite returns true if value is a slice, array or map, like the fields
+// of some aggregators, which are written as JSON.
+func isComposite(value interface{}) bool {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	default:
+		return false
+	}
+}
+
+var copyEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// escapeCopy escapes the characters that have a special meaning in the
+// text format of COPY.
+func escapeCopy(s string) string {
+	return copyEscaper.Replace(s)
+}
+
+// sanitizeIdentifier returns name lowercased, with every character other than
+// a letter, digit or underscore replaced by an underscore, so that it is a
+// plain PostgreSQL identifier.
+func sanitizeIdentifier(name string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func quoteIdentifier(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+// quoteTable returns the quoted name of table, qualified with schema if set.
+func quoteTable(schema, table string) string {
+	if schema == "" {
+		return quoteIdentifier(table)
+	}
+	return pgx.Identifier{schema, table}.Sanitize()
+}
+
+func init() {
+	outputs.Add("postgresql_copy", func() telegraf.Output {
+		return &PostgresqlCopy{
+			Timeout:            internal.Duration{Duration: time.Second * 5},
+			TimeColumn:         "time",
+			TimestampPrecision: "ns",
+			TableName:          "metrics",
+			ApplicationName:    "telegraf",
+			MaxRetries:         1,
+			BatchTransaction:   "chunk",
+			InsertMode:         "copy",
+			CopyFormat:         "text",
+			OnTypeError:        "coerce",
+			OnStringOverflow:   "error",
+			OnNonFinite:        "write",
+			WriteConcurrency:   1,
+			PoolStatsInterval:  internal.Duration{Duration: time.Second * 10},
+			tables:             make(map[string]map[string]string),
+		}
+	})
+}
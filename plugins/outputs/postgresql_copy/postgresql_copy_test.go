@@ -0,0 +1,1199 @@
+package postgresql_copy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/selfstat"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCopy struct {
+	query string
+	data  string
+}
+
+// fakeConn records the statements run by the plugin instead of sending them
+// to a database.
+type fakeConn struct {
+	sync.Mutex
+	tables map[string]map[string]string
+	execs  []string
+	// args are the arguments of every statement run with arguments
+	args   [][]interface{}
+	copies []fakeCopy
+	// copyErr, if set, returns the error of a COPY of data
+	copyErr    func(data string) error
+	extensions map[string]bool
+	schemas    map[string]bool
+	// hangCopies is the number of COPYs that block until they are canceled,
+	// losing the connection like a server that stopped responding
+	hangCopies int
+	dead       bool
+	// lostRows is the number of rows of every COPY the server reports as
+	// not written
+	lostRows int64
+	// released is the number of times the connection was released
+	released int
+}
+
+func (c *fakeConn) Exec(ctx context.Context, query string, args ...interface{}) error {
+	c.Lock()
+	defer c.Unlock()
+	c.execs = append(c.execs, query)
+	if len(args) > 0 {
+		c.args = append(c.args, args)
+	}
+	return nil
+}
+
+func (c *fakeConn) Columns(ctx context.Context, schema, table string) (map[string]string, error) {
+	c.Lock()
+	defer c.Unlock()
+	columns := make(map[string]string)
+	for name, dataType := range c.tables[table] {
+		columns[name] = dataType
+	}
+	return columns, nil
+}
+
+func (c *fakeConn) HasExtension(ctx context.Context, name string) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.extensions[name], nil
+}
+
+func (c *fakeConn) HasSchema(ctx context.Context, name string) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.schemas[name], nil
+}
+
+func (c *fakeConn) Copy(ctx context.Context, query string, r io.Reader) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	c.Lock()
+	hang := c.hangCopies > 0
+	if hang {
+		c.hangCopies--
+	}
+	c.Unlock()
+	if hang {
+		<-ctx.Done()
+		c.Lock()
+		c.dead = true
+		c.Unlock()
+		return 0, fmt.Errorf("COPY aborted: %s", ctx.Err())
+	}
+	if c.copyErr != nil {
+		if err := c.copyErr(string(data)); err != nil {
+			return 0, err
+		}
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.copies = append(c.copies, fakeCopy{query: query, data: string(data)})
+	return copyRowCount(data) - c.lostRows, nil
+}
+
+func (c *fakeConn) Alive() bool {
+	c.Lock()
+	defer c.Unlock()
+	return !c.dead
+}
+
+func (c *fakeConn) Release() error {
+	c.Lock()
+	defer c.Unlock()
+	c.released++
+	return nil
+}
+
+func newTestPostgresqlCopy(c *fakeConn) *PostgresqlCopy {
+	p := &PostgresqlCopy{
+		Timeout:    internal.Duration{Duration: time.Second * 5},
+		TimeColumn: "time",
+		tables:     make(map[string]map[string]string),
+	}
+	p.acquire = func() (conn, error) {
+		return c, nil
+	}
+	return p
+}
+
+func TestBuildColumns(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{"cpu": "cpu0"},
+			map[string]interface{}{"idle": 98.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("mem",
+			map[string]string{},
+			map[string]interface{}{"free": int64(42)},
+			time.Unix(0, 0)),
+	}
+
+	columns, err := buildColumns(metrics, columnLayout{timeColumn: "time"})
+	require.NoError(t, err)
+	require.Equal(t, Columns{
+		"cpu": {"time", "cpu", "host", "idle", "usage"},
+		"mem": {"time", "free"},
+	}, columns)
+}
+
+func TestBuildColumnsStable(t *testing.T) {
+	tags := map[string]string{}
+	fields := map[string]interface{}{}
+	for i := 0; i < 20; i++ {
+		tags[fmt.Sprintf("tag%02d", i)] = fmt.Sprintf("t%d", i)
+		fields[fmt.Sprintf("field%02d", i)] = int64(i)
+	}
+	m := testutil.MustMetric("cpu", tags, fields, time.Unix(0, 0))
+	layout := columnLayout{timeColumn: "time"}
+
+	expected, err := buildColumns([]telegraf.Metric{m}, layout)
+	require.NoError(t, err)
+	require.Equal(t, "time", expected["cpu"][0])
+	require.True(t, sort.StringsAreSorted(expected["cpu"][1:]))
+	expectedValues, err := buildValues(m, expected["cpu"], layout, nil)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		columns, err := buildColumns([]telegraf.Metric{m.Copy()}, layout)
+		require.NoError(t, err)
+		require.Equal(t, expected, columns)
+
+		values, err := buildValues(m.Copy(), columns["cpu"], layout, nil)
+		require.NoError(t, err)
+		require.Equal(t, expectedValues, values)
+	}
+}
+
+func TestBuildColumnsFilter(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("docker",
+			map[string]string{"host": "a", "container_id": "f00", "container_name": "web"},
+			map[string]interface{}{"usage": 1.5, "usage_debug": 2.5, "limit": int64(4)},
+			time.Unix(0, 0)),
+	}
+
+	tagFilter, err := filter.NewIncludeExcludeFilter(nil, []string{"container_id"})
+	require.NoError(t, err)
+	fieldFilter, err := filter.NewIncludeExcludeFilter([]string{"usage*"}, []string{"*_debug"})
+	require.NoError(t, err)
+
+	layout := columnLayout{timeColumn: "time", tagFilter: tagFilter, fieldFilter: fieldFilter}
+	columns, err := buildColumns(metrics, layout)
+	require.NoError(t, err)
+	require.Equal(t, Columns{
+		"docker": {"time", "container_name", "host", "usage"},
+	}, columns)
+
+	values, err := buildValues(metrics[0], columns["docker"], layout, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1970-01-01T00:00:00Z", "web", "a", "1.5"}, values)
+
+	layout = columnLayout{timeColumn: "time", tagsAsJSONB: true, fieldsAsJSONB: true, tagFilter: tagFilter, fieldFilter: fieldFilter}
+	columns, err = buildColumns(metrics, layout)
+	require.NoError(t, err)
+	values, err = buildValues(metrics[0], columns["docker"], layout, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"1970-01-01T00:00:00Z",
+		`{"container_name":"web","host":"a"}`,
+		`{"usage":1.5}`,
+	}, values)
+}
+
+func TestConnectInvalidFilter(t *testing.T) {
+	p := &PostgresqlCopy{TagExclude: []string{"["}}
+	require.Error(t, p.Connect())
+}
+
+func TestBuildValues(t *testing.T) {
+	m := testutil.MustMetric("cpu",
+		map[string]string{"host": "a\tb"},
+		map[string]interface{}{
+			"usage":   1.5,
+			"count":   int64(-3),
+			"bytes":   uint64(18446744073709551615),
+			"up":      true,
+			"message": "line1\nline2",
+		},
+		time.Unix(0, 1500).UTC())
+
+	values, err := buildValues(m, []string{"time", "bytes", "count", "host", "message", "missing", "up", "usage"}, columnLayout{timeColumn: "time"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"1970-01-01T00:00:00.0000015Z",
+		"18446744073709551615",
+		"-3",
+		`a\tb`,
+		`line1\nline2`,
+		`\N`,
+		"true",
+		"1.5",
+	}, values)
+}
+
+func TestFormatValueComposite(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{name: "slice", value: []float64{0.5, 0.99}, expected: "[0.5,0.99]"},
+		{name: "array", value: [2]int64{1, 2}, expected: "[1,2]"},
+		{name: "map", value: map[string]interface{}{"p50": 1.5, "label": "a\tb"}, expected: `{"label":"a\\tb","p50":1.5}`},
+		{name: "nested", value: []interface{}{map[string]int64{"n": 1}}, expected: `[{"n":1}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := formatValue(tt.value)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, s)
+			require.Equal(t, "jsonb", fieldType(tt.value))
+		})
+	}
+
+	_, err := formatValue(struct{}{})
+	require.Error(t, err)
+}
+
+func TestBuildValuesEmptyString(t *testing.T) {
+	m := testutil.MustMetric("log",
+		map[string]string{},
+		map[string]interface{}{"message": "", "level": "info"},
+		time.Unix(0, 0))
+	columns := []string{"time", "level", "message", "missing"}
+
+	values, err := buildValues(m, columns, columnLayout{timeColumn: "time"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1970-01-01T00:00:00Z", "info", "", `\N`}, values)
+
+	layout := columnLayout{timeColumn: "time", emptyStringNull: true}
+	values, err = buildValues(m, columns, layout, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1970-01-01T00:00:00Z", "info", `\N`, `\N`}, values)
+
+	row, err := rowValues(m, columns, layout, nil)
+	require.NoError(t, err)
+	require.Nil(t, row[2])
+}
+
+func TestBuildValuesEmptyTag(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("log",
+			map[string]string{"host": "a", "region": ""},
+			map[string]interface{}{"message": ""},
+			time.Unix(0, 0)),
+		testutil.MustMetric("log",
+			map[string]string{"host": "b"},
+			map[string]interface{}{"message": "up"},
+			time.Unix(0, 0)),
+	}
+	columns := []string{"time", "host", "message", "region"}
+
+	tests := []struct {
+		name     string
+		layout   columnLayout
+		expected [][]string
+	}{
+		{
+			name:   "default",
+			layout: columnLayout{timeColumn: "time"},
+			expected: [][]string{
+				{"1970-01-01T00:00:00Z", "a", "", ""},
+				{"1970-01-01T00:00:00Z", "b", "up", `\N`},
+			},
+		},
+		{
+			name:   "empty tag null",
+			layout: columnLayout{timeColumn: "time", emptyTagNull: true},
+			expected: [][]string{
+				{"1970-01-01T00:00:00Z", "a", "", `\N`},
+				{"1970-01-01T00:00:00Z", "b", "up", `\N`},
+			},
+		},
+		{
+			name:   "empty string null",
+			layout: columnLayout{timeColumn: "time", emptyStringNull: true},
+			expected: [][]string{
+				{"1970-01-01T00:00:00Z", "a", `\N`, `\N`},
+				{"1970-01-01T00:00:00Z", "b", "up", `\N`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, m := range metrics {
+				values, err := buildValues(m, columns, tt.layout, nil)
+				require.NoError(t, err)
+				require.Equal(t, tt.expected[i], values)
+			}
+		})
+	}
+}
+
+func TestBuildValuesEmptyTagJSONB(t *testing.T) {
+	m := testutil.MustMetric("log",
+		map[string]string{"host": "a", "region": ""},
+		map[string]interface{}{"message": "up"},
+		time.Unix(0, 0))
+	columns := []string{"time", "tags", "message"}
+
+	values, err := buildValues(m, columns, columnLayout{timeColumn: "time", tagsAsJSONB: true}, nil)
+	require.NoError(t, err)
+	require.Equal(t, `{"host":"a","region":""}`, values[1])
+
+	values, err = buildValues(m, columns, columnLayout{timeColumn: "time", tagsAsJSONB: true, emptyTagNull: true}, nil)
+	require.NoError(t, err)
+	require.Equal(t, `{"host":"a"}`, values[1])
+}
+
+func TestBuildValuesTimestampPrecision(t *testing.T) {
+	tests := []struct {
+		precision string
+		expected  string
+	}{
+		{precision: "ns", expected: "2019-06-01T12:30:45.123456789Z"},
+		{precision: "us", expected: "2019-06-01T12:30:45.123456Z"},
+		{precision: "ms", expected: "2019-06-01T12:30:45.123Z"},
+		{precision: "s", expected: "2019-06-01T12:30:45Z"},
+	}
+
+	m := testutil.MustMetric("cpu",
+		map[string]string{},
+		map[string]interface{}{"usage": 1.5},
+		time.Date(2019, 6, 1, 12, 30, 45, 123456789, time.UTC))
+	for _, tt := range tests {
+		t.Run(tt.precision, func(t *testing.T) {
+			layout := columnLayout{timeColumn: "time", precision: timestampPrecisions[tt.precision]}
+			values, err := buildValues(m, []string{"time"}, layout, nil)
+			require.NoError(t, err)
+			require.Equal(t, []string{tt.expected}, values)
+		})
+	}
+}
+
+func TestConnectInvalidTimestampPrecision(t *testing.T) {
+	p := &PostgresqlCopy{TimestampPrecision: "m"}
+	require.EqualError(t, p.Connect(), `invalid timestamp_precision "m", must be "ns", "us", "ms" or "s"`)
+}
+
+func TestBuildColumnsTagsAsJSONB(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{"cpu": "cpu0"},
+			map[string]interface{}{"idle": 98.5, "tags": "x"},
+			time.Unix(0, 0)),
+	}
+
+	columns, err := buildColumns(metrics, columnLayout{timeColumn: "time", tagsAsJSONB: true})
+	require.NoError(t, err)
+	require.Equal(t, Columns{
+		"cpu": {"time", "tags", "idle", "usage"},
+	}, columns)
+}
+
+func TestBuildValuesTagsAsJSONB(t *testing.T) {
+	m := testutil.MustMetric("cpu",
+		map[string]string{"host": "a", "path": `C:\tmp`},
+		map[string]interface{}{"usage": 1.5},
+		time.Unix(0, 0).UTC())
+
+	layout := columnLayout{timeColumn: "time", tagsAsJSONB: true}
+	values, err := buildValues(m, []string{"time", "tags", "host", "usage"}, layout, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"1970-01-01T00:00:00Z",
+		`{"host":"a","path":"C:\\\\tmp"}`,
+		`\N`,
+		"1.5",
+	}, values)
+}
+
+func TestBuildValuesFieldsAsJSONB(t *testing.T) {
+	m := testutil.MustMetric("cpu",
+		map[string]string{"host": "a"},
+		map[string]interface{}{
+			"count":   int64(9007199254740993),
+			"bytes":   uint64(18446744073709551615),
+			"usage":   1.5,
+			"up":      true,
+			"message": "ok",
+		},
+		time.Unix(0, 0).UTC())
+
+	layout := columnLayout{timeColumn: "time", fieldsAsJSONB: true}
+	values, err := buildValues(m, []string{"time", "fields", "host", "usage"}, layout, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"1970-01-01T00:00:00Z",
+		`{"bytes":18446744073709551615,"count":9007199254740993,"message":"ok","up":true,"usage":1.5}`,
+		"a",
+		`\N`,
+	}, values)
+}
+
+func TestWriteTagsAndFieldsAsJSONB(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.TagsAsJSONB = true
+	p.FieldsAsJSONB = true
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{"cpu": "cpu0"},
+			map[string]interface{}{"idle": 98.5},
+			time.Unix(1, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "cpu" ("time", "tags", "fields") FROM STDIN`,
+		data: "1970-01-01T00:00:00Z\t{\"host\":\"a\"}\t{\"usage\":1.5}\n" +
+			"1970-01-01T00:00:01Z\t{\"cpu\":\"cpu0\"}\t{\"idle\":98.5}\n",
+	}}, c.copies)
+}
+
+func TestBuildColumnsSingleTable(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("mem",
+			map[string]string{},
+			map[string]interface{}{"free": int64(42), "name": "x"},
+			time.Unix(0, 0)),
+	}
+
+	columns, err := buildColumns(metrics, columnLayout{table: "metrics", timeColumn: "time"})
+	require.NoError(t, err)
+	require.Equal(t, Columns{
+		"metrics": {"time", "name", "free", "host", "usage"},
+	}, columns)
+}
+
+func TestWriteSingleTable(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.SingleTable = true
+	p.TableName = "metrics"
+	p.TagsAsJSONB = true
+	p.FieldsAsJSONB = true
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("mem",
+			map[string]string{},
+			map[string]interface{}{"free": int64(42)},
+			time.Unix(1, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "metrics" ("time", "name", "tags", "fields") FROM STDIN`,
+		data: "1970-01-01T00:00:00Z\tcpu\t{\"host\":\"a\"}\t{\"usage\":1.5}\n" +
+			"1970-01-01T00:00:01Z\tmem\t{}\t{\"free\":42}\n",
+	}}, c.copies)
+}
+
+func TestConnectSingleTableRequiresTableName(t *testing.T) {
+	p := &PostgresqlCopy{SingleTable: true}
+	require.EqualError(t, p.Connect(), "single_table requires table_name")
+}
+
+func TestWriteIncludeMeasurementColumn(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.IncludeMeasurement = true
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a", "measurement": "x"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "cpu" ("time", "measurement", "host", "usage") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\tcpu\ta\t1.5\n",
+	}}, c.copies)
+}
+
+func TestConnectIncludeMeasurementColumnSingleTable(t *testing.T) {
+	p := &PostgresqlCopy{SingleTable: true, TableName: "metrics", IncludeMeasurement: true}
+	require.EqualError(t, p.Connect(), "include_measurement_column cannot be combined with single_table, which writes the measurement to the name column")
+}
+
+func TestWriteSparseFields(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("m",
+			map[string]string{},
+			map[string]interface{}{"x": int64(1)},
+			time.Unix(0, 0)),
+		testutil.MustMetric("m",
+			map[string]string{"host": "b"},
+			map[string]interface{}{"y": int64(2)},
+			time.Unix(1, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "m" ("time", "host", "x", "y") FROM STDIN`,
+		data: "1970-01-01T00:00:00Z\t\\N\t1\t\\N\n" +
+			"1970-01-01T00:00:01Z\tb\t\\N\t2\n",
+	}}, c.copies)
+}
+
+func TestWriteReservedIdentifiers(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("order",
+			map[string]string{"user": "a", "Host": "b", `say "hi"`: "c"},
+			map[string]interface{}{"select": 1.5},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "order" ("time" timestamptz, "Host" text, "say ""hi""" text, ` +
+			`"select" float8, "user" text)`,
+	}, c.execs)
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "order" ("time", "Host", "say ""hi""", "select", "user") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\tb\tc\t1.5\ta\n",
+	}}, c.copies)
+}
+
+func TestSanitizeIdentifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "cpu", expected: "cpu"},
+		{name: "cpu.usage.total", expected: "cpu_usage_total"},
+		{name: "Disk IO", expected: "disk_io"},
+		{name: "net-if_0", expected: "net_if_0"},
+		{name: `a"b`, expected: "a_b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, sanitizeIdentifier(tt.name))
+		})
+	}
+}
+
+func TestBuildColumnsSanitized(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"Host.Name": "a"},
+			map[string]interface{}{"usage total": 1.5, "cpu.usage": 2.5},
+			time.Unix(0, 0)),
+	}
+
+	layout := columnLayout{
+		timeColumn:      "time",
+		sanitizeColumns: true,
+		columnNames:     map[string]string{"cpu.usage": "usage_percent"},
+	}
+	columns, err := buildColumns(metrics, layout)
+	require.NoError(t, err)
+	require.Equal(t, Columns{
+		"cpu": {"time", "host_name", "usage_percent", "usage_total"},
+	}, columns)
+
+	values, err := buildValues(metrics[0], columns["cpu"], layout, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1970-01-01T00:00:00Z", "a", "2.5", "1.5"}, values)
+}
+
+func TestBuildColumnsCollision(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host.name": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{"host-name": "b"},
+			map[string]interface{}{"usage": 2.5},
+			time.Unix(0, 0)),
+	}
+
+	_, err := buildColumns(metrics, columnLayout{timeColumn: "time", sanitizeColumns: true})
+	require.EqualError(t, err, `table cpu: keys "host.name" and "host-name" are both written to column "host_name"`)
+}
+
+func TestBuildColumnsPrefix(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("http",
+			map[string]string{"status": "ok", "Host": "a"},
+			map[string]interface{}{"status": int64(200), "latency": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	layout := columnLayout{
+		timeColumn:      "time",
+		sanitizeColumns: true,
+		columnNames:     map[string]string{"latency": "latency_ms"},
+		tagPrefix:       "tag_",
+	}
+	columns, err := buildColumns(metrics, layout)
+	require.NoError(t, err)
+	require.Equal(t, Columns{
+		"http": {"time", "latency_ms", "status", "tag_host", "tag_status"},
+	}, columns)
+
+	values, err := buildValues(metrics[0], columns["http"], layout, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1970-01-01T00:00:00Z", "1.5", "200", "a", "ok"}, values)
+
+	layout = columnLayout{timeColumn: "time", tagPrefix: "t_", fieldPrefix: "f_"}
+	columns, err = buildColumns(metrics, layout)
+	require.NoError(t, err)
+	require.Equal(t, Columns{
+		"http": {"time", "f_latency", "f_status", "t_Host", "t_status"},
+	}, columns)
+}
+
+func TestWriteSanitizedColumns(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+	p.SanitizeColumns = true
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"Host": "a"},
+			map[string]interface{}{"Usage.Idle": 98.5},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "cpu" ("time" timestamptz, "host" text, "usage_idle" float8)`,
+	}, c.execs)
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "cpu" ("time", "host", "usage_idle") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\ta\t98.5\n",
+	}}, c.copies)
+}
+
+func TestWrite(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "b"},
+			map[string]interface{}{"idle": 98.5},
+			time.Unix(1, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "cpu" ("time", "host", "idle", "usage") FROM STDIN`,
+		data: "1970-01-01T00:00:00Z\ta\t\\N\t1.5\n" +
+			"1970-01-01T00:00:01Z\tb\t98.5\t\\N\n",
+	}}, c.copies)
+}
+
+func TestCloseWithoutConnect(t *testing.T) {
+	p := &PostgresqlCopy{}
+	require.NoError(t, p.Close())
+	require.NoError(t, p.Close())
+}
+
+func TestCloseClosesPool(t *testing.T) {
+	db, err := sql.Open("pgx", "host=localhost dbname=metrics")
+	require.NoError(t, err)
+
+	p := newTestPostgresqlCopy(&fakeConn{})
+	p.db = db
+	require.NoError(t, p.Close())
+	require.Nil(t, p.db)
+	require.EqualError(t, db.Ping(), "sql: database is closed")
+
+	require.NoError(t, p.Close())
+}
+
+func TestSplitBatches(t *testing.T) {
+	a1 := testutil.MustMetric("cpu",
+		map[string]string{"host": "a"},
+		map[string]interface{}{"usage": 1.0},
+		time.Unix(0, 0))
+	b1 := testutil.MustMetric("cpu",
+		map[string]string{"host": "b"},
+		map[string]interface{}{"usage": 2.0},
+		time.Unix(0, 0))
+	a2 := testutil.MustMetric("cpu",
+		map[string]string{"host": "a"},
+		map[string]interface{}{"usage": 3.0},
+		time.Unix(1, 0))
+	c1 := testutil.MustMetric("cpu",
+		map[string]string{"host": "c"},
+		map[string]interface{}{"usage": 4.0},
+		time.Unix(0, 0))
+	metrics := []telegraf.Metric{a1, b1, a2, c1}
+
+	require.Equal(t, [][]telegraf.Metric{metrics}, splitBatches(metrics, 1))
+	require.Equal(t, [][]telegraf.Metric{{a1, a2, c1}, {b1}}, splitBatches(metrics, 2))
+	require.Equal(t, [][]telegraf.Metric{{a1, a2}, {b1}, {c1}}, splitBatches(metrics, 8))
+}
+
+// concurrencyConn is a fakeConn that tracks how many connections are in use
+// at the same time.
+type concurrencyConn struct {
+	*fakeConn
+	pool *concurrencyPool
+}
+
+type concurrencyPool struct {
+	sync.Mutex
+	size     int
+	inUse    int
+	maxInUse int
+}
+
+func (c *concurrencyConn) Copy(ctx context.Context, query string, r io.Reader) (int64, error) {
+	// hold the connection long enough for the other batches to start
+	time.Sleep(50 * time.Millisecond)
+	return c.fakeConn.Copy(ctx, query, r)
+}
+
+func (c *concurrencyConn) Release() error {
+	c.pool.Lock()
+	defer c.pool.Unlock()
+	c.pool.inUse--
+	return nil
+}
+
+func TestWriteConcurrency(t *testing.T) {
+	var metrics []telegraf.Metric
+	for i := 0; i < 30; i++ {
+		metrics = append(metrics, testutil.MustMetric("cpu",
+			map[string]string{"host": strconv.Itoa(i)},
+			map[string]interface{}{"usage": float64(i)},
+			time.Unix(0, 0)))
+	}
+
+	for _, concurrency := range []int{1, 3} {
+		c := &fakeConn{}
+		pool := &concurrencyPool{size: concurrency}
+		p := newTestPostgresqlCopy(c)
+		p.WriteConcurrency = concurrency
+		p.acquire = func() (conn, error) {
+			pool.Lock()
+			defer pool.Unlock()
+			assert.True(t, pool.inUse < pool.size, "pool exhausted")
+			pool.inUse++
+			if pool.inUse > pool.maxInUse {
+				pool.maxInUse = pool.inUse
+			}
+			return &concurrencyConn{fakeConn: c, pool: pool}, nil
+		}
+
+		require.NoError(t, p.Write(metrics))
+		require.Equal(t, concurrency, pool.maxInUse)
+		require.Len(t, c.copies, concurrency)
+	}
+}
+
+func TestWriteIsolateRowErrors(t *testing.T) {
+	c := &fakeConn{
+		copyErr: func(data string) error {
+			if strings.Contains(data, "bad") {
+				return errors.New(`invalid input syntax for type double precision: "bad"`)
+			}
+			return nil
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.IsolateRowErrors = true
+	p.rowsSkipped = selfstat.Register("postgresql_copy", "rows_skipped",
+		map[string]string{"test": "TestWriteIsolateRowErrors"})
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": "1.5"},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": "bad"},
+			time.Unix(1, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": "2.5"},
+			time.Unix(2, 0)),
+	}
+	// the stats are registered for the whole process, only their change by
+	// the write is checked so that the test passes when run repeatedly
+	skipped := p.rowsSkipped.Get()
+	stats := p.tableStats("cpu")
+	written := stats.rowsWritten.Get()
+	dropped := stats.rowsDropped.Get()
+	copyErrors := stats.copyErrors.Get()
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []string{
+		"BEGIN",
+		"SAVEPOINT row",
+		"RELEASE SAVEPOINT row",
+		"SAVEPOINT row",
+		"ROLLBACK TO SAVEPOINT row",
+		"SAVEPOINT row",
+		"RELEASE SAVEPOINT row",
+		"COMMIT",
+	}, c.execs)
+	require.Equal(t, []fakeCopy{
+		{query: `COPY "cpu" ("time", "usage") FROM STDIN`, data: "1970-01-01T00:00:00Z\t1.5\n"},
+		{query: `COPY "cpu" ("time", "usage") FROM STDIN`, data: "1970-01-01T00:00:02Z\t2.5\n"},
+	}, c.copies)
+	require.Equal(t, int64(1), p.rowsSkipped.Get()-skipped)
+	require.Equal(t, int64(2), stats.rowsWritten.Get()-written)
+	require.Equal(t, int64(1), stats.rowsDropped.Get()-dropped)
+	require.Equal(t, int64(1), stats.copyErrors.Get()-copyErrors)
+}
+
+func TestWriteCopiedMismatch(t *testing.T) {
+	c := &fakeConn{lostRows: 1}
+	p := newTestPostgresqlCopy(c)
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 2.5},
+			time.Unix(1, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 3.5},
+			time.Unix(2, 0)),
+	}
+	stats := p.tableStats("cpu")
+	written := stats.rowsWritten.Get()
+	dropped := stats.rowsDropped.Get()
+	require.NoError(t, p.Write(metrics))
+	require.Len(t, c.copies, 1)
+	require.Equal(t, int64(2), stats.rowsWritten.Get()-written)
+	require.Equal(t, int64(1), stats.rowsDropped.Get()-dropped)
+}
+
+func TestWriteWithoutRowIsolationFails(t *testing.T) {
+	c := &fakeConn{
+		copyErr: func(data string) error {
+			return errors.New("invalid input syntax")
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": "bad"},
+			time.Unix(0, 0)),
+	}
+	stats := p.tableStats("cpu")
+	written := stats.rowsWritten.Get()
+	copyErrors := stats.copyErrors.Get()
+	require.EqualError(t, p.Write(metrics), "copying into table cpu: invalid input syntax")
+	require.Empty(t, c.execs)
+	require.Equal(t, int64(0), stats.rowsWritten.Get()-written)
+	require.Equal(t, int64(1), stats.copyErrors.Get()-copyErrors)
+}
+
+func TestWriteBatchSize(t *testing.T) {
+	var metrics []telegraf.Metric
+	for i := 0; i < 5; i++ {
+		metrics = append(metrics, testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": float64(i)},
+			time.Unix(int64(i), 0)))
+	}
+
+	tests := []struct {
+		name        string
+		batchSize   int
+		transaction string
+		copies      int
+		execs       []string
+	}{
+		{name: "unlimited", batchSize: 0, copies: 1},
+		{name: "smaller batch", batchSize: 10, copies: 1},
+		{name: "equal batch", batchSize: 5, copies: 1},
+		{name: "chunked", batchSize: 2, transaction: "chunk", copies: 3},
+		{name: "single transaction", batchSize: 2, transaction: "write", copies: 3, execs: []string{"BEGIN", "COMMIT"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeConn{}
+			p := newTestPostgresqlCopy(c)
+			p.BatchSize = tt.batchSize
+			p.BatchTransaction = tt.transaction
+
+			require.NoError(t, p.Write(metrics))
+			require.Len(t, c.copies, tt.copies)
+			require.Equal(t, tt.execs, c.execs)
+
+			var data string
+			for _, copy := range c.copies {
+				data += copy.data
+			}
+			require.Equal(t, 5, strings.Count(data, "\n"))
+		})
+	}
+}
+
+func TestConnectInvalidBatchTransaction(t *testing.T) {
+	p := &PostgresqlCopy{BatchTransaction: "batch"}
+	require.Error(t, p.Connect())
+}
+
+func TestWritePoolModeTransaction(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.PoolMode = "transaction"
+	p.BatchTransaction = "write"
+	p.Schema = "telemetry"
+	p.SetSearchPath = true
+
+	require.NoError(t, p.Write(metrics))
+	require.Equal(t, []string{`BEGIN`, `SET LOCAL search_path TO "telemetry"`, `COMMIT`}, c.execs)
+	require.Len(t, c.copies, 1)
+}
+
+func TestConnectPoolMode(t *testing.T) {
+	p := &PostgresqlCopy{PoolMode: "statement"}
+	require.EqualError(t, p.Connect(), `invalid pool_mode "statement", must be "session" or "transaction"`)
+}
+
+func TestCheckConnection(t *testing.T) {
+	c := &fakeConn{schemas: map[string]bool{"telemetry": true}}
+	p := newTestPostgresqlCopy(c)
+	require.NoError(t, p.checkConnection())
+	require.Equal(t, []string{"SELECT 1"}, c.execs)
+
+	p.Schema = "telemetry"
+	require.NoError(t, p.checkConnection())
+
+	p.Schema = "metrics"
+	require.EqualError(t, p.checkConnection(), "schema metrics does not exist")
+}
+
+func TestConnectUnavailable(t *testing.T) {
+	p := &PostgresqlCopy{
+		Address: "host=127.0.0.1 port=1 dbname=metrics sslmode=disable",
+		Timeout: internal.Duration{Duration: time.Second},
+	}
+	err := p.Connect()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `connecting to database "metrics" on "127.0.0.1": `)
+	require.Nil(t, p.db)
+}
+
+// brokenConn is a connection that failed, like one to a database that
+// restarted.
+type brokenConn struct {
+	*fakeConn
+}
+
+func (c *brokenConn) Copy(ctx context.Context, query string, r io.Reader) (int64, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func (c *brokenConn) Alive() bool {
+	return false
+}
+
+func TestWriteRetryConnectionFailure(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	tests := []struct {
+		name       string
+		maxRetries int
+		broken     int
+		attempts   int
+		err        bool
+	}{
+		{name: "retried", maxRetries: 1, broken: 1, attempts: 2},
+		{name: "retries exhausted", maxRetries: 1, broken: 2, attempts: 2, err: true},
+		{name: "no retries", maxRetries: 0, broken: 1, attempts: 1, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeConn{}
+			p := newTestPostgresqlCopy(c)
+			p.MaxRetries = tt.maxRetries
+
+			attempts := 0
+			p.acquire = func() (conn, error) {
+				attempts++
+				if attempts <= tt.broken {
+					return &brokenConn{fakeConn: c}, nil
+				}
+				return c, nil
+			}
+
+			err := p.Write(metrics)
+			if tt.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Len(t, c.copies, 1)
+			}
+			require.Equal(t, tt.attempts, attempts)
+		})
+	}
+}
+
+func TestWriteCopyTimeout(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	tests := []struct {
+		name       string
+		hangCopies int
+		err        bool
+	}{
+		{name: "retried", hangCopies: 1},
+		{name: "retries exhausted", hangCopies: 2, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeConn{hangCopies: tt.hangCopies}
+			p := newTestPostgresqlCopy(c)
+			p.MaxRetries = 1
+			p.CopyTimeout.Duration = 10 * time.Millisecond
+
+			start := time.Now()
+			err := p.Write(metrics)
+			require.True(t, time.Since(start) < p.Timeout.Duration)
+			if tt.err {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+			} else {
+				require.NoError(t, err)
+				require.Len(t, c.copies, 1)
+			}
+		})
+	}
+}
+
+func TestWriteNoRetryStatementError(t *testing.T) {
+	c := &fakeConn{
+		copyErr: func(data string) error {
+			return pgx.PgError{Code: "22P02", Message: "invalid input syntax for type double precision"}
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.MaxRetries = 3
+
+	attempts := 0
+	p.acquire = func() (conn, error) {
+		attempts++
+		return c, nil
+	}
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": "bad"},
+			time.Unix(0, 0)),
+	}
+	require.Error(t, p.Write(metrics))
+	require.Equal(t, 1, attempts)
+}
+
+func TestWriteRetryAcquireFailure(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.MaxRetries = 1
+
+	attempts := 0
+	p.acquire = func() (conn, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errors.New("dial tcp 127.0.0.1:5432: connect: connection refused")
+		}
+		return c, nil
+	}
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+	require.Equal(t, 2, attempts)
+}
@@ -0,0 +1,146 @@
+package postgresql_copy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"strconv"
+
+	"github.com/influxdata/telegraf"
+)
+
+// copyOrReject copies the rows of r, the encoded metrics, into table. If the
+// COPY fails for an error of the data, the metrics are written again row by
+// row, the rows that fail being written to reject_table. It returns the number
+// of rows written to table.
+func (p *PostgresqlCopy) copyOrReject(ctx context.Context, c conn, table, query string, columns []string, metrics []telegraf.Metric, r io.Reader) (int64, error) {
+	// a failed statement aborts the transaction of the write, rolling back to
+	// the savepoint keeps it usable for the rows
+	savepoint := p.BatchTransaction == "write"
+	if savepoint {
+		if err := c.Exec(ctx, "SAVEPOINT chunk"); err != nil {
+			return 0, err
+		}
+	}
+
+	copyCtx, cancel := p.copyContext(ctx)
+	n, err := c.Copy(copyCtx, query, r)
+	cancel()
+	if err == nil {
+		if savepoint {
+			if err := c.Exec(ctx, "RELEASE SAVEPOINT chunk"); err != nil {
+				return 0, err
+			}
+		}
+		p.checkCopied(table, int64(len(metrics)), n)
+		return n, nil
+	}
+	if copyCtx.Err() != nil || !c.Alive() {
+		return 0, err
+	}
+
+	log.Printf("W! [outputs.postgresql_copy] COPY into table %s failed, writing its rows one by one: %s", table, err)
+	p.tableStats(table).copyErrors.Incr(1)
+	if savepoint {
+		if err := c.Exec(ctx, "ROLLBACK TO SAVEPOINT chunk"); err != nil {
+			return 0, err
+		}
+	}
+	return p.copyRowsOrReject(ctx, c, table, columns, metrics)
+}
+
+// copyRowsOrReject writes metrics into table row by row, the rows that fail
+// being written to reject_table. Unless the write is already in a transaction
+// with batch_transaction = "write", the rows are written in a transaction of
+// their own, required by the savepoints of the rows.
+func (p *PostgresqlCopy) copyRowsOrReject(ctx context.Context, c conn, table string, columns []string, metrics []telegraf.Metric) (int64, error) {
+	transaction := p.BatchTransaction != "write"
+	if transaction {
+		if err := c.Exec(ctx, "BEGIN"); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := p.copyRows(ctx, c, table, columns, metrics)
+	if err != nil {
+		if transaction {
+			c.Exec(ctx, "ROLLBACK")
+		}
+		return 0, err
+	}
+
+	if transaction {
+		if err := c.Exec(ctx, "COMMIT"); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// reject writes m, the row of table that failed with err, to reject_table.
+func (p *PostgresqlCopy) reject(ctx context.Context, c conn, table string, m telegraf.Metric, err error) error {
+	if err := p.createRejectTable(ctx, c); err != nil {
+		return err
+	}
+
+	metric, jsonErr := metricJSON(m)
+	if jsonErr != nil {
+		return jsonErr
+	}
+	return c.Exec(ctx, insertRejectSQL(p.Schema, p.RejectTable), m.Time(), table, err.Error(), metric)
+}
+
+// createRejectTable creates reject_table with auto_create, once.
+func (p *PostgresqlCopy) createRejectTable(ctx context.Context, c conn) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rejectTableCreated || !p.AutoCreate {
+		return nil
+	}
+	if err := c.Exec(ctx, createRejectTableSQL(p.Schema, p.RejectTable)); err != nil {
+		return err
+	}
+	p.rejectTableCreated = true
+	return nil
+}
+
+// createRejectTableSQL returns the statement creating the reject table: the
+// time of the metric, the table it was written to, the error and the metric
+// as JSON.
+func createRejectTableSQL(schema, table string) string {
+	return "CREATE TABLE IF NOT EXISTS " + quoteTable(schema, table) + " (" +
+		`"time" timestamptz, "table_name" text, "error" text, "metric" jsonb, ` +
+		`"rejected_at" timestamptz DEFAULT now())`
+}
+
+func insertRejectSQL(schema, table string) string {
+	return "INSERT INTO " + quoteTable(schema, table) +
+		` ("time", "table_name", "error", "metric") VALUES ($1, $2, $3, $4)`
+}
+
+// metricJSON returns m as a JSON object with its name, tags, fields and
+// timestamp in nanoseconds. Non finite floats, which JSON cannot represent, are
+// written as strings.
+func metricJSON(m telegraf.Metric) (string, error) {
+	fields := make(map[string]interface{}, len(m.FieldList()))
+	for _, field := range m.FieldList() {
+		value := field.Value
+		if f, ok := value.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			value = strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		fields[field.Key] = value
+	}
+
+	b, err := json.Marshal(struct {
+		Name      string                 `json:"name"`
+		Tags      map[string]string      `json:"tags"`
+		Fields    map[string]interface{} `json:"fields"`
+		Timestamp int64                  `json:"timestamp"`
+	}{m.Name(), m.Tags(), fields, m.Time().UnixNano()})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
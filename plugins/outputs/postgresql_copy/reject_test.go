@@ -0,0 +1,124 @@
+package postgresql_copy
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateRejectTableSQL(t *testing.T) {
+	require.Equal(t,
+		`CREATE TABLE IF NOT EXISTS "telemetry"."rejects" ("time" timestamptz, "table_name" text, `+
+			`"error" text, "metric" jsonb, "rejected_at" timestamptz DEFAULT now())`,
+		createRejectTableSQL("telemetry", "rejects"))
+	require.Equal(t,
+		`INSERT INTO "rejects" ("time", "table_name", "error", "metric") VALUES ($1, $2, $3, $4)`,
+		insertRejectSQL("", "rejects"))
+}
+
+func TestMetricJSON(t *testing.T) {
+	m := testutil.MustMetric("cpu",
+		map[string]string{"host": "a"},
+		map[string]interface{}{"usage": 1.5, "idle": math.NaN()},
+		time.Unix(1, 0))
+
+	metric, err := metricJSON(m)
+	require.NoError(t, err)
+	require.Equal(t,
+		`{"name":"cpu","tags":{"host":"a"},"fields":{"idle":"NaN","usage":1.5},"timestamp":1000000000}`,
+		metric)
+}
+
+func TestWriteRejectTable(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": "1.5"},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": "bad"},
+			time.Unix(1, 0)),
+	}
+
+	tests := []struct {
+		name             string
+		batchTransaction string
+		autoCreate       bool
+		execs            []string
+	}{
+		{
+			name: "chunk",
+			execs: []string{
+				"BEGIN",
+				"SAVEPOINT row",
+				"RELEASE SAVEPOINT row",
+				"SAVEPOINT row",
+				"ROLLBACK TO SAVEPOINT row",
+				`INSERT INTO "rejects" ("time", "table_name", "error", "metric") VALUES ($1, $2, $3, $4)`,
+				"COMMIT",
+			},
+		},
+		{
+			name:             "write",
+			batchTransaction: "write",
+			execs: []string{
+				"BEGIN",
+				"SAVEPOINT chunk",
+				"ROLLBACK TO SAVEPOINT chunk",
+				"SAVEPOINT row",
+				"RELEASE SAVEPOINT row",
+				"SAVEPOINT row",
+				"ROLLBACK TO SAVEPOINT row",
+				`INSERT INTO "rejects" ("time", "table_name", "error", "metric") VALUES ($1, $2, $3, $4)`,
+				"COMMIT",
+			},
+		},
+		{
+			name:       "auto_create",
+			autoCreate: true,
+			execs: []string{
+				"BEGIN",
+				"SAVEPOINT row",
+				"RELEASE SAVEPOINT row",
+				"SAVEPOINT row",
+				"ROLLBACK TO SAVEPOINT row",
+				createRejectTableSQL("", "rejects"),
+				`INSERT INTO "rejects" ("time", "table_name", "error", "metric") VALUES ($1, $2, $3, $4)`,
+				"COMMIT",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeConn{
+				tables: map[string]map[string]string{
+					"cpu": {"time": "timestamptz", "usage": "double precision"},
+				},
+				copyErr: func(data string) error {
+					if strings.Contains(data, "bad") {
+						return errors.New(`invalid input syntax for type double precision: "bad"`)
+					}
+					return nil
+				},
+			}
+			p := newTestPostgresqlCopy(c)
+			p.RejectTable = "rejects"
+			p.BatchTransaction = tt.batchTransaction
+			p.AutoCreate = tt.autoCreate
+
+			require.NoError(t, p.Write(metrics))
+			require.Equal(t, tt.execs, c.execs)
+			require.Equal(t, []fakeCopy{
+				{query: `COPY "cpu" ("time", "usage") FROM STDIN`, data: "1970-01-01T00:00:00Z\t1.5\n"},
+			}, c.copies)
+		})
+	}
+}
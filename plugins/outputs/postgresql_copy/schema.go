@@ -0,0 +1,362 @@
+package postgresql_copy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/jackc/pgx"
+)
+
+// generatedType is the data type of the columns that cannot be written,
+// identity columns GENERATED ALWAYS and generated columns.
+const generatedType = "generated"
+
+// writableColumns returns columns without the generated columns of table, a
+// COPY listing them fails. They are never written, a tag or field with the
+// name of one is dropped.
+func (p *PostgresqlCopy) writableColumns(table string, columns []string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	writable := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if p.tables[table][column] == generatedType {
+			log.Printf("D! [outputs.postgresql_copy] Not writing generated column %s of table %s", column, table)
+			continue
+		}
+		writable = append(writable, column)
+	}
+	return writable
+}
+
+// manageSchema brings the schema of table up to date before the first write
+// to it, the columns of the table are cached so later writes skip it. With
+// auto_create a missing table is created with the columns of metrics, with
+// auto_add_columns the columns of metrics missing from the table are added.
+// A missing table that is not created is not cached, so that its columns are
+// loaded once it exists. The lock is only held to access the cache, not while
+// the schema is queried or changed.
+func (p *PostgresqlCopy) manageSchema(ctx context.Context, c conn, table string, columns []string, metrics []telegraf.Metric) error {
+	p.mu.Lock()
+	createDomains := !p.domainsCreated && (p.AutoCreate || p.AutoAddColumns)
+	existing, ok := p.tables[table]
+	p.mu.Unlock()
+
+	if createDomains {
+		if err := p.createDomains(ctx, c); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		p.domainsCreated = true
+		p.mu.Unlock()
+	}
+
+	if !ok {
+		var err error
+		existing, err = c.Columns(ctx, p.schemaOf(table), table)
+		if err != nil {
+			return err
+		}
+
+		if len(existing) == 0 {
+			// A table that does not exist fails the COPY with a clearer
+			// error than adding columns to it would
+			if !p.AutoCreate {
+				return nil
+			}
+
+			layout := p.layout().forTable(table)
+			types := columnTypes(columns, metrics, layout, p.ColumnTypes, p.ColumnDomains)
+			query := createTableSQL(p.schemaOf(table), table, columns, types)
+			if p.PartitionBy != "" {
+				query += partitionBySQL(layout.timeColumn)
+			}
+			if err := c.Exec(ctx, query); err != nil {
+				return err
+			}
+			if p.TimescaleDB {
+				if err := p.createHypertable(ctx, c, table); err != nil {
+					return err
+				}
+			}
+			if err := p.createIndexes(ctx, c, table, types); err != nil {
+				return err
+			}
+			p.mu.Lock()
+			p.tables[table] = types
+			p.mu.Unlock()
+			return nil
+		}
+
+		if err := p.renameColumns(ctx, c, table, existing); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		p.tables[table] = existing
+		p.mu.Unlock()
+	}
+
+	if p.AutoAddColumns {
+		return p.addColumns(ctx, c, table, existing, columns, metrics)
+	}
+	return nil
+}
+
+// addColumns adds the columns missing from table, whose cached columns are
+// existing, and caches them. existing is only accessed with the lock held.
+func (p *PostgresqlCopy) addColumns(ctx context.Context, c conn, table string, existing map[string]string, columns []string, metrics []telegraf.Metric) error {
+	var missing []string
+	p.mu.Lock()
+	for _, column := range columns {
+		if _, ok := existing[column]; !ok {
+			missing = append(missing, column)
+		}
+	}
+	p.mu.Unlock()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	types := columnTypes(missing, metrics, p.layout().forTable(table), p.ColumnTypes, p.ColumnDomains)
+	for _, column := range missing {
+		err := c.Exec(ctx, addColumnSQL(p.schemaOf(table), table, column, types[column]))
+		// IF NOT EXISTS covers another writer adding the column first, but
+		// not every database serializes it with the check, so a duplicate
+		// column error is the same outcome
+		if err != nil && !isDuplicateColumn(err) {
+			return err
+		}
+		p.mu.Lock()
+		existing[column] = types[column]
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// isDuplicateColumn returns true for the duplicate_column error.
+func isDuplicateColumn(err error) bool {
+	pgErr, ok := err.(pgx.PgError)
+	return ok && pgErr.Code == "42701"
+}
+
+func addColumnSQL(schema, table, column, dataType string) string {
+	return "ALTER TABLE " + quoteTable(schema, table) +
+		" ADD COLUMN IF NOT EXISTS " + quoteIdentifier(column) + " " + dataType
+}
+
+// columnTypes returns the PostgreSQL type of every column, the time column is
+// a timestamptz, the name column of single_table and the measurement column of
+// include_measurement_column are text, the tags and fields columns of
+// tags_as_jsonb and fields_as_jsonb are jsonb, tags are text and fields are
+// typed after their value in the first metric that has the field.
+// Unsigned fields are numeric, as their values may not fit in an int8, and so
+// are integer fields any metric has an unsigned value for. Columns with a declared
+// type or a domain use it as type.
+func columnTypes(columns []string, metrics []telegraf.Metric, layout columnLayout, declared, domains map[string]string) map[string]string {
+	types := map[string]string{layout.timeColumn: "timestamptz"}
+	if layout.table != "" {
+		types[nameColumn] = "text"
+	}
+	if layout.includeMeasurement {
+		types[measurementColumn] = "text"
+	}
+	if layout.tagsAsJSONB {
+		types[tagsColumn] = "jsonb"
+	}
+	if layout.fieldsAsJSONB {
+		types[fieldsColumn] = "jsonb"
+	}
+	for _, column := range columns {
+		if dataType, ok := declared[column]; ok {
+			types[column] = dataType
+			continue
+		}
+		if domain, ok := domains[column]; ok {
+			types[column] = quoteIdentifier(domain)
+			continue
+		}
+		if layout.reserved(column) {
+			continue
+		}
+		for _, m := range metrics {
+			if _, ok := layout.tagValue(m, column); ok {
+				types[column] = "text"
+				break
+			}
+			if value, ok := layout.fieldValue(m, column); ok {
+				// an int8 column is widened if a later value is unsigned
+				dataType := fieldType(value)
+				if previous, ok := types[column]; !ok || previous == "int8" && dataType == "numeric" {
+					types[column] = dataType
+				}
+				if types[column] != "int8" {
+					break
+				}
+			}
+		}
+	}
+	return types
+}
+
+// fieldType returns the PostgreSQL type of a field value.
+func fieldType(value interface{}) string {
+	switch value.(type) {
+	case int64:
+		return "int8"
+	case uint64:
+		// uint64 values may not fit in an int8
+		return "numeric"
+	case float64:
+		return "float8"
+	case bool:
+		return "boolean"
+	default:
+		if isComposite(value) {
+			return "jsonb"
+		}
+		return "text"
+	}
+}
+
+// createDomains creates the configured domains that do not exist yet, before
+// they are used as column types.
+func (p *PostgresqlCopy) createDomains(ctx context.Context, c conn) error {
+	names := make([]string, 0, len(p.Domains))
+	for name := range p.Domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := c.Exec(ctx, createDomainSQL(name, p.Domains[name])); err != nil {
+			return fmt.Errorf("creating domain %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// createIndexes creates the indexes of a table created by the plugin, whose
+// columns are types. An index with a column missing from the table is skipped
+// and a warning logged.
+func (p *PostgresqlCopy) createIndexes(ctx context.Context, c conn, table string, types map[string]string) error {
+	for _, columns := range p.Indexes {
+		missing := ""
+		for _, column := range columns {
+			if _, ok := types[column]; !ok {
+				missing = column
+				break
+			}
+		}
+		if missing != "" {
+			log.Printf("W! [outputs.postgresql_copy] Index on (%s) of table %s skipped, the table has no column %s",
+				strings.Join(columns, ", "), table, missing)
+			continue
+		}
+
+		if err := c.Exec(ctx, createIndexSQL(p.schemaOf(table), table, columns)); err != nil {
+			return fmt.Errorf("creating index: %s", err)
+		}
+	}
+	return nil
+}
+
+// createIndexSQL returns the statement creating the index of columns, named
+// after the table and the columns.
+func createIndexSQL(schema, table string, columns []string) string {
+	name := table + "_" + strings.Join(columns, "_") + "_idx"
+	return "CREATE INDEX IF NOT EXISTS " + quoteIdentifier(name) +
+		" ON " + quoteTable(schema, table) + " (" + strings.Join(quoteIdentifiers(columns), ", ") + ")"
+}
+
+// createDomainSQL returns a statement creating a domain unless it exists,
+// which CREATE DOMAIN has no IF NOT EXISTS clause for.
+func createDomainSQL(name, definition string) string {
+	return "DO $$ BEGIN CREATE DOMAIN " + quoteIdentifier(name) + " AS " + definition +
+		"; EXCEPTION WHEN duplicate_object THEN NULL; END $$"
+}
+
+// createHypertable turns a table created by the plugin into a TimescaleDB
+// hypertable partitioned on the time column. Without the timescaledb
+// extension the table is left a regular table and an error is logged.
+func (p *PostgresqlCopy) createHypertable(ctx context.Context, c conn, table string) error {
+	installed, err := c.HasExtension(ctx, "timescaledb")
+	if err != nil {
+		return err
+	}
+	if !installed {
+		log.Printf("E! [outputs.postgresql_copy] Table %s is not a hypertable, "+
+			"timescaledb is enabled but the timescaledb extension is not installed", table)
+		return nil
+	}
+
+	timeColumn := p.layout().forTable(table).timeColumn
+	if err := c.Exec(ctx, createHypertableSQL(p.schemaOf(table), table, timeColumn, p.ChunkTimeInterval.Duration)); err != nil {
+		return fmt.Errorf("creating hypertable: %s", err)
+	}
+	return nil
+}
+
+// createHypertableSQL returns the statement creating a hypertable, with the
+// default chunk interval of TimescaleDB if interval is 0.
+func createHypertableSQL(schema, table, timeColumn string, interval time.Duration) string {
+	query := "SELECT create_hypertable(" + quoteLiteral(quoteTable(schema, table)) +
+		", " + quoteLiteral(timeColumn) + ", if_not_exists => TRUE"
+	if interval > 0 {
+		query += ", chunk_time_interval => INTERVAL " +
+			quoteLiteral(strconv.FormatInt(int64(interval/time.Microsecond), 10)+" microseconds")
+	}
+	return query + ")"
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func createTableSQL(schema, table string, columns []string, types map[string]string) string {
+	definitions := make([]string, len(columns))
+	for i, column := range columns {
+		definitions[i] = quoteIdentifier(column) + " " + types[column]
+	}
+	return "CREATE TABLE IF NOT EXISTS " + quoteTable(schema, table) +
+		" (" + strings.Join(definitions, ", ") + ")"
+}
+
+// renameColumns applies the configured column renames to table. A column is
+// only renamed if the old column exists and the new one does not, so that
+// renames are applied once and are a no-op on an already migrated table.
+func (p *PostgresqlCopy) renameColumns(ctx context.Context, c conn, table string, columns map[string]string) error {
+	froms := make([]string, 0, len(p.ColumnRenames))
+	for from := range p.ColumnRenames {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+
+	for _, from := range froms {
+		to := p.ColumnRenames[from]
+		dataType, ok := columns[from]
+		if !ok {
+			continue
+		}
+		if _, ok := columns[to]; ok {
+			continue
+		}
+
+		if err := c.Exec(ctx, renameColumnSQL(p.schemaOf(table), table, from, to)); err != nil {
+			return err
+		}
+		delete(columns, from)
+		columns[to] = dataType
+	}
+	return nil
+}
+
+func renameColumnSQL(schema, table, from, to string) string {
+	return "ALTER TABLE " + quoteTable(schema, table) +
+		" RENAME COLUMN " + quoteIdentifier(from) + " TO " + quoteIdentifier(to)
+}
@@ -0,0 +1,554 @@
+package postgresql_copy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnRenames(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage_percent": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{
+		tables: map[string]map[string]string{
+			"cpu": {
+				"time":  "timestamp with time zone",
+				"host":  "text",
+				"usage": "double precision",
+			},
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.ColumnRenames = map[string]string{
+		"usage":   "usage_percent",
+		"missing": "renamed",
+	}
+
+	require.NoError(t, p.Write(metrics))
+	require.NoError(t, p.Write(metrics))
+	require.Equal(t, []string{
+		`ALTER TABLE "cpu" RENAME COLUMN "usage" TO "usage_percent"`,
+	}, c.execs)
+	require.Equal(t, map[string]string{
+		"time":          "timestamp with time zone",
+		"host":          "text",
+		"usage_percent": "double precision",
+	}, p.tables["cpu"])
+}
+
+func TestColumnRenamesAlreadyMigrated(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage_percent": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{
+		tables: map[string]map[string]string{
+			"cpu": {
+				"time":          "timestamp with time zone",
+				"host":          "text",
+				"usage_percent": "double precision",
+			},
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.ColumnRenames = map[string]string{"usage": "usage_percent"}
+
+	require.NoError(t, p.Write(metrics))
+	require.Empty(t, c.execs)
+}
+
+func TestAutoCreate(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{
+				"usage": 1.5,
+				"count": int64(1),
+				"bytes": uint64(1),
+			},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "b"},
+			map[string]interface{}{
+				"up":      true,
+				"message": "ok",
+			},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+
+	require.NoError(t, p.Write(metrics))
+	require.NoError(t, p.Write(metrics))
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "cpu" ("time" timestamptz, "bytes" numeric, "count" int8, ` +
+			`"host" text, "message" text, "up" boolean, "usage" float8)`,
+	}, c.execs)
+	require.Len(t, c.copies, 2)
+}
+
+func TestAutoCreateUnsigned(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("net",
+			map[string]string{},
+			map[string]interface{}{"bytes_recv": int64(42)},
+			time.Unix(0, 0)),
+		testutil.MustMetric("net",
+			map[string]string{},
+			map[string]interface{}{"bytes_recv": uint64(1<<63 + 1)},
+			time.Unix(1, 0)),
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+
+	require.NoError(t, p.Write(metrics))
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "net" ("time" timestamptz, "bytes_recv" numeric)`,
+	}, c.execs)
+	require.Len(t, c.copies, 1)
+	require.Equal(t, "1970-01-01T00:00:00Z\t42\n1970-01-01T00:00:01Z\t9223372036854775809\n", c.copies[0].data)
+}
+
+func TestAutoCreateTimeColumn(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+	p.TimeColumn = "ts"
+
+	require.NoError(t, p.Write(metrics))
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "cpu" ("ts" timestamptz, "host" text, "usage" float8)`,
+	}, c.execs)
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "cpu" ("ts", "host", "usage") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\ta\t1.5\n",
+	}}, c.copies)
+}
+
+func TestAutoCreateTagsAsJSONB(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+	p.TagsAsJSONB = true
+
+	require.NoError(t, p.Write(metrics))
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "cpu" ("time" timestamptz, "tags" jsonb, "usage" float8)`,
+	}, c.execs)
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "cpu" ("time", "tags", "usage") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\t{\"host\":\"a\"}\t1.5\n",
+	}}, c.copies)
+}
+
+func TestAutoCreateSingleTable(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("mem",
+			map[string]string{},
+			map[string]interface{}{"free": int64(42)},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+	p.SingleTable = true
+	p.TableName = "metrics"
+
+	require.NoError(t, p.Write(metrics))
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "metrics" ("time" timestamptz, "name" text, "free" int8, "host" text, "usage" float8)`,
+	}, c.execs)
+}
+
+func TestAutoCreateSchema(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{extensions: map[string]bool{"timescaledb": true}}
+	p := newTestPostgresqlCopy(c)
+	p.Schema = "telemetry"
+	p.AutoCreate = true
+	p.TimescaleDB = true
+
+	require.NoError(t, p.Write(metrics))
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "telemetry"."cpu" ("time" timestamptz, "usage" float8)`,
+		`SELECT create_hypertable('"telemetry"."cpu"', 'time', if_not_exists => TRUE)`,
+	}, c.execs)
+	require.Equal(t, `COPY "telemetry"."cpu" ("time", "usage") FROM STDIN`, c.copies[0].query)
+}
+
+func TestSchemaSQL(t *testing.T) {
+	require.Equal(t, `ALTER TABLE "my""schema"."cpu" ADD COLUMN IF NOT EXISTS "usage" float8`,
+		addColumnSQL(`my"schema`, "cpu", "usage", "float8"))
+	require.Equal(t, `ALTER TABLE "telemetry"."cpu" RENAME COLUMN "a" TO "b"`,
+		renameColumnSQL("telemetry", "cpu", "a", "b"))
+	require.Equal(t, `ALTER TABLE "cpu" RENAME COLUMN "a" TO "b"`,
+		renameColumnSQL("", "cpu", "a", "b"))
+}
+
+func TestConnectSetSearchPathRequiresSchema(t *testing.T) {
+	p := &PostgresqlCopy{SetSearchPath: true}
+	require.EqualError(t, p.Connect(), "set_search_path requires schema")
+}
+
+func TestAutoCreateExistingTable(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{
+		tables: map[string]map[string]string{
+			"cpu": {
+				"time":  "timestamp with time zone",
+				"usage": "double precision",
+			},
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+
+	require.NoError(t, p.Write(metrics))
+	require.Empty(t, c.execs)
+}
+
+func TestAutoAddColumns(t *testing.T) {
+	c := &fakeConn{
+		tables: map[string]map[string]string{
+			"cpu": {
+				"time":  "timestamp with time zone",
+				"host":  "text",
+				"usage": "double precision",
+			},
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.AutoAddColumns = true
+
+	first := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(first))
+	require.Empty(t, c.execs)
+
+	second := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a", "cpu": "cpu0"},
+			map[string]interface{}{"usage": 1.5, "count": int64(2)},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(second))
+	require.NoError(t, p.Write(second))
+	require.Equal(t, []string{
+		`ALTER TABLE "cpu" ADD COLUMN IF NOT EXISTS "count" int8`,
+		`ALTER TABLE "cpu" ADD COLUMN IF NOT EXISTS "cpu" text`,
+	}, c.execs)
+	require.Equal(t, map[string]string{
+		"time":  "timestamp with time zone",
+		"host":  "text",
+		"usage": "double precision",
+		"count": "int8",
+		"cpu":   "text",
+	}, p.tables["cpu"])
+}
+
+func TestWriteGeneratedColumns(t *testing.T) {
+	c := &fakeConn{
+		tables: map[string]map[string]string{
+			"cpu": {
+				"id":    generatedType,
+				"time":  "timestamp with time zone",
+				"host":  "text",
+				"usage": "double precision",
+			},
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.AutoAddColumns = true
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a", "id": "7"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+	require.Empty(t, c.execs)
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "cpu" ("time", "host", "usage") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\ta\t1.5\n",
+	}}, c.copies)
+}
+
+// duplicateColumnConn fails adding a column like a database where another
+// writer added it first.
+type duplicateColumnConn struct {
+	*fakeConn
+}
+
+func (c *duplicateColumnConn) Exec(ctx context.Context, query string, args ...interface{}) error {
+	c.fakeConn.Exec(ctx, query, args...)
+	return pgx.PgError{Code: "42701", Message: `column "count" of relation "cpu" already exists`}
+}
+
+func TestAutoAddColumnsConcurrentlyAdded(t *testing.T) {
+	c := &duplicateColumnConn{fakeConn: &fakeConn{
+		tables: map[string]map[string]string{
+			"cpu": {
+				"time":  "timestamp with time zone",
+				"usage": "double precision",
+			},
+		},
+	}}
+	p := newTestPostgresqlCopy(c.fakeConn)
+	p.acquire = func() (conn, error) {
+		return c, nil
+	}
+	p.AutoAddColumns = true
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 1.5, "count": int64(2)},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+	require.Len(t, c.copies, 1)
+	require.Equal(t, "int8", p.tables["cpu"]["count"])
+}
+
+func TestAutoAddColumnsMissingTable(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.AutoAddColumns = true
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+	require.Empty(t, c.execs)
+	require.NotContains(t, p.tables, "cpu")
+
+	// the table created in the meantime is loaded by the next write
+	c.tables = map[string]map[string]string{
+		"cpu": {"time": "timestamp with time zone"},
+	}
+	require.NoError(t, p.Write(metrics))
+	require.Equal(t, []string{
+		`ALTER TABLE "cpu" ADD COLUMN IF NOT EXISTS "usage" float8`,
+	}, c.execs)
+}
+
+func TestColumnDomains(t *testing.T) {
+	c := &fakeConn{
+		copyErr: func(data string) error {
+			if strings.Contains(data, "120") {
+				return pgx.PgError{Code: "23514", Message: `value for domain percentage violates check constraint "percentage_check"`}
+			}
+			return nil
+		},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+	p.IsolateRowErrors = true
+	p.Domains = map[string]string{
+		"percentage": "float8 CHECK (VALUE BETWEEN 0 AND 100)",
+	}
+	p.ColumnDomains = map[string]string{"usage": "percentage"}
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 50.0},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 120.0},
+			time.Unix(1, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+	require.NoError(t, p.Write(metrics[:1]))
+
+	require.Equal(t, []string{
+		"BEGIN",
+		`DO $$ BEGIN CREATE DOMAIN "percentage" AS float8 CHECK (VALUE BETWEEN 0 AND 100); ` +
+			`EXCEPTION WHEN duplicate_object THEN NULL; END $$`,
+		`CREATE TABLE IF NOT EXISTS "cpu" ("time" timestamptz, "usage" "percentage")`,
+		"SAVEPOINT row",
+		"RELEASE SAVEPOINT row",
+		"SAVEPOINT row",
+		"ROLLBACK TO SAVEPOINT row",
+		"COMMIT",
+		"BEGIN",
+		"SAVEPOINT row",
+		"RELEASE SAVEPOINT row",
+		"COMMIT",
+	}, c.execs)
+	require.Len(t, c.copies, 2)
+}
+
+func TestTimescaleDB(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	tests := []struct {
+		name      string
+		installed bool
+		interval  time.Duration
+		execs     []string
+	}{
+		{
+			name:      "default chunk interval",
+			installed: true,
+			execs: []string{
+				`CREATE TABLE IF NOT EXISTS "cpu" ("time" timestamptz, "usage" float8)`,
+				`SELECT create_hypertable('"cpu"', 'time', if_not_exists => TRUE)`,
+			},
+		},
+		{
+			name:      "chunk interval",
+			installed: true,
+			interval:  24 * time.Hour,
+			execs: []string{
+				`CREATE TABLE IF NOT EXISTS "cpu" ("time" timestamptz, "usage" float8)`,
+				`SELECT create_hypertable('"cpu"', 'time', if_not_exists => TRUE, ` +
+					`chunk_time_interval => INTERVAL '86400000000 microseconds')`,
+			},
+		},
+		{
+			name:      "extension not installed",
+			installed: false,
+			execs: []string{
+				`CREATE TABLE IF NOT EXISTS "cpu" ("time" timestamptz, "usage" float8)`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeConn{extensions: map[string]bool{"timescaledb": tt.installed}}
+			p := newTestPostgresqlCopy(c)
+			p.AutoCreate = true
+			p.TimescaleDB = true
+			p.ChunkTimeInterval = internal.Duration{Duration: tt.interval}
+
+			require.NoError(t, p.Write(metrics))
+			require.Equal(t, tt.execs, c.execs)
+			require.Len(t, c.copies, 1)
+		})
+	}
+}
+
+func TestTimescaleDBExistingTable(t *testing.T) {
+	c := &fakeConn{
+		tables: map[string]map[string]string{
+			"cpu": {
+				"time":  "timestamp with time zone",
+				"usage": "double precision",
+			},
+		},
+		extensions: map[string]bool{"timescaledb": true},
+	}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+	p.TimescaleDB = true
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+	require.Empty(t, c.execs)
+}
+
+func TestConnectTimescaleDBRequiresAutoCreate(t *testing.T) {
+	p := &PostgresqlCopy{TimescaleDB: true}
+	require.EqualError(t, p.Connect(), "timescaledb requires auto_create")
+}
+
+func TestAutoCreateIndexes(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.AutoCreate = true
+	p.Indexes = [][]string{{"time"}, {"host", "time"}, {"region"}}
+
+	require.NoError(t, p.Write(metrics))
+	require.NoError(t, p.Write(metrics))
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "cpu" ("time" timestamptz, "host" text, "usage" float8)`,
+		`CREATE INDEX IF NOT EXISTS "cpu_time_idx" ON "cpu" ("time")`,
+		`CREATE INDEX IF NOT EXISTS "cpu_host_time_idx" ON "cpu" ("host", "time")`,
+	}, c.execs)
+}
+
+func TestConnectIndexes(t *testing.T) {
+	p := &PostgresqlCopy{Indexes: [][]string{{"time"}}}
+	require.EqualError(t, p.Connect(), "indexes requires auto_create")
+
+	p = &PostgresqlCopy{AutoCreate: true, Indexes: [][]string{{}}}
+	require.EqualError(t, p.Connect(), "indexes cannot contain an empty column list")
+}
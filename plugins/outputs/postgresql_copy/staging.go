@@ -0,0 +1,40 @@
+package postgresql_copy
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// stagingTable is the staging table rows are copied into with
+// insert_mode = "staging".
+const stagingTable = "telegraf_staging"
+
+// stage writes the rows of r into table by copying them into a staging
+// table and inserting them from there with a single INSERT ... SELECT. The
+// mode implies batch_transaction = "write", so the statements run in the
+// transaction of the write and nothing of it is visible before it commits.
+func (p *PostgresqlCopy) stage(ctx context.Context, c conn, table string, columns []string, r io.Reader) error {
+	stagingSchema, staging, create := p.stagingTableSQL(stagingTable, table)
+	if err := c.Exec(ctx, create); err != nil {
+		return err
+	}
+	copyCtx, cancel := p.copyContext(ctx)
+	_, err := c.Copy(copyCtx, p.dialect.copySQL(stagingSchema, staging, columns, p.CopyFormat), r)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := c.Exec(ctx, stagingSQL(p.schemaOf(table), table, stagingSchema, staging, columns)); err != nil {
+		return err
+	}
+	return c.Exec(ctx, "DROP TABLE "+quoteTable(stagingSchema, staging))
+}
+
+// stagingSQL returns the statement inserting the rows of the staging table
+// into table.
+func stagingSQL(schema, table, stagingSchema, staging string, columns []string) string {
+	quoted := strings.Join(quoteIdentifiers(columns), ", ")
+	return "INSERT INTO " + quoteTable(schema, table) + " (" + quoted + ")" +
+		" SELECT " + quoted + " FROM " + quoteTable(stagingSchema, staging)
+}
@@ -0,0 +1,109 @@
+package postgresql_copy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStagingSQL(t *testing.T) {
+	require.Equal(t,
+		`INSERT INTO "telemetry"."cpu" ("time", "host", "usage") `+
+			`SELECT "time", "host", "usage" FROM "pg_temp"."telegraf_staging"`,
+		stagingSQL("telemetry", "cpu", "pg_temp", "telegraf_staging", []string{"time", "host", "usage"}))
+}
+
+func TestWriteStaging(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("mem",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"free": int64(42)},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.InsertMode = "staging"
+	p.BatchTransaction = "write"
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []string{
+		"BEGIN",
+		`CREATE TEMPORARY TABLE "telegraf_staging" (LIKE "cpu" INCLUDING DEFAULTS) ON COMMIT DROP`,
+		`INSERT INTO "cpu" ("time", "host", "usage") SELECT "time", "host", "usage" FROM "pg_temp"."telegraf_staging"`,
+		`DROP TABLE "pg_temp"."telegraf_staging"`,
+		`CREATE TEMPORARY TABLE "telegraf_staging" (LIKE "mem" INCLUDING DEFAULTS) ON COMMIT DROP`,
+		`INSERT INTO "mem" ("time", "free", "host") SELECT "time", "free", "host" FROM "pg_temp"."telegraf_staging"`,
+		`DROP TABLE "pg_temp"."telegraf_staging"`,
+		"COMMIT",
+	}, c.execs)
+	require.Equal(t, []fakeCopy{
+		{
+			query: `COPY "pg_temp"."telegraf_staging" ("time", "host", "usage") FROM STDIN`,
+			data:  "1970-01-01T00:00:00Z\ta\t1.5\n",
+		},
+		{
+			query: `COPY "pg_temp"."telegraf_staging" ("time", "free", "host") FROM STDIN`,
+			data:  "1970-01-01T00:00:00Z\t42\ta\n",
+		},
+	}, c.copies)
+
+	// a failing table rolls back the tables inserted before it
+	c = &fakeConn{copyErr: func(data string) error {
+		if data == "1970-01-01T00:00:00Z\t42\ta\n" {
+			return errors.New("invalid input syntax")
+		}
+		return nil
+	}}
+	p = newTestPostgresqlCopy(c)
+	p.InsertMode = "staging"
+	p.BatchTransaction = "write"
+	require.Error(t, p.Write(metrics))
+	require.Equal(t, "ROLLBACK", c.execs[len(c.execs)-1])
+	require.NotContains(t, c.execs, "COMMIT")
+}
+
+func TestWriteStagingPoolModeTransaction(t *testing.T) {
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+	}
+
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.InsertMode = "staging"
+	p.PoolMode = "transaction"
+	p.BatchTransaction = "write"
+	p.stagingSuffix = func() string { return "0123456789abcdef" }
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []string{
+		"BEGIN",
+		`CREATE UNLOGGED TABLE "telegraf_staging_0123456789abcdef" (LIKE "cpu" INCLUDING DEFAULTS)`,
+		`INSERT INTO "cpu" ("time", "host", "usage") SELECT "time", "host", "usage" FROM "telegraf_staging_0123456789abcdef"`,
+		`DROP TABLE "telegraf_staging_0123456789abcdef"`,
+		"COMMIT",
+	}, c.execs)
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "telegraf_staging_0123456789abcdef" ("time", "host", "usage") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\ta\t1.5\n",
+	}}, c.copies)
+}
+
+func TestConnectStaging(t *testing.T) {
+	p := &PostgresqlCopy{InsertMode: "staging", IsolateRowErrors: true}
+	require.EqualError(t, p.Connect(), `insert_mode "staging" cannot be used with isolate_row_errors`)
+
+	p = &PostgresqlCopy{InsertMode: "staging", RejectTable: "rejects"}
+	require.EqualError(t, p.Connect(), `insert_mode "staging" cannot be used with reject_table`)
+}
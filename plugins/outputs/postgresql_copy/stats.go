@@ -0,0 +1,97 @@
+package postgresql_copy
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/influxdata/telegraf/selfstat"
+	"github.com/jackc/pgx"
+)
+
+// poolStats are the internal metrics reporting the usage of the connection
+// pool, they are collected by the internal input.
+type poolStats struct {
+	maxOpen      selfstat.Stat
+	open         selfstat.Stat
+	inUse        selfstat.Stat
+	idle         selfstat.Stat
+	waitCount    selfstat.Stat
+	waitDuration selfstat.Stat
+}
+
+// statsTags returns the tags of the internal metrics, identifying the server
+// and database without exposing credentials.
+func statsTags(address string) map[string]string {
+	tags := map[string]string{}
+	if config, err := pgx.ParseConnectionString(address); err == nil {
+		tags["server"] = config.Host
+		tags["database"] = config.Database
+	}
+	return tags
+}
+
+// tableStats are the internal metrics reporting the writes to a table.
+type tableStats struct {
+	rowsWritten  selfstat.Stat
+	rowsDropped  selfstat.Stat
+	rowsRejected selfstat.Stat
+	copyErrors   selfstat.Stat
+}
+
+func newTableStats(tags map[string]string, table string) *tableStats {
+	tableTags := map[string]string{"table": table}
+	for k, v := range tags {
+		tableTags[k] = v
+	}
+	return &tableStats{
+		rowsWritten:  selfstat.Register("postgresql_copy", "rows_written", tableTags),
+		rowsDropped:  selfstat.Register("postgresql_copy", "rows_dropped", tableTags),
+		rowsRejected: selfstat.Register("postgresql_copy", "rows_rejected", tableTags),
+		copyErrors:   selfstat.Register("postgresql_copy", "copy_errors", tableTags),
+	}
+}
+
+func newPoolStats(tags map[string]string) *poolStats {
+	return &poolStats{
+		maxOpen:      selfstat.Register("postgresql_copy", "pool_max_open_connections", tags),
+		open:         selfstat.Register("postgresql_copy", "pool_open_connections", tags),
+		inUse:        selfstat.Register("postgresql_copy", "pool_in_use", tags),
+		idle:         selfstat.Register("postgresql_copy", "pool_idle", tags),
+		waitCount:    selfstat.Register("postgresql_copy", "pool_wait_count", tags),
+		waitDuration: selfstat.Register("postgresql_copy", "pool_wait_duration_ns", tags),
+	}
+}
+
+func (s *poolStats) set(stats sql.DBStats) {
+	s.maxOpen.Set(int64(stats.MaxOpenConnections))
+	s.open.Set(int64(stats.OpenConnections))
+	s.inUse.Set(int64(stats.InUse))
+	s.idle.Set(int64(stats.Idle))
+	s.waitCount.Set(stats.WaitCount)
+	s.waitDuration.Set(int64(stats.WaitDuration))
+}
+
+// poll updates the pool stats from db every interval until done is
+// closed. A warning is logged when writes had to wait for a connection, which
+// means the pool is too small for the write concurrency.
+func (s *poolStats) poll(db *sql.DB, interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastWaitCount int64
+	for {
+		stats := db.Stats()
+		s.set(stats)
+		if waits := stats.WaitCount - lastWaitCount; waits > 0 {
+			log.Printf("W! [outputs.postgresql_copy] Connection pool saturated, %d writes waited for a connection", waits)
+		}
+		lastWaitCount = stats.WaitCount
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
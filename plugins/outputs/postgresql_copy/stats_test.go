@@ -0,0 +1,68 @@
+package postgresql_copy
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"github.com/influxdata/telegraf/selfstat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsTags(t *testing.T) {
+	require.Equal(t, map[string]string{
+		"server":   "db.example.com",
+		"database": "metrics",
+	}, statsTags("host=db.example.com user=telegraf password=secret dbname=metrics"))
+}
+
+func TestPoolStats(t *testing.T) {
+	stats := newPoolStats(map[string]string{"server": "test_pool_stats"})
+	stats.set(sql.DBStats{
+		MaxOpenConnections: 4,
+		OpenConnections:    4,
+		InUse:              3,
+		Idle:               1,
+		WaitCount:          7,
+		WaitDuration:       250 * time.Millisecond,
+	})
+
+	var found bool
+	for _, m := range selfstat.Metrics() {
+		if m.Name() != "internal_postgresql_copy" || m.Tags()["server"] != "test_pool_stats" {
+			continue
+		}
+		found = true
+		require.Equal(t, map[string]interface{}{
+			"pool_max_open_connections": int64(4),
+			"pool_open_connections":     int64(4),
+			"pool_in_use":               int64(3),
+			"pool_idle":                 int64(1),
+			"pool_wait_count":           int64(7),
+			"pool_wait_duration_ns":     int64(250 * time.Millisecond),
+		}, m.Fields())
+	}
+	require.True(t, found, "pool stats metric not found")
+}
+
+func TestConfigurePoolLimits(t *testing.T) {
+	newPostgresqlCopy := func() *PostgresqlCopy {
+		return outputs.Outputs["postgresql_copy"]().(*PostgresqlCopy)
+	}
+
+	db, err := sql.Open("pgx", "host=localhost dbname=metrics")
+	require.NoError(t, err)
+	defer db.Close()
+
+	p := newPostgresqlCopy()
+	p.WriteConcurrency = 4
+	p.configurePool(db)
+	require.Equal(t, 4, db.Stats().MaxOpenConnections)
+
+	p = newPostgresqlCopy()
+	p.WriteConcurrency = 4
+	p.MaxOpenConnections = 2
+	p.configurePool(db)
+	require.Equal(t, 2, db.Stats().MaxOpenConnections)
+}
@@ -0,0 +1,86 @@
+package postgresql_copy
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"text/template"
+
+	"github.com/influxdata/telegraf"
+)
+
+// tableData is the data a table_template is executed with.
+type tableData struct {
+	Measurement string
+	Tags        map[string]string
+}
+
+// parseTableTemplate parses the table_template option, an empty template
+// returns nil.
+func parseTableTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	t, err := template.New("table_template").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("table_template: %s", err)
+	}
+	return t, nil
+}
+
+// executeTableTemplate returns the sanitized table name produced by t for m,
+// and the name before it was sanitized.
+func executeTableTemplate(t *template.Template, m telegraf.Metric) (string, string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, tableData{Measurement: m.Name(), Tags: m.Tags()}); err != nil {
+		return "", "", err
+	}
+	table := sanitizeIdentifier(buf.String())
+	if table == "" {
+		return "", "", fmt.Errorf("empty table name")
+	}
+	return table, buf.String(), nil
+}
+
+// tableNames detects the names that become the same table once sanitized,
+// like cpu-usage and cpu_usage, and handles them after on_table_collision.
+type tableNames struct {
+	sync.Mutex
+	// suffix writes a colliding name to its own table instead of failing
+	suffix bool
+	// sources holds the name first written to every table, before it was
+	// sanitized
+	sources map[string]string
+}
+
+func newTableNames(onCollision string) *tableNames {
+	return &tableNames{
+		suffix:  onCollision == "suffix",
+		sources: make(map[string]string),
+	}
+}
+
+// resolve returns the table of the name source, sanitized to table. The first
+// name written to a table keeps it, another name is an error, or is written
+// to the table followed by a hash of the name with suffix.
+func (n *tableNames) resolve(table, source string) (string, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	first, ok := n.sources[table]
+	if !ok {
+		n.sources[table] = source
+		return table, nil
+	}
+	if first == source {
+		return table, nil
+	}
+	if !n.suffix {
+		return "", fmt.Errorf("%q and %q are both written to table %s", first, source, table)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(source))
+	return fmt.Sprintf("%s_%08x", table, h.Sum32()), nil
+}
@@ -0,0 +1,125 @@
+package postgresql_copy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteTableTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		expected string
+		err      bool
+	}{
+		{template: "metrics_{{.Measurement}}", expected: "metrics_cpu_usage"},
+		{template: "{{.Tags.tenant}}_{{.Measurement}}", expected: "acme_corp_cpu_usage"},
+		{template: "{{.Measurement}}{{.Tags.missing}}", expected: "cpu_usage"},
+		{template: "{{.Tags.missing}}", err: true},
+	}
+
+	m := testutil.MustMetric("cpu.usage",
+		map[string]string{"tenant": "Acme Corp"},
+		map[string]interface{}{"value": 1.5},
+		time.Unix(0, 0))
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			tmpl, err := parseTableTemplate(tt.template)
+			require.NoError(t, err)
+			table, _, err := executeTableTemplate(tmpl, m)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, table)
+		})
+	}
+}
+
+func TestParseTableTemplate(t *testing.T) {
+	tmpl, err := parseTableTemplate("")
+	require.NoError(t, err)
+	require.Nil(t, tmpl)
+
+	_, err = parseTableTemplate("{{.Measurement")
+	require.Error(t, err)
+}
+
+func TestWriteTableTemplate(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	tmpl, err := parseTableTemplate("{{.Tags.tenant}}_{{.Measurement}}")
+	require.NoError(t, err)
+	p.tableTemplate = tmpl
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"tenant": "a"},
+			map[string]interface{}{"usage": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{"tenant": "b"},
+			map[string]interface{}{"usage": 2.5},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "a_cpu" ("time", "tenant", "usage") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\ta\t1.5\n",
+	}, {
+		query: `COPY "b_cpu" ("time", "tenant", "usage") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\tb\t2.5\n",
+	}}, c.copies)
+}
+
+func TestConnectTableTemplateSingleTable(t *testing.T) {
+	p := &PostgresqlCopy{
+		SingleTable:   true,
+		TableName:     "metrics",
+		TableTemplate: "{{.Measurement}}",
+	}
+	require.EqualError(t, p.Connect(), "table_template cannot be used with single_table")
+}
+
+func TestTableCollision(t *testing.T) {
+	tmpl, err := parseTableTemplate("{{.Measurement}}")
+	require.NoError(t, err)
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu_usage",
+			map[string]string{},
+			map[string]interface{}{"value": 1.5},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu-usage",
+			map[string]string{},
+			map[string]interface{}{"value": "high"},
+			time.Unix(0, 0)),
+	}
+
+	layout := columnLayout{timeColumn: "time", tableTemplate: tmpl, tableNames: newTableNames("error")}
+	_, err = buildColumns(metrics, layout)
+	require.EqualError(t, err, `"cpu_usage" and "cpu-usage" are both written to table cpu_usage`)
+
+	layout.tableNames = newTableNames("suffix")
+	columns, err := buildColumns(metrics, layout)
+	require.NoError(t, err)
+	require.Equal(t, Columns{
+		"cpu_usage":          {"time", "value"},
+		"cpu_usage_4ca24e03": {"time", "value"},
+	}, columns)
+
+	// the first name keeps the table in later batches
+	columns, err = buildColumns(metrics[1:], layout)
+	require.NoError(t, err)
+	require.Equal(t, Columns{"cpu_usage_4ca24e03": {"time", "value"}}, columns)
+}
+
+func TestConnectInvalidOnTableCollision(t *testing.T) {
+	p := &PostgresqlCopy{OnTableCollision: "merge"}
+	require.EqualError(t, p.Connect(), `invalid on_table_collision "merge", must be "error" or "suffix"`)
+}
@@ -0,0 +1,131 @@
+package postgresql_copy
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var sslModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// connectionString returns the address with the sslmode, ssl_ca, ssl_cert,
+// ssl_key and connect_timeout options, and the schema as search_path with
+// set_search_path, folded into its parameters. The options that are set
+// replace the same parameters of the address, other parameters of the address
+// are kept as they are. The parameters set by neither default to the libpq
+// environment variables, like PGHOST or PGPASSWORD. The application_name
+// option only applies when neither the address nor PGAPPNAME set one.
+//
+// A host that is an absolute path is the directory of a unix socket, which
+// like with libpq never uses TLS: the sslmode is then disable and the other
+// TLS options are ignored.
+func (p *PostgresqlCopy) connectionString() (string, error) {
+	if p.SSLMode != "" && !sslModes[p.SSLMode] {
+		return "", fmt.Errorf("invalid sslmode %q", p.SSLMode)
+	}
+
+	u, err := url.Parse(p.Address)
+	isURI := err == nil && u.Scheme != ""
+
+	var host string
+	if isURI {
+		host = u.Hostname()
+	} else {
+		host = dsnValue(p.Address, "host")
+	}
+	if host == "" {
+		host = getenv("PGHOST")
+	}
+	socket := isSocket(host)
+	if socket && isURI {
+		return "", fmt.Errorf("unix socket host %q requires a key/value address", host)
+	}
+
+	params := [][2]string{
+		{"sslmode", p.SSLMode},
+		{"sslrootcert", p.SSLCA},
+		{"sslcert", p.SSLCert},
+		{"sslkey", p.SSLKey},
+	}
+	if socket {
+		params = [][2]string{{"sslmode", "disable"}}
+	}
+	if timeout := p.ConnectTimeout.Duration; timeout > 0 {
+		seconds := int64((timeout + time.Second - 1) / time.Second)
+		params = append(params, [2]string{"connect_timeout", strconv.FormatInt(seconds, 10)})
+	}
+	// A transaction pooler does not keep the parameters of the session, the
+	// search_path is then set in the transaction of every write
+	if p.SetSearchPath && p.PoolMode != "transaction" {
+		params = append(params, [2]string{"search_path", p.Schema})
+	}
+
+	if isURI {
+		set := uriParams(u)
+		query := u.Query()
+		for _, param := range params {
+			if param[1] != "" {
+				setURIParam(u, query, param[0], param[1])
+				set[param[0]] = true
+			}
+		}
+		for _, env := range libpqEnv {
+			if value := getenv(env[0]); value != "" && !set[env[1]] {
+				setURIParam(u, query, env[1], value)
+				set[env[1]] = true
+			}
+		}
+		if p.ApplicationName != "" && !set["application_name"] {
+			query.Set("application_name", p.ApplicationName)
+		}
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+
+	address := p.Address
+	set := dsnParams(address)
+	for _, param := range params {
+		if param[1] == "" {
+			continue
+		}
+		// Values of a key/value connection string cannot be quoted
+		if strings.ContainsAny(param[1], " '\"") {
+			return "", fmt.Errorf("%s %q cannot contain spaces or quotes, use a postgres:// address", param[0], param[1])
+		}
+		address = removeDSNParam(address, param[0]) + " " + param[0] + "=" + param[1]
+		set[param[0]] = true
+	}
+	if socket {
+		for _, name := range []string{"sslrootcert", "sslcert", "sslkey"} {
+			set[name] = true
+		}
+	}
+	for _, env := range libpqEnv {
+		value := getenv(env[0])
+		if value == "" || set[env[1]] {
+			continue
+		}
+		// The value is not part of the error, it may be a password
+		if strings.ContainsAny(value, " '\"") {
+			return "", fmt.Errorf("%s cannot contain spaces or quotes, use a postgres:// address", env[0])
+		}
+		address += " " + env[1] + "=" + value
+		set[env[1]] = true
+	}
+	if p.ApplicationName != "" && !set["application_name"] {
+		if strings.ContainsAny(p.ApplicationName, " '\"") {
+			return "", fmt.Errorf("application_name %q cannot contain spaces or quotes, use a postgres:// address", p.ApplicationName)
+		}
+		address += " application_name=" + p.ApplicationName
+	}
+	return strings.TrimSpace(address), nil
+}
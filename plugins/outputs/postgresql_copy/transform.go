@@ -0,0 +1,80 @@
+package postgresql_copy
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// transform converts a numeric field value before it is written.
+type transform func(float64) float64
+
+// parseTransforms parses the column_transforms option, keyed by column name.
+func parseTransforms(specs map[string]string) (map[string]transform, error) {
+	transforms := make(map[string]transform, len(specs))
+	for column, spec := range specs {
+		t, err := parseTransform(spec)
+		if err != nil {
+			return nil, fmt.Errorf("column_transforms %s: %s", column, err)
+		}
+		transforms[column] = t
+	}
+	return transforms, nil
+}
+
+// parseTransform parses a transform spec, the name of the transform followed
+// by its space separated arguments: "multiply <factor>", "clamp <min> <max>"
+// or "abs".
+func parseTransform(spec string) (transform, error) {
+	words := strings.Fields(spec)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty transform")
+	}
+
+	args := make([]float64, len(words)-1)
+	for i, word := range words[1:] {
+		arg, err := strconv.ParseFloat(word, 64)
+		if err != nil {
+			return nil, fmt.Errorf("transform %q: invalid argument %q", spec, word)
+		}
+		args[i] = arg
+	}
+
+	switch words[0] {
+	case "multiply":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("transform %q: multiply takes a factor", spec)
+		}
+		factor := args[0]
+		return func(v float64) float64 { return v * factor }, nil
+	case "clamp":
+		if len(args) != 2 || args[0] > args[1] {
+			return nil, fmt.Errorf("transform %q: clamp takes a minimum and a greater maximum", spec)
+		}
+		min, max := args[0], args[1]
+		return func(v float64) float64 { return math.Max(min, math.Min(max, v)) }, nil
+	case "abs":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("transform %q: abs takes no argument", spec)
+		}
+		return math.Abs, nil
+	default:
+		return nil, fmt.Errorf("unknown transform %q", words[0])
+	}
+}
+
+// applyTransform applies t to a numeric field value, the result is always a
+// float.
+func applyTransform(t transform, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int64:
+		return t(float64(v)), nil
+	case uint64:
+		return t(float64(v)), nil
+	case float64:
+		return t(v), nil
+	default:
+		return nil, fmt.Errorf("transform of non numeric value %T", v)
+	}
+}
@@ -0,0 +1,100 @@
+package postgresql_copy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTransform(t *testing.T) {
+	tests := []struct {
+		spec     string
+		input    float64
+		expected float64
+		err      bool
+	}{
+		{spec: "multiply 1000", input: 1.5, expected: 1500},
+		{spec: "multiply -1", input: 2, expected: -2},
+		{spec: "clamp 0 100", input: 120, expected: 100},
+		{spec: "clamp 0 100", input: -5, expected: 0},
+		{spec: "clamp 0 100", input: 42, expected: 42},
+		{spec: "abs", input: -3.5, expected: 3.5},
+		{spec: "", err: true},
+		{spec: "multiply", err: true},
+		{spec: "multiply x", err: true},
+		{spec: "clamp 100 0", err: true},
+		{spec: "abs 1", err: true},
+		{spec: "round", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			transform, err := parseTransform(tt.spec)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, transform(tt.input))
+		})
+	}
+}
+
+func TestWriteColumnTransforms(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	transforms, err := parseTransforms(map[string]string{"latency": "multiply 0.001"})
+	require.NoError(t, err)
+	p.transforms = transforms
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("ping",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"latency": int64(1500), "count": int64(1500)},
+			time.Unix(0, 0)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "ping" ("time", "count", "host", "latency") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\t1500\ta\t1.5\n",
+	}}, c.copies)
+}
+
+func TestWriteColumnTransformsNonNumeric(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	transforms, err := parseTransforms(map[string]string{"status": "abs"})
+	require.NoError(t, err)
+	p.transforms = transforms
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("ping",
+			map[string]string{},
+			map[string]interface{}{"status": "ok"},
+			time.Unix(0, 0)),
+	}
+	require.Error(t, p.Write(metrics))
+}
+
+func TestWriteColumnTransformsFieldsAsJSONB(t *testing.T) {
+	c := &fakeConn{}
+	p := newTestPostgresqlCopy(c)
+	p.FieldsAsJSONB = true
+	transforms, err := parseTransforms(map[string]string{"usage": "multiply 100"})
+	require.NoError(t, err)
+	p.transforms = transforms
+
+	m := testutil.MustMetric("cpu",
+		map[string]string{},
+		map[string]interface{}{"usage": 0.5},
+		time.Unix(0, 0))
+	require.NoError(t, p.Write([]telegraf.Metric{m}))
+	require.Equal(t, []fakeCopy{{
+		query: `COPY "cpu" ("time", "fields") FROM STDIN`,
+		data:  "1970-01-01T00:00:00Z\t{\"usage\":50}\n",
+	}}, c.copies)
+}
@@ -0,0 +1,139 @@
+package postgresql_copy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// upsertTable is the staging table rows are copied into with
+// insert_mode = "upsert".
+const upsertTable = "telegraf_upsert"
+
+// upsert writes the rows of r into table by copying them into a staging
+// table and inserting them from there, updating the rows conflicting on
+// conflict_columns. Unless the write is already in a transaction with
+// batch_transaction = "write", the statements run in a transaction of their
+// own so that the staging table is dropped on failure.
+func (p *PostgresqlCopy) upsert(ctx context.Context, c conn, table string, columns []string, r io.Reader) error {
+	transaction := p.BatchTransaction != "write"
+	if transaction {
+		if err := c.Exec(ctx, "BEGIN"); err != nil {
+			return err
+		}
+	}
+
+	if err := p.upsertRows(ctx, c, table, columns, r); err != nil {
+		if transaction {
+			c.Exec(ctx, "ROLLBACK")
+		}
+		return err
+	}
+
+	if transaction {
+		return c.Exec(ctx, "COMMIT")
+	}
+	return nil
+}
+
+func (p *PostgresqlCopy) upsertRows(ctx context.Context, c conn, table string, columns []string, r io.Reader) error {
+	stagingSchema, staging, create := p.stagingTableSQL(upsertTable, table)
+	if err := c.Exec(ctx, create); err != nil {
+		return err
+	}
+	copyCtx, cancel := p.copyContext(ctx)
+	_, err := c.Copy(copyCtx, p.dialect.copySQL(stagingSchema, staging, columns, p.CopyFormat), r)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := c.Exec(ctx, upsertSQL(p.schemaOf(table), table, stagingSchema, staging, columns, p.ConflictColumns)); err != nil {
+		return err
+	}
+	return c.Exec(ctx, "DROP TABLE "+quoteTable(stagingSchema, staging))
+}
+
+// stagingTableSQL returns the schema and name of the table the rows of table
+// are copied into before being inserted, and the statement creating it. It is
+// the temporary table name, or with pool_mode = "transaction" a regular
+// unlogged table in the schema of table, as poolers may not support temporary
+// tables, named after name with a random suffix so that concurrent writes do
+// not share it. The table is dropped once its rows are inserted, or by the
+// rollback of a failed write.
+func (p *PostgresqlCopy) stagingTableSQL(name, table string) (string, string, string) {
+	schema := p.schemaOf(table)
+	if p.PoolMode != "transaction" {
+		return "pg_temp", name, createTempTableSQL(name, schema, table)
+	}
+
+	suffix := p.stagingSuffix
+	if suffix == nil {
+		suffix = randomSuffix
+	}
+	staging := name + "_" + suffix()
+	return schema, staging, "CREATE UNLOGGED TABLE " + quoteTable(schema, staging) +
+		" (LIKE " + quoteTable(schema, table) + " INCLUDING DEFAULTS)"
+}
+
+// randomSuffix returns 16 random hexadecimal digits, or the current time if
+// no random bytes are available.
+func randomSuffix() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// createTempTableSQL returns the statement creating the temporary table temp
+// with the columns of table.
+func createTempTableSQL(temp, schema, table string) string {
+	return "CREATE TEMPORARY TABLE " + quoteIdentifier(temp) +
+		" (LIKE " + quoteTable(schema, table) + " INCLUDING DEFAULTS) ON COMMIT DROP"
+}
+
+// upsertSQL returns the statement inserting the rows of the staging table
+// into table. Only the last copied row of rows with the same conflict
+// columns is inserted, as a row cannot be updated twice by the statement; the
+// rows of a new staging table are in the order they were copied. A
+// conflicting row gets the values of the inserted row, except for its
+// NULL values, so that metrics with different fields are merged.
+func upsertSQL(schema, table, stagingSchema, staging string, columns, conflict []string) string {
+	quoted := quoteIdentifiers(columns)
+	keys := strings.Join(quoteIdentifiers(conflict), ", ")
+
+	query := "INSERT INTO " + quoteTable(schema, table) + " AS t (" + strings.Join(quoted, ", ") + ")" +
+		" SELECT DISTINCT ON (" + keys + ") " + strings.Join(quoted, ", ") +
+		" FROM " + quoteTable(stagingSchema, staging) +
+		" ORDER BY " + keys + ", ctid DESC" +
+		" ON CONFLICT (" + keys + ") DO "
+
+	isKey := make(map[string]bool, len(conflict))
+	for _, column := range conflict {
+		isKey[column] = true
+	}
+	var updates []string
+	for _, column := range columns {
+		if isKey[column] {
+			continue
+		}
+		q := quoteIdentifier(column)
+		updates = append(updates, q+" = COALESCE(EXCLUDED."+q+", t."+q+")")
+	}
+	if len(updates) == 0 {
+		return query + "NOTHING"
+	}
+	return query + "UPDATE SET " + strings.Join(updates, ", ")
+}
+
+func quoteIdentifiers(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+	return quoted
+}
@@ -0,0 +1,117 @@
+package postgresql_copy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpsertSQL(t *testing.T) {
+	require.Equal(t,
+		`INSERT INTO "telemetry"."cpu" AS t ("time", "host", "usage") `+
+			`SELECT DISTINCT ON ("time", "host") "time", "host", "usage" FROM "pg_temp"."telegraf_upsert" `+
+			`ORDER BY "time", "host", ctid DESC `+
+			`ON CONFLICT ("time", "host") DO UPDATE SET "usage" = COALESCE(EXCLUDED."usage", t."usage")`,
+		upsertSQL("telemetry", "cpu", "pg_temp", "telegraf_upsert", []string{"time", "host", "usage"}, []string{"time", "host"}))
+
+	require.Equal(t,
+		`INSERT INTO "cpu" AS t ("time", "host") `+
+			`SELECT DISTINCT ON ("time", "host") "time", "host" FROM "pg_temp"."telegraf_upsert" `+
+			`ORDER BY "time", "host", ctid DESC `+
+			`ON CONFLICT ("time", "host") DO NOTHING`,
+		upsertSQL("", "cpu", "pg_temp", "telegraf_upsert", []string{"time", "host"}, []string{"time", "host"}))
+}
+
+func TestStagingTableSQL(t *testing.T) {
+	p := &PostgresqlCopy{Schema: "telemetry"}
+	schema, staging, create := p.stagingTableSQL(upsertTable, "cpu")
+	require.Equal(t, "pg_temp", schema)
+	require.Equal(t, "telegraf_upsert", staging)
+	require.Equal(t, `CREATE TEMPORARY TABLE "telegraf_upsert" (LIKE "telemetry"."cpu" INCLUDING DEFAULTS) ON COMMIT DROP`, create)
+
+	// temporary tables belong to the session, which a transaction pooler
+	// does not keep
+	p.PoolMode = "transaction"
+	schema, staging, create = p.stagingTableSQL(upsertTable, "cpu")
+	require.Equal(t, "telemetry", schema)
+	require.Regexp(t, `^telegraf_upsert_[0-9a-f]{16}$`, staging)
+	require.Equal(t, `CREATE UNLOGGED TABLE "telemetry"."`+staging+`" (LIKE "telemetry"."cpu" INCLUDING DEFAULTS)`, create)
+
+	_, other, _ := p.stagingTableSQL(upsertTable, "cpu")
+	require.NotEqual(t, staging, other)
+}
+
+func TestWriteUpsert(t *testing.T) {
+	tests := []struct {
+		name             string
+		batchTransaction string
+		expected         []string
+	}{
+		{
+			name:             "chunk",
+			batchTransaction: "chunk",
+			expected: []string{
+				"BEGIN",
+				`CREATE TEMPORARY TABLE "telegraf_upsert" (LIKE "cpu" INCLUDING DEFAULTS) ON COMMIT DROP`,
+				`INSERT INTO "cpu" AS t ("time", "host", "usage") ` +
+					`SELECT DISTINCT ON ("time", "host") "time", "host", "usage" FROM "pg_temp"."telegraf_upsert" ` +
+					`ORDER BY "time", "host", ctid DESC ` +
+					`ON CONFLICT ("time", "host") DO UPDATE SET "usage" = COALESCE(EXCLUDED."usage", t."usage")`,
+				`DROP TABLE "pg_temp"."telegraf_upsert"`,
+				"COMMIT",
+			},
+		},
+		{
+			name:             "write",
+			batchTransaction: "write",
+			expected: []string{
+				"BEGIN",
+				`CREATE TEMPORARY TABLE "telegraf_upsert" (LIKE "cpu" INCLUDING DEFAULTS) ON COMMIT DROP`,
+				`INSERT INTO "cpu" AS t ("time", "host", "usage") ` +
+					`SELECT DISTINCT ON ("time", "host") "time", "host", "usage" FROM "pg_temp"."telegraf_upsert" ` +
+					`ORDER BY "time", "host", ctid DESC ` +
+					`ON CONFLICT ("time", "host") DO UPDATE SET "usage" = COALESCE(EXCLUDED."usage", t."usage")`,
+				`DROP TABLE "pg_temp"."telegraf_upsert"`,
+				"COMMIT",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeConn{}
+			p := newTestPostgresqlCopy(c)
+			p.InsertMode = "upsert"
+			p.ConflictColumns = []string{"time", "host"}
+			p.BatchTransaction = tt.batchTransaction
+
+			metrics := []telegraf.Metric{
+				testutil.MustMetric("cpu",
+					map[string]string{"host": "a"},
+					map[string]interface{}{"usage": 1.5},
+					time.Unix(0, 0)),
+			}
+			require.NoError(t, p.Write(metrics))
+
+			require.Equal(t, tt.expected, c.execs)
+			require.Equal(t, []fakeCopy{{
+				query: `COPY "pg_temp"."telegraf_upsert" ("time", "host", "usage") FROM STDIN`,
+				data:  "1970-01-01T00:00:00Z\ta\t1.5\n",
+			}}, c.copies)
+		})
+	}
+}
+
+func TestConnectInsertMode(t *testing.T) {
+	p := &PostgresqlCopy{InsertMode: "merge"}
+	require.EqualError(t, p.Connect(), `invalid insert_mode "merge", must be "copy", "upsert", "staging" or "insert"`)
+
+	p = &PostgresqlCopy{InsertMode: "upsert"}
+	require.EqualError(t, p.Connect(), `insert_mode "upsert" requires conflict_columns`)
+
+	p = &PostgresqlCopy{InsertMode: "upsert", ConflictColumns: []string{"time"}, IsolateRowErrors: true}
+	require.EqualError(t, p.Connect(), `insert_mode "upsert" cannot be used with isolate_row_errors`)
+}